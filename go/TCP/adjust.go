@@ -0,0 +1,322 @@
+// adjust.go
+package main
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Corrections tonales ponctuelles : luminosité, contraste, gamma, niveaux, courbes et
+// décalages TSL/TSV. Chaque correction est décrite une fois (pointLUT : tables par canal,
+// fonction de mélange pour TSL/TSV), puis appliquée à tous les pixels par applyPointLUT,
+// comme la dernière phase de PosterizeQuantilesColor.
+
+// toneCurve tabule f (valeurs 0..1 -> 0..1, hors bornes écrêté)
+func toneCurve(f func(v float64) float64) [256]uint8 {
+	var lut [256]uint8
+	for v := range lut {
+		lut[v] = uint8(math.Round(min(max(f(float64(v)/255), 0), 1) * 255))
+	}
+	return lut
+}
+
+// sameCurves : la même table pour R, G et B
+func sameCurves(f func(v float64) float64) *pointLUT {
+	curve := toneCurve(f)
+	return &pointLUT{curves: [3][256]uint8{curve, curve, curve}}
+}
+
+// Brightness ajoute amount (-255..255) à chaque canal
+func Brightness(img image.Image, workers int, amount float64) *image.RGBA {
+	return applyPointLUT(toRGBA(img), workers, sameCurves(func(v float64) float64 {
+		return v + amount/255
+	}))
+}
+
+// Contrast étire (amount > 0) ou resserre (amount < 0, -100 = gris uniforme) les valeurs
+// autour du gris moyen : facteur 1 + amount/100.
+func Contrast(img image.Image, workers int, amount float64) (*image.RGBA, error) {
+	if amount < -100 {
+		return nil, fmt.Errorf("contrast: amount %g < -100", amount)
+	}
+	factor := 1 + amount/100
+	return applyPointLUT(toRGBA(img), workers, sameCurves(func(v float64) float64 {
+		return (v-0.5)*factor + 0.5
+	})), nil
+}
+
+// Gamma : v^(1/gamma) (gamma > 1 éclaircit les tons moyens)
+func Gamma(img image.Image, workers int, gamma float64) (*image.RGBA, error) {
+	if gamma <= 0 {
+		return nil, fmt.Errorf("gamma: %g doit être > 0", gamma)
+	}
+	return applyPointLUT(toRGBA(img), workers, sameCurves(func(v float64) float64 {
+		return math.Pow(v, 1/gamma)
+	})), nil
+}
+
+// channelMask renvoie les canaux modifiés : rgb (tous), red, green ou blue
+func channelMask(channel string) ([3]bool, error) {
+	switch channel {
+	case "", "rgb":
+		return [3]bool{true, true, true}, nil
+	case "red":
+		return [3]bool{true, false, false}, nil
+	case "green":
+		return [3]bool{false, true, false}, nil
+	case "blue":
+		return [3]bool{false, false, true}, nil
+	default:
+		return [3]bool{}, fmt.Errorf("canal inconnu: %q (rgb, red, green, blue)", channel)
+	}
+}
+
+// LevelsOptions : paramètres des niveaux (valeurs 0..255)
+type LevelsOptions struct {
+	Black, White       float64 // entrée : valeurs ramenées à 0 et 255
+	Mid                float64 // gamma des tons moyens (1 = linéaire)
+	OutBlack, OutWhite float64 // sortie : plage finale
+	Channel            string  // rgb, red, green, blue
+}
+
+// Levels : (v - black) / (white - black), puis gamma mid, puis ramené sur OutBlack..OutWhite.
+func Levels(img image.Image, workers int, opts LevelsOptions) (*image.RGBA, error) {
+	if opts.White <= opts.Black {
+		return nil, fmt.Errorf("levels: white (%g) doit être > black (%g)", opts.White, opts.Black)
+	}
+	if opts.Mid <= 0 {
+		return nil, fmt.Errorf("levels: mid %g doit être > 0", opts.Mid)
+	}
+	channels, err := channelMask(opts.Channel)
+	if err != nil {
+		return nil, err
+	}
+
+	curve := toneCurve(func(v float64) float64 {
+		t := min(max((v*255-opts.Black)/(opts.White-opts.Black), 0), 1)
+		t = math.Pow(t, 1/opts.Mid)
+		return (opts.OutBlack + t*(opts.OutWhite-opts.OutBlack)) / 255
+	})
+	lut := &pointLUT{curves: identityCurves()}
+	for c, on := range channels {
+		if on {
+			lut.curves[c] = curve
+		}
+	}
+	return applyPointLUT(toRGBA(img), workers, lut), nil
+}
+
+// curvePoint : point de contrôle d'une courbe (entrée, sortie) en 0..255
+type curvePoint struct{ x, y float64 }
+
+// parseCurvePoints lit "x,y|x,y|..." (au moins deux points, x distincts)
+func parseCurvePoints(s string) ([]curvePoint, error) {
+	var points []curvePoint
+	for _, part := range strings.Split(s, "|") {
+		xs, ys, ok := strings.Cut(strings.TrimSpace(part), ",")
+		x, errX := strconv.ParseFloat(strings.TrimSpace(xs), 64)
+		y, errY := strconv.ParseFloat(strings.TrimSpace(ys), 64)
+		if !ok || errX != nil || errY != nil {
+			return nil, fmt.Errorf("point de courbe invalide: %q (attendu x,y)", part)
+		}
+		points = append(points, curvePoint{x, y})
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i].x < points[j].x })
+	if len(points) < 2 {
+		return nil, fmt.Errorf("courbe: au moins deux points")
+	}
+	for i := 1; i < len(points); i++ {
+		if points[i].x == points[i-1].x {
+			return nil, fmt.Errorf("courbe: deux points en x=%g", points[i].x)
+		}
+	}
+	return points, nil
+}
+
+// curveLUT tabule la courbe passant par les points : interpolation cubique monotone
+// (Fritsch-Carlson, pas de dépassement entre deux points), constante hors des points.
+func curveLUT(points []curvePoint) [256]uint8 {
+	n := len(points)
+	delta := make([]float64, n-1)
+	for i := range delta {
+		delta[i] = (points[i+1].y - points[i].y) / (points[i+1].x - points[i].x)
+	}
+	slope := make([]float64, n)
+	slope[0], slope[n-1] = delta[0], delta[n-2]
+	for i := 1; i < n-1; i++ {
+		if delta[i-1]*delta[i] <= 0 {
+			continue
+		}
+		slope[i] = (delta[i-1] + delta[i]) / 2
+	}
+	for i, d := range delta {
+		if d == 0 {
+			slope[i], slope[i+1] = 0, 0
+			continue
+		}
+		a, b := slope[i]/d, slope[i+1]/d
+		if h := a*a + b*b; h > 9 {
+			t := 3 / math.Sqrt(h)
+			slope[i], slope[i+1] = t*a*d, t*b*d
+		}
+	}
+
+	return toneCurve(func(v float64) float64 {
+		x := v * 255
+		if x <= points[0].x {
+			return points[0].y / 255
+		}
+		if x >= points[n-1].x {
+			return points[n-1].y / 255
+		}
+		i := sort.Search(n-1, func(i int) bool { return points[i+1].x >= x })
+		h := points[i+1].x - points[i].x
+		t := (x - points[i].x) / h
+		t2, t3 := t*t, t*t*t
+		y := (2*t3-3*t2+1)*points[i].y + (t3-2*t2+t)*h*slope[i] +
+			(-2*t3+3*t2)*points[i+1].y + (t3-t2)*h*slope[i+1]
+		return y / 255
+	})
+}
+
+// Curves applique une courbe par canal (nil = inchangé), puis la courbe commune master.
+func Curves(img image.Image, workers int, master []curvePoint, channels [3][]curvePoint) *image.RGBA {
+	lut := &pointLUT{curves: identityCurves()}
+	for c, points := range channels {
+		if points != nil {
+			lut.curves[c] = curveLUT(points)
+		}
+	}
+	if master != nil {
+		m := curveLUT(master)
+		for c := range lut.curves {
+			for v := range lut.curves[c] {
+				lut.curves[c][v] = m[lut.curves[c][v]]
+			}
+		}
+	}
+	return applyPointLUT(toRGBA(img), workers, lut)
+}
+
+// Teinte / saturation / luminosité
+
+// rgbToHSL : r, g, b en 0..1 -> teinte (degrés), saturation et luminosité (0..1)
+func rgbToHSL(r, g, b float64) (h, s, l float64) {
+	hi, lo := max(r, g, b), min(r, g, b)
+	l = (hi + lo) / 2
+	if hi == lo {
+		return 0, 0, l
+	}
+	d := hi - lo
+	if l > 0.5 {
+		s = d / (2 - hi - lo)
+	} else {
+		s = d / (hi + lo)
+	}
+	return hue(r, g, b, hi, d), s, l
+}
+
+// rgbToHSV : r, g, b en 0..1 -> teinte (degrés), saturation et valeur (0..1)
+func rgbToHSV(r, g, b float64) (h, s, v float64) {
+	hi, lo := max(r, g, b), min(r, g, b)
+	if hi == lo {
+		return 0, 0, hi
+	}
+	return hue(r, g, b, hi, hi-lo), (hi - lo) / hi, hi
+}
+
+// hue : teinte commune à TSL et TSV (hi = max, d = max - min > 0)
+func hue(r, g, b, hi, d float64) float64 {
+	var h float64
+	switch hi {
+	case r:
+		h = (g - b) / d
+	case g:
+		h = (b-r)/d + 2
+	default:
+		h = (r-g)/d + 4
+	}
+	return math.Mod(h*60+360, 360)
+}
+
+// hueToRGB : reconstruction à partir de la teinte, du chroma c et de la plus petite valeur m
+func hueToRGB(h, c, m float64) (r, g, b float64) {
+	h = math.Mod(math.Mod(h, 360)+360, 360) / 60
+	x := c * (1 - math.Abs(math.Mod(h, 2)-1))
+	switch int(h) {
+	case 0:
+		r, g, b = c, x, 0
+	case 1:
+		r, g, b = x, c, 0
+	case 2:
+		r, g, b = 0, c, x
+	case 3:
+		r, g, b = 0, x, c
+	case 4:
+		r, g, b = x, 0, c
+	default:
+		r, g, b = c, 0, x
+	}
+	return r + m, g + m, b + m
+}
+
+// hslToRGB : inverse de rgbToHSL
+func hslToRGB(h, s, l float64) (float64, float64, float64) {
+	c := (1 - math.Abs(2*l-1)) * s
+	return hueToRGB(h, c, l-c/2)
+}
+
+// hsvToRGB : inverse de rgbToHSV
+func hsvToRGB(h, s, v float64) (float64, float64, float64) {
+	c := v * s
+	return hueToRGB(h, c, v-c)
+}
+
+// shiftUnit décale une grandeur 0..1 de amount % (-100..100) : vers 1 si amount > 0,
+// vers 0 sinon, proportionnellement à la marge restante.
+func shiftUnit(v, amount float64) float64 {
+	if amount > 0 {
+		return v + (1-v)*min(amount, 100)/100
+	}
+	return v + v*max(amount, -100)/100
+}
+
+// scaleUnit multiplie une grandeur 0..1 par 1 + amount/100 (-100 = 0), borné à 1 : une
+// saturation nulle (gris, blanc, noir) reste nulle, quelle que soit la teinte renvoyée.
+func scaleUnit(v, amount float64) float64 {
+	return min(v*max(1+amount/100, 0), 1)
+}
+
+// HSLOptions : décalages teinte / saturation / luminosité (ou valeur en TSV)
+type HSLOptions struct {
+	Model      string  // hsl ou hsv
+	Hue        float64 // degrés
+	Saturation float64 // % : saturation x (1 + Saturation/100), -100 = gris
+	Lightness  float64 // -100..100 % (luminosité en hsl, valeur en hsv)
+}
+
+// HSLShift décale teinte, saturation et luminosité (hsl) ou valeur (hsv). La conversion
+// mélange les canaux : elle passe par l'étape mix de applyPointLUT.
+func HSLShift(img image.Image, workers int, opts HSLOptions) (*image.RGBA, error) {
+	var to func(r, g, b float64) (float64, float64, float64)
+	var from func(h, s, l float64) (float64, float64, float64)
+	switch opts.Model {
+	case "", "hsl":
+		to, from = rgbToHSL, hslToRGB
+	case "hsv":
+		to, from = rgbToHSV, hsvToRGB
+	default:
+		return nil, fmt.Errorf("modèle inconnu: %q (hsl, hsv)", opts.Model)
+	}
+
+	mix := func(r, g, b float64) (float64, float64, float64) {
+		h, s, l := to(r/255, g/255, b/255)
+		r, g, b = from(h+opts.Hue, scaleUnit(s, opts.Saturation), shiftUnit(l, opts.Lightness))
+		return r * 255, g * 255, b * 255
+	}
+	return applyPointLUT(toRGBA(img), workers, &pointLUT{curves: identityCurves(), mix: mix}), nil
+}
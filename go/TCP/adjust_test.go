@@ -0,0 +1,164 @@
+// adjust_test.go
+package main
+
+import (
+	"image"
+	"math"
+	"testing"
+)
+
+// grayRamp : les 256 gris, un par pixel
+func grayRamp() *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, 256, 1))
+	for v := 0; v < 256; v++ {
+		img.Pix[4*v+0], img.Pix[4*v+1], img.Pix[4*v+2], img.Pix[4*v+3] = uint8(v), uint8(v), uint8(v), 255
+	}
+	return img
+}
+
+func TestHSLShiftKeepsNeutrals(t *testing.T) {
+	cases := []HSLOptions{
+		{Model: "hsl", Saturation: 50},
+		{Model: "hsv", Saturation: 50},
+		{Model: "hsl", Saturation: 100, Hue: 120},
+		{Model: "hsv", Saturation: 300, Lightness: 20},
+		{Model: "hsl", Saturation: -50, Lightness: -30},
+	}
+	for _, opts := range cases {
+		out, err := HSLShift(grayRamp(), 4, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < len(out.Pix); i += 4 {
+			if r, g, b := out.Pix[i], out.Pix[i+1], out.Pix[i+2]; r != g || g != b {
+				t.Fatalf("%+v : le gris %d devient (%d, %d, %d)", opts, i/4, r, g, b)
+			}
+		}
+	}
+}
+
+func TestHSLConversionsRoundTrip(t *testing.T) {
+	src := randomImage(40, 40, 1)
+	for i := 0; i < len(src.Pix); i += 4 {
+		r, g, b := float64(src.Pix[i])/255, float64(src.Pix[i+1])/255, float64(src.Pix[i+2])/255
+		conversions := []struct {
+			name string
+			to   func(r, g, b float64) (float64, float64, float64)
+			from func(h, s, l float64) (float64, float64, float64)
+		}{
+			{"hsl", rgbToHSL, hslToRGB},
+			{"hsv", rgbToHSV, hsvToRGB},
+		}
+		for _, c := range conversions {
+			r2, g2, b2 := c.from(c.to(r, g, b))
+			if math.Abs(r2-r)+math.Abs(g2-g)+math.Abs(b2-b) > 1e-9 {
+				t.Fatalf("%s : (%g, %g, %g) -> (%g, %g, %g)", c.name, r, g, b, r2, g2, b2)
+			}
+		}
+	}
+}
+
+// TestHSLShiftExact : HSLShift donne la conversion exacte, arrondie, sur un échantillon
+// dense du cube RGB (pas de 3, bords inclus), y compris près du noir, du blanc et des gris.
+func TestHSLShiftExact(t *testing.T) {
+	cases := []HSLOptions{
+		{Model: "hsl", Hue: 180},
+		{Model: "hsl", Hue: 45, Saturation: 60, Lightness: 20},
+		{Model: "hsv", Hue: -90, Saturation: -40, Lightness: 30},
+		{Model: "hsv", Saturation: 100},
+	}
+	for _, opts := range cases {
+		to, from := rgbToHSL, hslToRGB
+		if opts.Model == "hsv" {
+			to, from = rgbToHSV, hsvToRGB
+		}
+		out, err := HSLShift(cubeSample(), 2, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < len(out.Pix); i += 4 {
+			src := cubeSamplePix(i / 4)
+			h, s, l := to(float64(src[0])/255, float64(src[1])/255, float64(src[2])/255)
+			r, g, b := from(h+opts.Hue, scaleUnit(s, opts.Saturation), shiftUnit(l, opts.Lightness))
+			want := [3]uint8{mixChannel(r * 255), mixChannel(g * 255), mixChannel(b * 255)}
+			if got := [3]uint8{out.Pix[i], out.Pix[i+1], out.Pix[i+2]}; got != want {
+				t.Fatalf("%+v : %v -> %v, attendu %v", opts, src, got, want)
+			}
+		}
+	}
+}
+
+// cubeSamplePix renvoie la couleur i de cubeSample
+func cubeSamplePix(i int) [3]uint8 {
+	const n = 86 // 0, 3, ..., 255
+	return [3]uint8{uint8(i / (n * n) * 3), uint8(i / n % n * 3), uint8(i % n * 3)}
+}
+
+// cubeSample : une image contenant les couleurs dont chaque canal est multiple de 3
+func cubeSample() *image.RGBA {
+	const n = 86
+	img := image.NewRGBA(image.Rect(0, 0, n*n, n))
+	for i := 0; i < n*n*n; i++ {
+		c := cubeSamplePix(i)
+		img.Pix[4*i+0], img.Pix[4*i+1], img.Pix[4*i+2], img.Pix[4*i+3] = c[0], c[1], c[2], 255
+	}
+	return img
+}
+
+func TestToneIdentities(t *testing.T) {
+	src := randomImage(31, 17, 2)
+	points, err := parseCurvePoints("0,0|255,255")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		name string
+		run  func() (*image.RGBA, error)
+	}{
+		{"brightness 0", func() (*image.RGBA, error) { return Brightness(src, 3, 0), nil }},
+		{"contrast 0", func() (*image.RGBA, error) { return Contrast(src, 3, 0) }},
+		{"gamma 1", func() (*image.RGBA, error) { return Gamma(src, 3, 1) }},
+		{"levels", func() (*image.RGBA, error) {
+			return Levels(src, 3, LevelsOptions{Black: 0, White: 255, Mid: 1, OutBlack: 0, OutWhite: 255})
+		}},
+		{"curves", func() (*image.RGBA, error) { return Curves(src, 3, points, [3][]curvePoint{}), nil }},
+	}
+	for _, c := range cases {
+		out, err := c.run()
+		if err != nil {
+			t.Fatalf("%s : %v", c.name, err)
+		}
+		if d := maxDiff(t, out, src); d != 0 {
+			t.Errorf("%s : écart %d", c.name, d)
+		}
+	}
+
+	// SubImage : Stride de l'entrée différent de celui de la sortie
+	want := Brightness(src, 3, 20)
+	if d := maxDiff(t, Brightness(embedded(src), 3, 20), want); d != 0 {
+		t.Errorf("brightness 20, SubImage : écart %d", d)
+	}
+	hsl := HSLOptions{Model: "hsl", Hue: 40, Saturation: 10}
+	want, _ = HSLShift(src, 3, hsl)
+	if got, _ := HSLShift(embedded(src), 3, hsl); maxDiff(t, got, want) != 0 {
+		t.Error("hsl, SubImage : résultat différent")
+	}
+}
+
+func TestCurveLUTMonotone(t *testing.T) {
+	points, err := parseCurvePoints("0,0|60,10|70,200|190,210|255,255")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lut := curveLUT(points)
+	for v := 1; v < 256; v++ {
+		if lut[v] < lut[v-1] {
+			t.Fatalf("courbe décroissante en %d : %d < %d", v, lut[v], lut[v-1])
+		}
+	}
+	for _, p := range points {
+		if got := float64(lut[int(p.x)]); math.Abs(got-p.y) > 0.5 {
+			t.Errorf("la courbe ne passe pas par (%g, %g) : %g", p.x, p.y, got)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+// animated.go
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"sync"
+)
+
+// decodeAnimatedGIF renvoie le GIF complet s'il contient plusieurs frames.
+// image.Decode ne lit que la première frame : on passe donc par gif.DecodeAll.
+func decodeAnimatedGIF(data []byte) (*gif.GIF, bool) {
+	g, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil || len(g.Image) < 2 {
+		return nil, false
+	}
+	return g, true
+}
+
+// composeGIFFrames reconstitue chaque frame sur le canevas complet en respectant
+// la méthode de disposal de la frame précédente (une frame GIF peut ne couvrir
+// qu'une partie du canevas).
+func composeGIFFrames(g *gif.GIF) []*image.RGBA {
+	canvasRect := image.Rect(0, 0, g.Config.Width, g.Config.Height)
+	if canvasRect.Empty() {
+		canvasRect = g.Image[0].Bounds()
+	}
+
+	canvas := image.NewRGBA(canvasRect)
+	frames := make([]*image.RGBA, len(g.Image))
+
+	for i, src := range g.Image {
+		disposal := byte(gif.DisposalNone)
+		if i < len(g.Disposal) {
+			disposal = g.Disposal[i]
+		}
+
+		// Sauvegarde du canevas si la frame doit être "annulée" ensuite
+		var previous *image.RGBA
+		if disposal == gif.DisposalPrevious {
+			previous = image.NewRGBA(canvasRect)
+			copy(previous.Pix, canvas.Pix)
+		}
+
+		draw.Draw(canvas, src.Bounds(), src, src.Bounds().Min, draw.Over)
+
+		frame := image.NewRGBA(canvasRect)
+		copy(frame.Pix, canvas.Pix)
+		frames[i] = frame
+
+		switch disposal {
+		case gif.DisposalBackground:
+			draw.Draw(canvas, src.Bounds(), image.Transparent, image.Point{}, draw.Src)
+		case gif.DisposalPrevious:
+			canvas = previous
+		}
+	}
+	return frames
+}
+
+// splitFrames répartit les workers entre les frames : frames traitées en même
+// temps (concurrent) et workers par frame (bandes horizontales).
+func splitFrames(frames int, workers int) (concurrent int, perFrame int) {
+	if workers < 1 {
+		workers = 1
+	}
+	concurrent = workers
+	if concurrent > frames {
+		concurrent = frames
+	}
+	perFrame = workers / concurrent
+	if perFrame < 1 {
+		perFrame = 1
+	}
+	return concurrent, perFrame
+}
+
+// ApplyFilterGIF applique le filtre à toutes les frames d'un GIF animé.
+// Les frames sont un axe de parallélisme supplémentaire : plusieurs frames
+// sont filtrées en même temps, chacune découpée en bandes.
+// Délais, disposal et nombre de boucles sont conservés.
+// Les frames filtrées partagent une palette adaptative (median-cut sur l'histogramme de
+// toutes les frames), écrite une seule fois comme table globale.
+func ApplyFilterGIF(g *gif.GIF, name string, workers int, radius int, params Params, region Region) (*gif.GIF, error) {
+	frames := composeGIFFrames(g)
+	filtered := make([]*image.RGBA, len(frames))
+	errs := make([]error, len(frames))
+
+	concurrent, perFrame := splitFrames(len(frames), workers)
+	sem := make(chan struct{}, concurrent)
+	var wg sync.WaitGroup
+
+	for i, frame := range frames {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, frame *image.RGBA) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			res, err := ApplyFilter(frame, name, perFrame, radius, params)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			filtered[i] = region.Apply(res, frame, perFrame)
+		}(i, frame)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	gifPalette, err := buildPalette(filtered, workers, QuantizeOptions{Colors: 256})
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*image.Paletted, len(filtered))
+	for i, frame := range filtered {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, frame *image.RGBA) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			out[i] = toPaletted(frame, gifPalette)
+		}(i, frame)
+	}
+	wg.Wait()
+
+	// taille des frames filtrées (resize, crop, rotate changent la taille)
+	bounds := out[0].Bounds()
+	result := &gif.GIF{
+		Image:     out,
+		Delay:     g.Delay,
+		Disposal:  g.Disposal,
+		LoopCount: g.LoopCount,
+		Config: image.Config{
+			ColorModel: gifPalette,
+			Width:      bounds.Dx(),
+			Height:     bounds.Dy(),
+		},
+	}
+
+	// Couleur de fond : on reprend la plus proche dans la nouvelle palette
+	if pal, ok := g.Config.ColorModel.(color.Palette); ok && int(g.BackgroundIndex) < len(pal) {
+		result.BackgroundIndex = uint8(gifPalette.Index(pal[g.BackgroundIndex]))
+	}
+	return result, nil
+}
+
+// toPaletted quantifie une frame filtrée sur la palette (tramage Floyd–Steinberg,
+// comme gif.Encode par défaut).
+func toPaletted(img *image.RGBA, pal color.Palette) *image.Paletted {
+	bounds := img.Bounds()
+	p := image.NewPaletted(bounds, pal)
+	draw.FloydSteinberg.Draw(p, bounds, img, bounds.Min)
+	return p
+}
+
+// encodeGIF ré-encode un GIF animé.
+func encodeGIF(g *gif.GIF) ([]byte, error) {
+	var buf bytes.Buffer
+	err := gif.EncodeAll(&buf, g)
+	return buf.Bytes(), err
+}
@@ -0,0 +1,158 @@
+// animated_test.go
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"testing"
+)
+
+// testPalette : quelques couleurs franches et une entrée transparente (index 0)
+var testPalette = color.Palette{
+	color.RGBA{},
+	color.RGBA{255, 0, 0, 255},
+	color.RGBA{0, 255, 0, 255},
+	color.RGBA{0, 0, 255, 255},
+	color.RGBA{255, 255, 255, 255},
+}
+
+// testGIF : 40x30, frames partielles décalées, pixels transparents et tous les disposals
+func testGIF() *gif.GIF {
+	g := &gif.GIF{LoopCount: 3, Config: image.Config{ColorModel: testPalette, Width: 40, Height: 30}}
+	disposals := []byte{gif.DisposalNone, gif.DisposalBackground, gif.DisposalPrevious, gif.DisposalNone, 0}
+	for i, disposal := range disposals {
+		p := image.NewPaletted(image.Rect(i*4, i*3, 20+i*4, 15+i*3), testPalette)
+		for j := range p.Pix {
+			p.Pix[j] = uint8((j*7 + i) % len(testPalette))
+		}
+		g.Image = append(g.Image, p)
+		g.Delay = append(g.Delay, 10*(i+1))
+		g.Disposal = append(g.Disposal, disposal)
+	}
+	return g
+}
+
+// composeReference : composition pixel par pixel, canevas gardé dans une table de couleurs
+func composeReference(g *gif.GIF) [][]color.RGBA {
+	w, h := g.Config.Width, g.Config.Height
+	canvas := make([]color.RGBA, w*h)
+	var frames [][]color.RGBA
+	for i, src := range g.Image {
+		saved := append([]color.RGBA(nil), canvas...)
+		b := src.Bounds()
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				if c := src.Palette[src.ColorIndexAt(x, y)].(color.RGBA); c.A != 0 {
+					canvas[y*w+x] = c
+				}
+			}
+		}
+		frames = append(frames, append([]color.RGBA(nil), canvas...))
+
+		switch g.Disposal[i] {
+		case gif.DisposalBackground:
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				for x := b.Min.X; x < b.Max.X; x++ {
+					canvas[y*w+x] = color.RGBA{}
+				}
+			}
+		case gif.DisposalPrevious:
+			canvas = saved
+		}
+	}
+	return frames
+}
+
+func TestComposeGIFFrames(t *testing.T) {
+	g := testGIF()
+	want := composeReference(g)
+	got := composeGIFFrames(g)
+	for i, frame := range got {
+		if frame.Bounds() != image.Rect(0, 0, 40, 30) {
+			t.Fatalf("frame %d : bornes %v", i, frame.Bounds())
+		}
+		for y := 0; y < 30; y++ {
+			for x := 0; x < 40; x++ {
+				if c := frame.RGBAAt(x, y); c != want[i][y*40+x] {
+					t.Fatalf("frame %d, (%d, %d) = %v, attendu %v", i, x, y, c, want[i][y*40+x])
+				}
+			}
+		}
+	}
+}
+
+func TestSplitFrames(t *testing.T) {
+	cases := []struct{ frames, workers, concurrent, perFrame int }{
+		{5, 1, 1, 1},
+		{5, 0, 1, 1},
+		{5, 3, 3, 1},
+		{5, 20, 5, 4},
+		{2, 7, 2, 3},
+	}
+	for _, c := range cases {
+		concurrent, perFrame := splitFrames(c.frames, c.workers)
+		if concurrent != c.concurrent || perFrame != c.perFrame {
+			t.Errorf("%d frames, %d workers : %d x %d, attendu %d x %d",
+				c.frames, c.workers, concurrent, perFrame, c.concurrent, c.perFrame)
+		}
+	}
+}
+
+// TestApplyFilterGIF : chaque frame composée est filtrée ; délais, disposal et boucles sont
+// conservés. Peu de couleurs : la palette commune les contient toutes, le résultat est exact.
+func TestApplyFilterGIF(t *testing.T) {
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, testGIF()); err != nil {
+		t.Fatal(err)
+	}
+	g, ok := decodeAnimatedGIF(buf.Bytes())
+	if !ok {
+		t.Fatal("GIF animé non reconnu")
+	}
+	composed := composeGIFFrames(g)
+
+	for _, workers := range workerCounts {
+		out, err := ApplyFilterGIF(g, "flip", workers, 0, Params{"direction": "both"}, Region{Opacity: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		encoded, err := encodeGIF(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		back, err := gif.DecodeAll(bytes.NewReader(encoded))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(back.Image) != len(g.Image) || back.LoopCount != g.LoopCount ||
+			string(back.Disposal) != string(g.Disposal) || back.Delay[4] != g.Delay[4] {
+			t.Fatalf("%d workers : %d frames, boucles %d, disposal %v, délais %v",
+				workers, len(back.Image), back.LoopCount, back.Disposal, back.Delay)
+		}
+		for i, frame := range back.Image {
+			want, _ := Flip(composed[i], 1, "both")
+			for y := 0; y < 30; y++ {
+				for x := 0; x < 40; x++ {
+					// palette commune opaque : les zones transparentes du canevas sortent en noir
+					got := color.RGBAModel.Convert(frame.At(x, y)).(color.RGBA)
+					w := want.RGBAAt(x, y)
+					w.A = 255
+					if got != w {
+						t.Fatalf("%d workers, frame %d, (%d, %d) = %v, attendu %v", workers, i, x, y, got, w)
+					}
+				}
+			}
+		}
+	}
+
+	// resize : la taille du canevas suit les frames filtrées
+	out, err := ApplyFilterGIF(g, "resize", 2, 0, Params{"width": "20", "method": "nearest"}, Region{Opacity: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Config.Width != 20 || out.Config.Height != 15 || out.Image[3].Bounds() != image.Rect(0, 0, 20, 15) {
+		t.Errorf("resize : canevas %dx%d, frame %v", out.Config.Width, out.Config.Height, out.Image[3].Bounds())
+	}
+}
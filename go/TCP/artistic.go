@@ -0,0 +1,152 @@
+// artistic.go
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+)
+
+// Effets artistiques : sépia, vignettage, relief (emboss) et dessin animé (cartoon).
+// sepia mélange les canaux : étape mix de applyPointLUT, comme HSLShift.
+// emboss est une convolution 3x3 ; cartoon enchaîne Bilateral (aplats sans perdre les
+// contours), PosterizeQuantilesColor (peu de teintes) et les contours de Sobel tracés par-dessus.
+
+// sepiaMatrix : coefficients usuels du virage sépia (une ligne par canal de sortie R, G, B)
+var sepiaMatrix = [3][3]float64{
+	{0.393, 0.769, 0.189},
+	{0.349, 0.686, 0.168},
+	{0.272, 0.534, 0.131},
+}
+
+// Sepia : virage sépia, mélangé à l'original selon amount (0..1, 1 = sépia pur).
+func Sepia(img image.Image, workers int, amount float64) (*image.RGBA, error) {
+	if amount < 0 || amount > 1 {
+		return nil, fmt.Errorf("sepia: amount %g (0..1)", amount)
+	}
+	mix := func(r, g, b float64) (float64, float64, float64) {
+		in := [3]float64{r, g, b}
+		var out [3]float64
+		for c, row := range sepiaMatrix {
+			s := min(row[0]*r+row[1]*g+row[2]*b, 255)
+			out[c] = in[c] + amount*(s-in[c])
+		}
+		return out[0], out[1], out[2]
+	}
+	return applyPointLUT(toRGBA(img), workers, &pointLUT{curves: identityCurves(), mix: mix}), nil
+}
+
+// VignetteOptions : paramètres du vignettage
+type VignetteOptions struct {
+	Strength         float64 // 0..1 : assombrissement au plus loin du centre (1 = noir)
+	Radius           float64 // 0..1 : part de la distance maximale laissée intacte autour du centre
+	CenterX, CenterY float64 // centre en fraction de la largeur et de la hauteur (0.5 = milieu)
+}
+
+// Vignette assombrit l'image en s'éloignant du centre. La distance est mesurée en fraction
+// de la largeur et de la hauteur (ellipse qui suit le format de l'image) et ramenée à 1 au
+// coin le plus éloigné ; au-delà de Radius, le facteur descend jusqu'à 1 - Strength en
+// suivant une courbe douce (smoothstep).
+func Vignette(img image.Image, workers int, opts VignetteOptions) (*image.RGBA, error) {
+	if opts.Strength < 0 || opts.Strength > 1 {
+		return nil, fmt.Errorf("vignette: strength %g (0..1)", opts.Strength)
+	}
+	if opts.Radius < 0 || opts.Radius >= 1 {
+		return nil, fmt.Errorf("vignette: radius %g (0..1, 1 exclu)", opts.Radius)
+	}
+
+	src := toRGBA(img)
+	bounds := src.Bounds()
+	out := image.NewRGBA(bounds)
+	w, h := float64(bounds.Dx()), float64(bounds.Dy())
+
+	// coin le plus éloigné du centre
+	far := math.Hypot(max(opts.CenterX, 1-opts.CenterX), max(opts.CenterY, 1-opts.CenterY))
+
+	forBands(bounds, workers, func(startY, endY int) {
+		for y := startY; y < endY; y++ {
+			dy := (float64(y-bounds.Min.Y)+0.5)/h - opts.CenterY
+			si := src.PixOffset(bounds.Min.X, y)
+			di := out.PixOffset(bounds.Min.X, y)
+			for x := 0; x < bounds.Dx(); x++ {
+				dx := (float64(x)+0.5)/w - opts.CenterX
+				t := min(max((math.Hypot(dx, dy)/far-opts.Radius)/(1-opts.Radius), 0), 1)
+				factor := 1 - opts.Strength*t*t*(3-2*t)
+				for c := 0; c < 3; c++ {
+					out.Pix[di+c] = clampUint8(float64(src.Pix[si+c]) * factor)
+				}
+				out.Pix[di+3] = src.Pix[si+3]
+				si += 4
+				di += 4
+			}
+		}
+	})
+	return out, nil
+}
+
+// embossKernel : différence entre les voisins du bas à droite et ceux du haut à gauche
+// (lumière venant du haut à gauche), multipliée par amount, plus center au milieu
+func embossKernel(amount, center float64) [][]float64 {
+	return [][]float64{
+		{-2 * amount, -amount, 0},
+		{-amount, center, amount},
+		{0, amount, 2 * amount},
+	}
+}
+
+// Emboss : effet de relief. En mode gray, relief seul sur la luminance, autour du gris moyen
+// (somme du noyau = 0, biais 128) ; en mode color, relief ajouté à l'image (somme = 1).
+func Emboss(img image.Image, workers int, amount float64, mode string, border Border) (*image.RGBA, error) {
+	switch mode {
+	case "", "gray":
+		gray, err := Grayscale(img, workers, "rec601")
+		if err != nil {
+			return nil, err
+		}
+		return Convolve(gray, workers, embossKernel(amount, 0), 1, 128, border, false), nil
+	case "color":
+		return Convolve(img, workers, embossKernel(amount, 1), 1, 0, border, false), nil
+	default:
+		return nil, fmt.Errorf("emboss: mode inconnu %q (gray, color)", mode)
+	}
+}
+
+// CartoonOptions : paramètres de l'effet dessin animé
+type CartoonOptions struct {
+	SigmaS, SigmaR float64    // lissage bilatéral (voir Bilateral)
+	Levels         int        // niveaux de posterisation par canal
+	Edge           int        // seuil de magnitude de Sobel (1..255) : plus bas, plus de traits
+	EdgeColor      color.RGBA // couleur des traits
+}
+
+// Cartoon : image lissée par Bilateral puis posterisée, avec les contours de Sobel (calculés
+// sur l'image lissée, donc sans le bruit) tracés en EdgeColor.
+func Cartoon(img image.Image, workers int, opts CartoonOptions) (*image.RGBA, error) {
+	if opts.Edge < 1 || opts.Edge > 255 {
+		return nil, fmt.Errorf("cartoon: edge %d (1..255)", opts.Edge)
+	}
+	smooth, err := Bilateral(img, workers, opts.SigmaS, opts.SigmaR)
+	if err != nil {
+		return nil, err
+	}
+	edges, err := Sobel(smooth, workers, Border{Mode: BorderClamp}, SobelOptions{Threshold: opts.Edge})
+	if err != nil {
+		return nil, err
+	}
+	out := PosterizeQuantilesColor(smooth, workers, opts.Levels)
+
+	bounds := out.Bounds()
+	forBands(bounds, workers, func(startY, endY int) {
+		for y := startY; y < endY; y++ {
+			pi := out.PixOffset(bounds.Min.X, y)
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				if edges.Pix[pi] == 255 {
+					out.Pix[pi+0], out.Pix[pi+1], out.Pix[pi+2] = opts.EdgeColor.R, opts.EdgeColor.G, opts.EdgeColor.B
+				}
+				pi += 4
+			}
+		}
+	})
+	return out, nil
+}
@@ -0,0 +1,230 @@
+// artistic_test.go
+package main
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+func TestSepiaMatchesMatrix(t *testing.T) {
+	src := randomImage(32, 24, 46)
+	for i := 3; i < len(src.Pix); i += 28 {
+		src.Pix[i] = 99
+	}
+	matrix := [3][3]float64{{0.393, 0.769, 0.189}, {0.349, 0.686, 0.168}, {0.272, 0.534, 0.131}}
+
+	for _, amount := range []float64{0, 0.4, 1} {
+		want := image.NewRGBA(src.Bounds())
+		for i := 0; i < len(src.Pix); i += 4 {
+			r, g, b := float64(src.Pix[i]), float64(src.Pix[i+1]), float64(src.Pix[i+2])
+			for c, row := range matrix {
+				s := math.Min(row[0]*r+row[1]*g+row[2]*b, 255)
+				in := float64(src.Pix[i+c])
+				want.Pix[i+c] = uint8(math.Floor(in + amount*(s-in) + 0.5))
+			}
+			want.Pix[i+3] = src.Pix[i+3]
+		}
+		for _, workers := range workerCounts {
+			got, err := Sepia(src, workers, amount)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if d := maxDiff(t, got, want); d != 0 {
+				t.Errorf("amount %g, %d workers : écart %d", amount, workers, d)
+			}
+		}
+	}
+	if _, err := Sepia(src, 1, 1.5); err == nil {
+		t.Error("amount 1.5 : erreur attendue")
+	}
+}
+
+// vignetteFactor : facteur attendu au pixel (x, y) d'une image w x h
+func vignetteFactor(x, y, w, h int, opts VignetteOptions) float64 {
+	dx := (float64(x)+0.5)/float64(w) - opts.CenterX
+	dy := (float64(y)+0.5)/float64(h) - opts.CenterY
+	far := math.Hypot(math.Max(opts.CenterX, 1-opts.CenterX), math.Max(opts.CenterY, 1-opts.CenterY))
+	t := (math.Sqrt(dx*dx+dy*dy)/far - opts.Radius) / (1 - opts.Radius)
+	t = math.Min(math.Max(t, 0), 1)
+	return 1 - opts.Strength*(3*t*t-2*t*t*t)
+}
+
+func TestVignetteMatchesReference(t *testing.T) {
+	src := randomImage(65, 41, 47)
+	b := src.Bounds()
+	for _, opts := range []VignetteOptions{
+		{Strength: 0.7, Radius: 0.3, CenterX: 0.5, CenterY: 0.5},
+		{Strength: 1, Radius: 0, CenterX: 0.2, CenterY: 0.9},
+		{Strength: 0, Radius: 0.5, CenterX: 0.5, CenterY: 0.5},
+	} {
+		want := image.NewRGBA(b)
+		for y := 0; y < b.Dy(); y++ {
+			for x := 0; x < b.Dx(); x++ {
+				f := vignetteFactor(x, y, b.Dx(), b.Dy(), opts)
+				c := src.RGBAAt(b.Min.X+x, b.Min.Y+y)
+				want.SetRGBA(b.Min.X+x, b.Min.Y+y, color.RGBA{
+					clampUint8(float64(c.R) * f), clampUint8(float64(c.G) * f), clampUint8(float64(c.B) * f), c.A})
+			}
+		}
+		for _, workers := range workerCounts {
+			got, err := Vignette(src, workers, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if d := maxDiff(t, got, want); d > 1 {
+				t.Errorf("%+v, %d workers : écart %d", opts, workers, d)
+			}
+		}
+		// SubImage : Stride de l'entrée différent de celui de la sortie
+		got, _ := Vignette(embedded(src), 3, opts)
+		if d := maxDiff(t, got, want); d > 1 {
+			t.Errorf("%+v, SubImage : écart %d", opts, d)
+		}
+	}
+
+	// blanc : centre intact, assombrissement croissant vers le coin, qui tend vers 1 - strength
+	white := uniformImage(101, 101, 255, 255, 255, 255)
+	out, _ := Vignette(white, 2, VignetteOptions{Strength: 0.6, Radius: 0.2, CenterX: 0.5, CenterY: 0.5})
+	prev := out.RGBAAt(50, 50).R
+	if prev != 255 {
+		t.Errorf("centre : %d, attendu 255", prev)
+	}
+	for i := 49; i >= 0; i-- {
+		v := out.RGBAAt(i, i).R
+		if v > prev {
+			t.Fatalf("diagonale : %d en %d après %d", v, i, prev)
+		}
+		prev = v
+	}
+	if want := 255 * 0.4; math.Abs(float64(prev)-want) > 2 {
+		t.Errorf("coin : %d, attendu environ %g", prev, want)
+	}
+
+	for _, opts := range []VignetteOptions{{Strength: 1.2}, {Strength: 0.5, Radius: 1}} {
+		if _, err := Vignette(white, 1, opts); err == nil {
+			t.Errorf("%+v : erreur attendue", opts)
+		}
+	}
+}
+
+// TestEmbossMatchesConvolve : emboss est la convolution directe du noyau de relief ;
+// une image unie donne le gris moyen 128 (mode gray) ou reste inchangée (mode color)
+func TestEmbossMatchesConvolve(t *testing.T) {
+	src := randomImage(21, 16, 48)
+	gray, _ := Grayscale(src, 1, "rec601")
+	for _, border := range testBorders {
+		for _, amount := range []float64{0.5, 1, 2} {
+			for _, workers := range workerCounts {
+				got, _ := Emboss(src, workers, amount, "gray", border)
+				if d := maxDiff(t, got, convolveReference(gray, embossKernel(amount, 0), 1, 128, border)); d > 1 {
+					t.Errorf("gray, bord %d, amount %g, %d workers : écart %d", border.Mode, amount, workers, d)
+				}
+				got, _ = Emboss(src, workers, amount, "color", border)
+				if d := maxDiff(t, got, convolveReference(src, embossKernel(amount, 1), 1, 0, border)); d > 1 {
+					t.Errorf("color, bord %d, amount %g, %d workers : écart %d", border.Mode, amount, workers, d)
+				}
+			}
+		}
+	}
+
+	flat := uniformImage(10, 8, 77, 77, 77, 255)
+	got, _ := Emboss(flat, 3, 1, "gray", Border{Mode: BorderMirror})
+	assertSame(t, got, uniformImage(10, 8, 128, 128, 128, 255))
+	got, _ = Emboss(flat, 3, 2, "color", Border{Mode: BorderMirror})
+	assertSame(t, got, flat)
+
+	if _, err := Emboss(flat, 1, 1, "sepia", Border{}); err == nil {
+		t.Error("mode sepia : erreur attendue")
+	}
+}
+
+// TestCartoonMatchesSteps : posterisation de l'image lissée, contours de Sobel de l'image
+// lissée tracés par-dessus ; même résultat quel que soit le nombre de workers
+func TestCartoonMatchesSteps(t *testing.T) {
+	src := randomImage(50, 40, 49)
+	opts := CartoonOptions{SigmaS: 2, SigmaR: 25, Levels: 4, Edge: 60, EdgeColor: color.RGBA{255, 0, 0, 255}}
+
+	smooth, _ := Bilateral(src, 1, opts.SigmaS, opts.SigmaR)
+	edges, _ := Sobel(smooth, 1, Border{Mode: BorderClamp}, SobelOptions{Threshold: opts.Edge})
+	want := PosterizeQuantilesColor(smooth, 1, opts.Levels)
+	traced := 0
+	for i := 0; i < len(want.Pix); i += 4 {
+		if edges.Pix[i] == 255 {
+			want.Pix[i+0], want.Pix[i+1], want.Pix[i+2] = 255, 0, 0
+			traced++
+		}
+	}
+	if traced == 0 || traced == len(want.Pix)/4 {
+		t.Fatalf("%d pixels de contour sur %d : seuil mal choisi pour le test", traced, len(want.Pix)/4)
+	}
+
+	for _, workers := range workerCounts {
+		got, err := Cartoon(src, workers, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertSame(t, got, want)
+	}
+
+	for _, edge := range []int{0, 256} {
+		if _, err := Cartoon(src, 1, CartoonOptions{SigmaS: 2, SigmaR: 25, Levels: 4, Edge: edge}); err == nil {
+			t.Errorf("edge %d : erreur attendue", edge)
+		}
+	}
+}
+
+// TestArtisticHandValues : une valeur calculée à la main par filtre
+func TestArtisticHandValues(t *testing.T) {
+	check := func(name string, got *image.RGBA, x, y int, want color.RGBA) {
+		t.Helper()
+		if c := got.RGBAAt(x, y); c != want {
+			t.Errorf("%s : (%d, %d) = %v, attendu %v", name, x, y, c, want)
+		}
+	}
+
+	// (100, 50, 20) : R = 39.3 + 38.45 + 3.78 = 81.53, G = 72.56, B = 56.52 ;
+	// blanc : R et G saturent à 255, B = 0.937 x 255 = 238.9, à mi-chemin 247
+	got, _ := Sepia(uniformImage(1, 1, 100, 50, 20, 255), 1, 1)
+	check("sepia", got, 0, 0, color.RGBA{82, 73, 57, 255})
+	got, _ = Sepia(uniformImage(1, 1, 255, 255, 255, 255), 1, 0.5)
+	check("sepia 0.5", got, 0, 0, color.RGBA{255, 255, 247, 255})
+
+	// 3x1 blanc : pixel du bord à 1/3 du centre, coin à hypot(1/2, 1/2) ; t = 0.4714,
+	// facteur 1 - (3t² - 2t³) = 0.5428, soit 138
+	got, _ = Vignette(uniformImage(3, 1, 255, 255, 255, 255), 1, VignetteOptions{Strength: 1, CenterX: 0.5, CenterY: 0.5})
+	check("vignette centre", got, 1, 0, color.RGBA{255, 255, 255, 255})
+	check("vignette bord", got, 0, 0, color.RGBA{138, 138, 138, 255})
+
+	// marche 100 | 120 entre x=2 et x=3 : le noyau donne -300 + 20 + 340 = 60 en x=2
+	// et -320 + 20 + 360 = 60 en x=3, ailleurs 0
+	step := uniformImage(6, 4, 100, 100, 100, 255)
+	for y := 0; y < 4; y++ {
+		for x := 3; x < 6; x++ {
+			step.SetRGBA(x, y, color.RGBA{120, 120, 120, 255})
+		}
+	}
+	got, _ = Emboss(step, 2, 1, "gray", Border{Mode: BorderMirror})
+	for x, v := range []uint8{128, 128, 188, 188, 128, 128} {
+		check("emboss gray", got, x, 1, color.RGBA{v, v, v, 255})
+	}
+	got, _ = Emboss(step, 2, 1, "color", Border{Mode: BorderMirror})
+	for x, v := range []uint8{100, 100, 160, 180, 120, 120} {
+		check("emboss color", got, x, 1, color.RGBA{v, v, v, 255})
+	}
+
+	// deux moitiés 40 | 200 : le lissage (sigmaR 10) garde la marche, deux niveaux par
+	// quantiles redonnent 40 et 200, la magnitude Sobel (640, saturée) trace les colonnes 2 et 3
+	halves := uniformImage(6, 4, 40, 40, 40, 255)
+	for y := 0; y < 4; y++ {
+		for x := 3; x < 6; x++ {
+			halves.SetRGBA(x, y, color.RGBA{200, 200, 200, 255})
+		}
+	}
+	opts := CartoonOptions{SigmaS: 1, SigmaR: 10, Levels: 2, Edge: 100, EdgeColor: color.RGBA{255, 0, 0, 255}}
+	got, _ = Cartoon(halves, 2, opts)
+	for x, v := range []color.RGBA{{40, 40, 40, 255}, {40, 40, 40, 255}, opts.EdgeColor, opts.EdgeColor, {200, 200, 200, 255}, {200, 200, 200, 255}} {
+		check("cartoon", got, x, 1, v)
+	}
+}
@@ -0,0 +1,61 @@
+// border_test.go
+package main
+
+import (
+	"image/color"
+	"testing"
+)
+
+func TestBorderIndex(t *testing.T) {
+	for _, mode := range []BorderMode{BorderClamp, BorderMirror, BorderWrap, BorderConstant} {
+		b := Border{Mode: mode}
+		for n := 1; n <= 5; n++ {
+			for i := -13; i < n+13; i++ {
+				if got, want := b.index(i, n), naiveBorderIndex(mode, i, n); got != want {
+					t.Errorf("mode %d, n=%d, i=%d : %d, attendu %d", mode, n, i, got, want)
+				}
+			}
+		}
+	}
+}
+
+func TestParseBorder(t *testing.T) {
+	cases := []struct {
+		params string
+		want   Border
+		err    bool
+	}{
+		{"", Border{BorderClamp, color.RGBA{0, 0, 0, 255}}, false},
+		{"border=Mirror", Border{BorderMirror, color.RGBA{0, 0, 0, 255}}, false},
+		{"border=wrap", Border{BorderWrap, color.RGBA{0, 0, 0, 255}}, false},
+		{"border=constant;bordercolor=#ff8000", Border{BorderConstant, color.RGBA{255, 128, 0, 255}}, false},
+		{"border=zero;bordercolor=1,2,3", Border{BorderConstant, color.RGBA{0, 0, 0, 255}}, false},
+		{"border=repeat", Border{}, true},
+		{"border=constant;bordercolor=bad", Border{}, true},
+		{"border=shrink", Border{}, true},
+	}
+	for _, c := range cases {
+		params, err := parseParams(c.params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := parseBorder(params)
+		if c.err {
+			if err == nil {
+				t.Errorf("%q : erreur attendue", c.params)
+			}
+			continue
+		}
+		if err != nil || got != c.want {
+			t.Errorf("%q : %+v (%v), attendu %+v", c.params, got, err, c.want)
+		}
+	}
+
+	// flou : fenêtre réduite à l'image sauf si un autre mode est demandé
+	for s, want := range map[string]BorderMode{"": BorderShrink, "border=Shrink": BorderShrink, "border=mirror": BorderMirror} {
+		params, _ := parseParams(s)
+		if got, err := parseBlurBorder(params); err != nil || got.Mode != want {
+			t.Errorf("flou %q : mode %d (%v), attendu %d", s, got.Mode, err, want)
+		}
+	}
+}
@@ -0,0 +1,302 @@
+// canny.go
+package main
+
+import (
+	"image"
+	"math"
+	"sync"
+)
+
+// CannyOptions : paramètres du détecteur de Canny
+type CannyOptions struct {
+	Sigma    float64 // écart-type du lissage gaussien (0 = pas de lissage)
+	Low      float64 // seuil bas de l'hystérésis (échelle de magnitude Sobel, 0..255)
+	High     float64 // seuil haut : au-dessus, le pixel est un contour sûr
+	Operator string  // opérateur de gradient (sobel, scharr, prewitt)
+}
+
+// gaussianKernel renvoie un noyau gaussien 1D normalisé de rayon ceil(3*sigma)
+func gaussianKernel(sigma float64) []float32 {
+	radius := int(math.Ceil(3 * sigma))
+	if radius < 1 {
+		radius = 1
+	}
+	k := make([]float32, 2*radius+1)
+	sum := 0.0
+	for i := -radius; i <= radius; i++ {
+		v := math.Exp(-float64(i*i) / (2 * sigma * sigma))
+		k[i+radius] = float32(v)
+		sum += v
+	}
+	for i := range k {
+		k[i] /= float32(sum)
+	}
+	return k
+}
+
+// gaussianPlane lisse un plan w*h avec un noyau gaussien séparable (deux passes en bandes).
+func gaussianPlane(plane []float32, wImg, hImg int, workers int, sigma float64, border Border, outside float32) []float32 {
+	k := gaussianKernel(sigma)
+	r := len(k) / 2
+	rect := image.Rect(0, 0, wImg, hImg)
+
+	// 1) Passe horizontale
+	tmp := make([]float32, wImg*hImg)
+	forBands(rect, workers, func(startY, endY int) {
+		for y := startY; y < endY; y++ {
+			row := plane[y*wImg : (y+1)*wImg]
+			for x := 0; x < wImg; x++ {
+				var sum float32
+				for i, kv := range k {
+					v := outside
+					if sx := border.index(x+i-r, wImg); sx >= 0 {
+						v = row[sx]
+					}
+					sum += kv * v
+				}
+				tmp[y*wImg+x] = sum
+			}
+		}
+	})
+
+	// 2) Passe verticale (lit toute la passe horizontale : pas de souci aux jointures des bandes)
+	out := make([]float32, wImg*hImg)
+	forBands(rect, workers, func(startY, endY int) {
+		for y := startY; y < endY; y++ {
+			for x := 0; x < wImg; x++ {
+				var sum float32
+				for i, kv := range k {
+					v := outside
+					if sy := border.index(y+i-r, hImg); sy >= 0 {
+						v = tmp[sy*wImg+x]
+					}
+					sum += kv * v
+				}
+				out[y*wImg+x] = sum
+			}
+		}
+	})
+	return out
+}
+
+// Canny détecte des contours fins : lissage gaussien, gradient (étape Sobel),
+// suppression des non-maxima puis seuillage par hystérésis.
+// Chaque étape est parallèle par bandes ; l'hystérésis propage ensuite les
+// contours d'une bande à l'autre à travers les jointures jusqu'à stabilité.
+func Canny(img image.Image, workers int, border Border, opts CannyOptions) (*image.RGBA, error) {
+	kx, ky, scale, err := edgeKernels(opts.Operator)
+	if err != nil {
+		return nil, err
+	}
+	if opts.High < opts.Low {
+		opts.Low, opts.High = opts.High, opts.Low
+	}
+
+	src := toRGBA(img)
+	bounds := src.Bounds()
+	wImg := bounds.Dx()
+	hImg := bounds.Dy()
+	rect := image.Rect(0, 0, wImg, hImg)
+	outside := luma(float32(border.Color.R), float32(border.Color.G), float32(border.Color.B))
+
+	// 1) Luminance + lissage gaussien
+	lum := lumaPlane(src, workers)
+	if opts.Sigma > 0 {
+		lum = gaussianPlane(lum, wImg, hImg, workers, opts.Sigma, border, outside)
+	}
+
+	// 2) Gradient (mêmes noyaux que le filtre sobel)
+	gxs, gys := gradientPlanes(lum, wImg, hImg, workers, border, outside, kx, ky)
+
+	mag := make([]float32, wImg*hImg)
+	forBands(rect, workers, func(startY, endY int) {
+		for i := startY * wImg; i < endY*wImg; i++ {
+			mag[i] = float32(math.Hypot(float64(gxs[i]), float64(gys[i]))) * scale
+		}
+	})
+
+	// 3) Suppression des non-maxima : on garde un pixel seulement s'il est maximal
+	// le long de la direction du gradient. 0 = rien, 1 = faible, 2 = fort.
+	at := func(x, y int) float32 {
+		if x < 0 || x >= wImg || y < 0 || y >= hImg {
+			return 0
+		}
+		return mag[y*wImg+x]
+	}
+
+	state := make([]uint8, wImg*hImg)
+	forBands(rect, workers, func(startY, endY int) {
+		for y := startY; y < endY; y++ {
+			for x := 0; x < wImg; x++ {
+				i := y*wImg + x
+				m := mag[i]
+				if float64(m) < opts.Low {
+					continue
+				}
+
+				// gy est orienté vers le haut : direction image = (gx, -gy)
+				angle := math.Atan2(-float64(gys[i]), float64(gxs[i])) * 180 / math.Pi
+				if angle < 0 {
+					angle += 180
+				}
+
+				var a, b float32
+				switch {
+				case angle < 22.5 || angle >= 157.5:
+					a, b = at(x-1, y), at(x+1, y)
+				case angle < 67.5:
+					a, b = at(x-1, y-1), at(x+1, y+1)
+				case angle < 112.5:
+					a, b = at(x, y-1), at(x, y+1)
+				default:
+					a, b = at(x+1, y-1), at(x-1, y+1)
+				}
+				// égalité : on ne garde qu'un des deux pixels pour rester sur 1 pixel d'épaisseur
+				if m <= a || m < b {
+					continue
+				}
+
+				if float64(m) >= opts.High {
+					state[i] = 2
+				} else {
+					state[i] = 1
+				}
+			}
+		}
+	})
+
+	// 4) Hystérésis : un pixel faible devient contour s'il est relié (8-connexité)
+	// à un pixel fort.
+	w, block, _ := splitWorkers(rect, workers)
+	bands := make([][2]int, w)
+	for i := range bands {
+		bands[i] = [2]int{i * block, (i + 1) * block}
+	}
+	if w > 0 {
+		bands[w-1][1] = hImg
+	}
+
+	// edge[i] = pixel retenu comme contour
+	edge := make([]bool, wImg*hImg)
+
+	// fill propage depuis les graines, sans sortir de la bande [startY, endY)
+	fill := func(seeds []int, startY, endY int) {
+		stack := seeds
+		for len(stack) > 0 {
+			i := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if edge[i] {
+				continue
+			}
+			edge[i] = true
+
+			x, y := i%wImg, i/wImg
+			for dy := -1; dy <= 1; dy++ {
+				ny := y + dy
+				if ny < startY || ny >= endY {
+					continue
+				}
+				for dx := -1; dx <= 1; dx++ {
+					nx := x + dx
+					if nx < 0 || nx >= wImg {
+						continue
+					}
+					j := ny*wImg + nx
+					if state[j] != 0 && !edge[j] {
+						stack = append(stack, j)
+					}
+				}
+			}
+		}
+	}
+
+	runBands := func(fn func(b int)) {
+		var wg sync.WaitGroup
+		for b := range bands {
+			wg.Add(1)
+			go func(b int) {
+				defer wg.Done()
+				fn(b)
+			}(b)
+		}
+		wg.Wait()
+	}
+
+	// a) propagation dans chaque bande depuis ses pixels forts
+	runBands(func(b int) {
+		startY, endY := bands[b][0], bands[b][1]
+		var seeds []int
+		for i := startY * wImg; i < endY*wImg; i++ {
+			if state[i] == 2 {
+				seeds = append(seeds, i)
+			}
+		}
+		fill(seeds, startY, endY)
+	})
+
+	// b) jointures : un pixel faible du bord d'une bande voisin d'un contour de la bande
+	// d'à côté devient graine. On collecte toutes les graines (lecture seule) puis on
+	// propage (chaque bande n'écrit que chez elle), jusqu'à ce qu'il n'y en ait plus.
+	seamSeeds := func(y, otherY int) []int {
+		var seeds []int
+		for x := 0; x < wImg; x++ {
+			i := y*wImg + x
+			if state[i] == 0 || edge[i] {
+				continue
+			}
+			for dx := -1; dx <= 1; dx++ {
+				nx := x + dx
+				if nx >= 0 && nx < wImg && edge[otherY*wImg+nx] {
+					seeds = append(seeds, i)
+					break
+				}
+			}
+		}
+		return seeds
+	}
+
+	for {
+		seeds := make([][]int, len(bands))
+		found := false
+		for b := range bands {
+			startY, endY := bands[b][0], bands[b][1]
+			if b > 0 {
+				seeds[b] = append(seeds[b], seamSeeds(startY, startY-1)...)
+			}
+			if b < len(bands)-1 {
+				seeds[b] = append(seeds[b], seamSeeds(endY-1, endY)...)
+			}
+			if len(seeds[b]) > 0 {
+				found = true
+			}
+		}
+		if !found {
+			break
+		}
+
+		runBands(func(b int) {
+			fill(seeds[b], bands[b][0], bands[b][1])
+		})
+	}
+
+	// 5) Sortie : contours blancs sur fond noir
+	out := image.NewRGBA(bounds)
+	forBands(bounds, workers, func(startY, endY int) {
+		for y := startY; y < endY; y++ {
+			di := out.PixOffset(bounds.Min.X, y)
+			row := edge[(y-bounds.Min.Y)*wImg:]
+			for x := 0; x < wImg; x++ {
+				var v uint8
+				if row[x] {
+					v = 255
+				}
+				out.Pix[di+0] = v
+				out.Pix[di+1] = v
+				out.Pix[di+2] = v
+				out.Pix[di+3] = 255
+				di += 4
+			}
+		}
+	})
+	return out, nil
+}
@@ -0,0 +1,142 @@
+// canny_test.go
+package main
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+func TestGaussianKernel(t *testing.T) {
+	for _, sigma := range []float64{0.3, 1, 1.4, 2.5} {
+		k := gaussianKernel(sigma)
+		if r := max(int(math.Ceil(3*sigma)), 1); len(k) != 2*r+1 {
+			t.Fatalf("sigma %g : %d coefficients, attendu %d", sigma, len(k), 2*r+1)
+		}
+		sum := float32(0)
+		for i, v := range k {
+			sum += v
+			if v != k[len(k)-1-i] || (i > 0 && i <= len(k)/2 && v < k[i-1]) {
+				t.Fatalf("sigma %g : noyau %v non symétrique ou non croissant vers le centre", sigma, k)
+			}
+		}
+		if math.Abs(float64(sum)-1) > 1e-5 {
+			t.Errorf("sigma %g : somme %g", sigma, sum)
+		}
+	}
+
+	// sigma 1 : exp(-i²/2) pour i = 0..3, divisé par leur somme 2.50596
+	k := gaussianKernel(1)
+	for i, want := range []float64{0.00443, 0.05401, 0.24204, 0.39905, 0.24204, 0.05401, 0.00443} {
+		if math.Abs(float64(k[i])-want) > 1e-5 {
+			t.Errorf("sigma 1 : k[%d] = %g, attendu %g", i, k[i], want)
+		}
+	}
+}
+
+// stepImage : bord vertical entre x=9 et x=10 ; contraste 40 en haut, qui descend de 2 par
+// ligne jusqu'à 10 (pas de bord horizontal : le gradient vertical reste sous le seuil bas)
+func stepImage() *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, 20, 60))
+	for y := 0; y < 60; y++ {
+		d := uint8(max(40-2*y, 10))
+		for x := 0; x < 20; x++ {
+			v := uint8(100)
+			if x >= 10 {
+				v += d
+			}
+			img.SetRGBA(x, y, color.RGBA{v, v, v, 255})
+		}
+	}
+	return img
+}
+
+// TestCannyHysteresisAcrossBands : le contour faible n'est gardé que parce qu'il touche la
+// partie forte, en haut ; il doit être suivi à travers toutes les jointures de bandes.
+func TestCannyHysteresisAcrossBands(t *testing.T) {
+	src := stepImage()
+	for _, workers := range []int{1, 3, 8, 60} {
+		// magnitude Sobel : 4 x contraste, de 160 en haut à 40 (fort jusqu'à la ligne 7)
+		out, err := Canny(src, workers, Border{}, CannyOptions{Low: 20, High: 100, Operator: "sobel"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		// un seul pixel de contour par ligne, en colonne 9 ou 10
+		for y := 0; y < 60; y++ {
+			var cols []int
+			for x := 0; x < 20; x++ {
+				if out.RGBAAt(x, y).R == 255 {
+					cols = append(cols, x)
+				}
+			}
+			if len(cols) != 1 || cols[0] < 9 || cols[0] > 10 {
+				t.Fatalf("%d workers : ligne %d, contour en %v", workers, y, cols)
+			}
+		}
+
+		// sans partie forte, rien n'est gardé
+		out, _ = Canny(src, workers, Border{}, CannyOptions{Low: 20, High: 200, Operator: "sobel"})
+		for i := 0; i < len(out.Pix); i += 4 {
+			if out.Pix[i] != 0 {
+				t.Fatalf("%d workers : contour sans pixel fort", workers)
+			}
+		}
+	}
+}
+
+// TestCannyWorkers : le résultat ne dépend pas du découpage en bandes
+func TestCannyWorkers(t *testing.T) {
+	src := randomImage(47, 53, 23)
+	for _, operator := range []string{"sobel", "scharr", "prewitt"} {
+		opts := CannyOptions{Sigma: 1.2, Low: 10, High: 30, Operator: operator}
+		want, err := Canny(src, 1, Border{Mode: BorderMirror}, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, workers := range []int{2, 5, 16} {
+			got, _ := Canny(src, workers, Border{Mode: BorderMirror}, opts)
+			assertSame(t, got, want)
+		}
+	}
+}
+
+// TestCannyHandValues : marche verticale de 50 entre x=4 et x=5, sans lissage. Les colonnes
+// 4 et 5 ont la même magnitude Sobel (4 x 50 = 200) ; l'égalité garde la colonne 4 seule.
+func TestCannyHandValues(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 10, 8))
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 10; x++ {
+			v := uint8(100)
+			if x >= 5 {
+				v = 150
+			}
+			src.SetRGBA(x, y, color.RGBA{v, v, v, 255})
+		}
+	}
+	for _, c := range []struct {
+		low, high float64
+		col       int // colonne du contour, -1 = aucun
+	}{
+		{20, 100, 4},
+		{20, 200, 4}, // magnitude = seuil haut : pixel fort
+		{20, 201, -1},
+		{201, 250, -1},
+	} {
+		out, err := Canny(src, 3, Border{Mode: BorderClamp}, CannyOptions{Low: c.low, High: c.high, Operator: "sobel"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for y := 0; y < 8; y++ {
+			for x := 0; x < 10; x++ {
+				want := uint8(0)
+				if x == c.col {
+					want = 255
+				}
+				if got := out.RGBAAt(x, y); got != (color.RGBA{want, want, want, 255}) {
+					t.Fatalf("seuils %g/%g : (%d, %d) = %v, attendu %d", c.low, c.high, x, y, got, want)
+				}
+			}
+		}
+	}
+}
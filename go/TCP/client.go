@@ -2,9 +2,12 @@ package main
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/binary"
+	"encoding/json"
 	"fmt"
 	"io"
+	"math"
 	"net"
 	"os"
 	"path/filepath"
@@ -19,14 +22,40 @@ type filterInfo struct {
 }
 
 var filters = []filterInfo{
-	{"grayscale", "Convertit l'image en niveaux de gris."},
+	{"grayscale", "Convertit l'image en niveaux de gris (Rec.601, Rec.709, moyenne, ...)."},
 	{"blur", "Flou simple (box blur). Plus le rayon est grand, plus c'est flou."},
-	{"sobel", "Détection de contours (edges) en noir et blanc."},
-	{"median", "Filtre médian 3x3 (réduit le bruit type 'sel et poivre')."},
+	{"sobel", "Détection de contours (Sobel, Scharr, Prewitt), magnitude, direction ou seuil."},
+	{"canny", "Contours fins de Canny (lissage, gradient, non-maxima, hystérésis)."},
+	{"median", "Filtre médian (réduit le bruit type 'sel et poivre'), rayon et percentile réglables."},
 	{"pixelate", "Effet mosaïque (gros pixels)."},
 	{"posterizequantilescolor", "Posterisation par quantiles sur les couleurs."},
+	{"convolve", "Convolution avec un noyau personnalisé (diviseur, biais, gestion des bords)."},
+	{"equalize", "Égalisation d'histogramme globale (contraste des images délavées)."},
+	{"clahe", "Égalisation adaptative par tuiles (CLAHE), contraste limité."},
+	{"resize", "Redimensionne l'image (nearest, bilinear, bicubic, lanczos)."},
+	{"crop", "Recadre l'image sur un rectangle."},
+	{"rotate", "Rotation (90/180/270 exacte, ou angle quelconque avec couleur de fond)."},
+	{"flip", "Miroir horizontal, vertical ou les deux."},
+	{"quantize", "Réduction à une palette (median-cut, octree, k-means), tramage, export de la palette."},
+	{"dither", "Tramage sur une palette (Floyd–Steinberg, Atkinson, Jarvis, Bayer, bruit bleu), ex. e-ink 1 bit."},
+	{"denoise", "Débruitage qui garde les contours (filtre bilatéral ou guidé)."},
+	{"sharpen", "Netteté : masque flou (unsharp), passe-haut ou laplacien."},
+	{"threshold", "Binarisation noir et blanc (seuil fixe, Otsu, adaptatif moyenne/gaussien, Sauvola)."},
+	{"morphology", "Morphologie : érosion, dilatation, ouverture, fermeture, gradient, top-hat."},
+	{"adjust", "Corrections tonales : luminosité, contraste, gamma, niveaux, courbes, teinte/saturation (TSL, TSV)."},
+	{"artistic", "Effets artistiques : sépia, vignettage, relief (emboss), dessin animé (cartoon)."},
+	{"stats", "Statistiques (histogrammes, moyenne, écart-type, entropie, quantiles) en JSON."},
 }
 
+var grayModes = []string{"rec601", "rec709", "average", "lightness", "red", "green", "blue", "linear"}
+
+var blendModes = []string{"normal", "multiply", "screen", "overlay"}
+
+var borderModes = []string{"clamp", "mirror", "wrap", "constant"}
+
+// flou : fenêtre réduite à l'image par défaut, ou un des modes communs
+var blurBorderModes = append([]string{"shrink"}, borderModes...)
+
 func main() {
 
 	// choix du fichier d'entrée : argument obligatoire
@@ -56,13 +85,87 @@ func main() {
 	filterName := askFilter(reader)
 
 	radius := 0
+	params := ""
 	switch filterName {
+	case "grayscale":
+		params = "mode=" + askChoice(reader, "Formule de gris", grayModes)
 	case "blur":
 		radius = askInt(reader, "Choisis l'intensité du flou (radius >= 1) : ", 1, 999)
+		params = askBorderOf(reader, blurBorderModes) + ";" + askLinear(reader)
+	case "sobel":
+		params = askSobel(reader)
+	case "canny":
+		params = askCanny(reader)
+	case "median":
+		radius = askInt(reader, "Choisis le rayon du filtre (radius >= 1, 1 = 3x3) : ", 1, 999)
+		percentile := askInt(reader, "Choisis le percentile (0 = min, 50 = médiane, 100 = max) : ", 0, 100)
+		params = fmt.Sprintf("percentile=%d;%s", percentile, askBorder(reader))
 	case "pixelate":
 		radius = askInt(reader, "Choisis la taille des blocs mosaïque (block >= 2) : ", 2, 999)
+		params = askLinear(reader)
 	case "posterizequantilescolor":
 		radius = askInt(reader, "Choisis le nombre de niveaux de couleur (levels >= 2) : ", 2, 256)
+	case "convolve":
+		params = askConvolve(reader)
+	case "equalize":
+		params = "mode=" + askChoice(reader, "Canaux égalisés", []string{"luma", "rgb"})
+	case "clahe":
+		mode := askChoice(reader, "Canaux égalisés", []string{"luma", "rgb"})
+		tiles := askInt(reader, "Grille de tuiles (N x N, 1..64) : ", 1, 64)
+		params = fmt.Sprintf("mode=%s;tiles=%d", mode, tiles)
+		if clip := askLine(reader, "Limite d'écrêtage (x moyenne, vide = 2, 0 = aucune) : "); clip != "" {
+			params += ";clip=" + clip
+		}
+	case "resize":
+		params = askResize(reader)
+	case "crop":
+		params = askCrop(reader)
+	case "rotate":
+		params = askRotate(reader)
+	case "flip":
+		params = "direction=" + askChoice(reader, "Direction", []string{"horizontal", "vertical", "both"})
+	case "quantize":
+		params = askQuantize(reader)
+	case "dither":
+		params = askDither(reader)
+	case "denoise":
+		filterName, radius, params = askDenoise(reader)
+	case "sharpen":
+		filterName, radius, params = askSharpen(reader)
+	case "threshold":
+		params = askThreshold(reader)
+	case "morphology":
+		filterName, radius, params = askMorphology(reader)
+	case "adjust":
+		filterName, params = askAdjust(reader)
+	case "artistic":
+		filterName, params = askArtistic(reader)
+	case "stats":
+		levels := askInt(reader, "Nombre de niveaux pour les quantiles (levels >= 2) : ", 2, 256)
+		params = fmt.Sprintf("levels=%d", levels)
+	}
+
+	// zone d'application (pas pour les transformations qui changent la taille,
+	// ni pour les réponses JSON)
+	paletteOnly := filterName == "quantize" && strings.Contains(params, "output=palette")
+	var mask []byte
+	switch {
+	case filterName == "resize", filterName == "crop", filterName == "rotate", filterName == "stats", paletteOnly:
+	default:
+		var region string
+		region, mask = askRegion(reader)
+		if region != "" {
+			params = strings.TrimPrefix(params+";"+region, ";")
+		}
+	}
+
+	// PNG 16 bits : le serveur réduit à 8 bits par canal pour les filtres qui n'existent
+	// qu'en 8 bits, sauf si on préfère un refus
+	if is16BitPNG(imgBytes) && filterName != "stats" && !paletteOnly {
+		fmt.Println("\nImage 16 bits par canal : certains filtres n'existent qu'en 8 bits.")
+		if askChoice(reader, "Si le filtre n'existe pas en 16 bits", []string{"réduire à 8 bits", "refuser"}) == "refuser" {
+			params = strings.TrimPrefix(params+";strict16=true", ";")
+		}
 	}
 
 	workers := askWorkers(reader)
@@ -74,7 +177,7 @@ func main() {
 	}
 	defer conn.Close()
 
-	if err := sendRequest(conn, filterName, radius, workers, imgBytes); err != nil {
+	if err := sendRequest(conn, filterName, radius, workers, params, imgBytes, mask); err != nil {
 		panic(err)
 	}
 
@@ -88,8 +191,18 @@ func main() {
 	if ext == "" {
 		ext = ".png" // fallback si le fichier n'a pas d'extension
 	}
-
 	base := strings.TrimSuffix(filepath.Base(inPath), ext)
+
+	// stats : le serveur renvoie du JSON, pas une image
+	if filterName == "stats" {
+		saveStats(respImg, fmt.Sprintf("%s_stats.json", base))
+		return
+	}
+	if paletteOnly {
+		savePalette(respImg, fmt.Sprintf("%s_palette.json", base))
+		return
+	}
+
 	outName := fmt.Sprintf("%s_output_%s%s", base, filterName, ext)
 
 	if err := os.WriteFile(outName, respImg, 0644); err != nil {
@@ -99,6 +212,81 @@ func main() {
 	fmt.Printf("\nImage reçue et sauvegardée : %s\n", outName)
 }
 
+// is16BitPNG indique si le fichier est un PNG à 16 bits par canal (profondeur lue dans
+// l'en-tête IHDR)
+func is16BitPNG(data []byte) bool {
+	return len(data) > 24 && bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")) && data[24] == 16
+}
+
+// saveStats affiche un résumé des statistiques et enregistre le JSON complet (indenté)
+func saveStats(data []byte, outName string) {
+	var st struct {
+		Width, Height int
+		Levels        int
+		Red, Green    channelSummary
+		Blue, Luma    channelSummary
+	}
+	if err := json.Unmarshal(data, &st); err != nil {
+		panic(err)
+	}
+
+	fmt.Printf("\nImage %dx%d\n", st.Width, st.Height)
+	fmt.Printf("%-6s %4s %4s %8s %8s %8s\n", "canal", "min", "max", "moyenne", "écart", "entropie")
+	for _, c := range []struct {
+		name string
+		s    channelSummary
+	}{{"R", st.Red}, {"G", st.Green}, {"B", st.Blue}, {"luma", st.Luma}} {
+		fmt.Printf("%-6s %4d %4d %8.2f %8.2f %8.3f\n", c.name, c.s.Min, c.s.Max, c.s.Mean, c.s.StdDev, c.s.Entropy)
+	}
+	fmt.Printf("\nQuantiles luma (%d niveaux) :\n", st.Levels)
+	for _, q := range st.Luma.Quantiles {
+		fmt.Printf("  %3d..%3d -> %3d\n", q.Min, q.Max, q.Value)
+	}
+
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, data, "", "  "); err != nil {
+		panic(err)
+	}
+	if err := os.WriteFile(outName, buf.Bytes(), 0644); err != nil {
+		panic(err)
+	}
+	fmt.Printf("\nStatistiques sauvegardées : %s\n", outName)
+}
+
+// savePalette affiche la palette renvoyée par quantize (output=palette) et l'enregistre
+func savePalette(data []byte, outName string) {
+	var info struct {
+		Method, Space string
+		Colors        []struct{ Hex string }
+	}
+	if err := json.Unmarshal(data, &info); err != nil {
+		panic(err)
+	}
+
+	fmt.Printf("\nPalette %s (%s), %d couleurs :\n", info.Method, info.Space, len(info.Colors))
+	for i, c := range info.Colors {
+		fmt.Printf("  %3d  %s\n", i, c.Hex)
+	}
+
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, data, "", "  "); err != nil {
+		panic(err)
+	}
+	if err := os.WriteFile(outName, buf.Bytes(), 0644); err != nil {
+		panic(err)
+	}
+	fmt.Printf("\nPalette sauvegardée : %s\n", outName)
+}
+
+// channelSummary : champs de ChannelStats (serveur) affichés par le client
+type channelSummary struct {
+	Min, Max  int
+	Mean      float64
+	StdDev    float64
+	Entropy   float64
+	Quantiles []struct{ Min, Max, Value int }
+}
+
 // Saisie utilisateur
 func askServer(r *bufio.Reader) string {
 	for {
@@ -137,6 +325,346 @@ func askFilter(r *bufio.Reader) string {
 	}
 }
 
+// askConvolve demande le noyau et ses options, renvoie les paramètres "cle=valeur;..."
+func askConvolve(r *bufio.Reader) string {
+	fmt.Println("\nNoyau : lignes séparées par '|', valeurs par ','")
+	fmt.Println("  ex. netteté : 0,-1,0|-1,5,-1|0,-1,0")
+	kernel := ""
+	for kernel == "" {
+		kernel = askLine(r, "Noyau : ")
+	}
+	params := "kernel=" + kernel
+
+	if d := askLine(r, "Diviseur (vide = somme du noyau) : "); d != "" {
+		params += ";divisor=" + d
+	}
+	if b := askLine(r, "Biais ajouté après division (vide = 0) : "); b != "" {
+		params += ";bias=" + b
+	}
+	return params + ";" + askBorder(r) + ";" + askLinear(r)
+}
+
+// askSobel demande l'opérateur, le type de sortie et le seuil du détecteur de contours
+func askSobel(r *bufio.Reader) string {
+	operator := askChoice(r, "Opérateur", []string{"sobel", "scharr", "prewitt"})
+	output := askChoice(r, "Sortie", []string{"magnitude", "direction"})
+	threshold := askInt(r, "Seuil binaire (0 = pas de seuil, 1..255) : ", 0, 255)
+	return fmt.Sprintf("operator=%s;output=%s;threshold=%d;%s", operator, output, threshold, askBorder(r))
+}
+
+// askCanny demande le lissage et les seuils bas/haut de l'hystérésis
+func askCanny(r *bufio.Reader) string {
+	params := "operator=" + askChoice(r, "Opérateur de gradient", []string{"sobel", "scharr", "prewitt"})
+	if s := askLine(r, "Sigma du lissage gaussien (vide = 1.4, 0 = aucun) : "); s != "" {
+		params += ";sigma=" + s
+	}
+	low := askInt(r, "Seuil bas (0..255) : ", 0, 255)
+	high := askInt(r, "Seuil haut (>= seuil bas, 0..255) : ", low, 255)
+	return fmt.Sprintf("%s;low=%d;high=%d;%s", params, low, high, askBorder(r))
+}
+
+// askResize demande la taille de sortie (facteur ou largeur/hauteur) et la méthode
+func askResize(r *bufio.Reader) string {
+	method := askChoice(r, "Méthode de rééchantillonnage", []string{"nearest", "bilinear", "bicubic", "lanczos"})
+	if s := askLine(r, "Facteur d'échelle (ex. 0.5, vide = largeur/hauteur) : "); s != "" {
+		return fmt.Sprintf("method=%s;scale=%s", method, s)
+	}
+	width := askInt(r, "Largeur (0 = selon la hauteur) : ", 0, 16384)
+	height := askInt(r, "Hauteur (0 = selon la largeur) : ", 0, 16384)
+	return fmt.Sprintf("method=%s;width=%d;height=%d", method, width, height)
+}
+
+// askCrop demande le rectangle à garder (coin haut-gauche + taille)
+func askCrop(r *bufio.Reader) string {
+	x := askInt(r, "x du coin haut-gauche : ", 0, 1<<20)
+	y := askInt(r, "y du coin haut-gauche : ", 0, 1<<20)
+	width := askInt(r, "Largeur : ", 1, 1<<20)
+	height := askInt(r, "Hauteur : ", 1, 1<<20)
+	return fmt.Sprintf("x=%d;y=%d;width=%d;height=%d", x, y, width, height)
+}
+
+// askRotate demande l'angle et, pour un angle quelconque, la couleur de fond
+func askRotate(r *bufio.Reader) string {
+	angle := askLine(r, "Angle en degrés, sens horaire (vide = 90) : ")
+	if angle == "" {
+		angle = "90"
+	}
+	params := "angle=" + angle
+	if a, err := strconv.ParseFloat(angle, 64); err == nil && math.Mod(a, 90) == 0 {
+		return params
+	}
+	if c := askLine(r, "Couleur de fond (r,g,b, #rrggbb ou transparent, vide = noir) : "); c != "" {
+		params += ";background=" + c
+	}
+	return params
+}
+
+// askQuantize demande la méthode, la taille de palette, l'espace des distances, le tramage
+// et ce que le serveur renvoie (image quantifiée ou palette en JSON)
+func askQuantize(r *bufio.Reader) string {
+	method := askChoice(r, "Méthode", []string{"mediancut", "octree", "kmeans"})
+	colors := askInt(r, "Nombre de couleurs (2..256) : ", 2, 256)
+	space := askChoice(r, "Distance entre couleurs", []string{"rgb", "lab"})
+	params := fmt.Sprintf("method=%s;colors=%d;space=%s", method, colors, space)
+	if askChoice(r, "Résultat", []string{"image", "palette (JSON)"}) != "image" {
+		return params + ";output=palette"
+	}
+	return params + ";dither=" + askChoice(r, "Tramage", []string{"none", "floyd", "atkinson", "jarvis", "ordered", "bluenoise"})
+}
+
+// askDither demande la méthode de tramage et la palette de sortie
+func askDither(r *bufio.Reader) string {
+	method := askChoice(r, "Méthode", []string{"floyd", "atkinson", "jarvis", "bayer2", "bayer4", "bayer8", "bluenoise"})
+	palette := askChoice(r, "Palette", []string{"bw", "gray4", "gray16", "adaptive", "personnalisée"})
+	switch palette {
+	case "adaptive":
+		colors := askInt(r, "Nombre de couleurs (2..256) : ", 2, 256)
+		return fmt.Sprintf("method=%s;palette=adaptive;colors=%d", method, colors)
+	case "personnalisée":
+		fmt.Println("\nCouleurs séparées par '|' (r,g,b ou #rrggbb), ex. #000000|#ff0000|#ffffff")
+		palette = ""
+		for palette == "" {
+			palette = askLine(r, "Palette : ")
+		}
+	}
+	return fmt.Sprintf("method=%s;palette=%s", method, palette)
+}
+
+// askDenoise demande le filtre de débruitage (le nom du filtre envoyé) et ses réglages
+func askDenoise(r *bufio.Reader) (string, int, string) {
+	name := askChoice(r, "Filtre", []string{"bilateral", "guided"})
+	if name == "guided" {
+		radius := askInt(r, "Rayon de la fenêtre (radius >= 1) : ", 1, 999)
+		if eps := askLine(r, "eps, lissage (0..1, vide = 0.01) : "); eps != "" {
+			return name, radius, "eps=" + eps
+		}
+		return name, radius, ""
+	}
+
+	params := []string{}
+	if s := askLine(r, "Sigma spatial en pixels (vide = 3) : "); s != "" {
+		params = append(params, "sigmas="+s)
+	}
+	if s := askLine(r, "Sigma des couleurs, écart 0..255 (vide = 25) : "); s != "" {
+		params = append(params, "sigmar="+s)
+	}
+	return name, 0, strings.Join(params, ";")
+}
+
+// askSharpen demande la méthode de netteté (le nom du filtre envoyé), le rayon du flou
+// et la force
+func askSharpen(r *bufio.Reader) (string, int, string) {
+	method := askChoice(r, "Méthode", []string{"unsharp (masque flou)", "highpass (passe-haut)", "sharpen (laplacien)"})
+	name, _, _ := strings.Cut(method, " ")
+
+	radius := 0
+	if name != "sharpen" {
+		radius = askInt(r, "Rayon du flou (radius >= 1) : ", 1, 999)
+	}
+	params := "amount=" + askLine(r, "Force (vide = 1) : ")
+	switch name {
+	case "unsharp":
+		params += fmt.Sprintf(";threshold=%d", askInt(r, "Seuil (écart minimal 0..255, 0 = partout) : ", 0, 255))
+	case "sharpen":
+		params += ";neighbours=" + askChoice(r, "Voisins du laplacien", []string{"4", "8"})
+	}
+	return name, radius, params + ";" + askBorder(r)
+}
+
+// askThreshold demande la méthode de binarisation et ses réglages
+func askThreshold(r *bufio.Reader) string {
+	method := askChoice(r, "Méthode", []string{"otsu", "fixed", "mean", "gaussian", "sauvola"})
+	params := "method=" + method
+	switch method {
+	case "fixed":
+		params += fmt.Sprintf(";threshold=%d", askInt(r, "Seuil (0..255) : ", 0, 255))
+	case "mean", "gaussian", "sauvola":
+		block := 0
+		for block%2 == 0 {
+			block = askInt(r, "Taille du bloc (impair, >= 3) : ", 3, 999)
+		}
+		params += fmt.Sprintf(";block=%d", block)
+		if method == "sauvola" {
+			if k := askLine(r, "k (vide = 0.2) : "); k != "" {
+				params += ";k=" + k
+			}
+		} else if c := askLine(r, "Constante C retirée à la moyenne (vide = 5) : "); c != "" {
+			params += ";c=" + c
+		}
+	}
+	invert := askChoice(r, "Sortie", []string{"texte noir sur blanc", "inversée (blanc sur noir)"})
+	return fmt.Sprintf("%s;invert=%t", params, invert != "texte noir sur blanc")
+}
+
+// askMorphology demande l'opération (le nom du filtre envoyé), l'élément structurant
+// et les plans traités
+func askMorphology(r *bufio.Reader) (string, int, string) {
+	op := askChoice(r, "Opération", []string{"erode", "dilate", "open", "close", "gradient", "tophat", "blackhat"})
+	shape := askChoice(r, "Élément structurant", []string{"square", "disk", "cross", "custom"})
+
+	radius := 0
+	params := "shape=" + shape
+	if shape == "custom" {
+		fmt.Println("\nÉlément : lignes séparées par '|', valeurs 0/1 par ',' (origine au centre)")
+		fmt.Println("  ex. 0,1,0|1,1,1|0,1,0")
+		element := ""
+		for element == "" {
+			element = askLine(r, "Élément : ")
+		}
+		params += ";element=" + element
+	} else {
+		radius = askInt(r, "Rayon de l'élément (radius >= 1, 1 = 3x3) : ", 1, 999)
+	}
+	mode := askChoice(r, "Plans traités", []string{"luma (sortie en gris)", "rgb"})
+	mode, _, _ = strings.Cut(mode, " ")
+	return op, radius, params + ";mode=" + mode
+}
+
+// askAdjust demande la correction tonale (le nom du filtre envoyé) et ses réglages
+func askAdjust(r *bufio.Reader) (string, string) {
+	name := askChoice(r, "Correction", []string{"brightness", "contrast", "gamma", "levels", "curves", "hsl", "hsv"})
+	switch name {
+	case "brightness":
+		return name, "amount=" + askLine(r, "Décalage (-255..255) : ")
+	case "contrast":
+		return name, "amount=" + askLine(r, "Contraste en % (-100..., 0 = inchangé) : ")
+	case "gamma":
+		return name, "gamma=" + askLine(r, "Gamma (> 0, > 1 éclaircit) : ")
+	case "levels":
+		channel := askChoice(r, "Canal", []string{"rgb", "red", "green", "blue"})
+		black := askInt(r, "Point noir (0..254) : ", 0, 254)
+		white := askInt(r, "Point blanc (> noir, ..255) : ", black+1, 255)
+		params := fmt.Sprintf("channel=%s;black=%d;white=%d", channel, black, white)
+		if mid := askLine(r, "Gamma des tons moyens (vide = 1) : "); mid != "" {
+			params += ";mid=" + mid
+		}
+		return name, params
+	case "curves":
+		fmt.Println("\nPoints de contrôle entrée,sortie (0..255) séparés par '|', ex. 0,0|64,40|192,220|255,255")
+		var params []string
+		for _, channel := range []string{"rgb", "red", "green", "blue"} {
+			if points := askLine(r, fmt.Sprintf("Courbe %s (vide = aucune) : ", channel)); points != "" {
+				params = append(params, channel+"="+points)
+			}
+		}
+		return name, strings.Join(params, ";")
+	}
+
+	hue := askLine(r, "Décalage de teinte en degrés (vide = 0) : ")
+	saturation := askLine(r, "Saturation en % (-100 = gris, +100 = double, vide = 0) : ")
+	light := "lightness"
+	if name == "hsv" {
+		light = "value"
+	}
+	lightness := askLine(r, fmt.Sprintf("%s en %% (-100..100, vide = 0) : ", light))
+	return name, fmt.Sprintf("hue=%s;saturation=%s;%s=%s", hue, saturation, light, lightness)
+}
+
+// askArtistic demande l'effet (le nom du filtre envoyé) et ses réglages
+func askArtistic(r *bufio.Reader) (string, string) {
+	name := askChoice(r, "Effet", []string{"sepia", "vignette", "emboss", "cartoon"})
+	switch name {
+	case "sepia":
+		return name, "amount=" + askLine(r, "Intensité (0..1, vide = 1) : ")
+	case "vignette":
+		strength := askLine(r, "Force de l'assombrissement (0..1, vide = 0.6) : ")
+		radius := askLine(r, "Rayon intact autour du centre (0..1, vide = 0.4) : ")
+		center := askLine(r, "Centre x,y en fraction de l'image (vide = 0.5,0.5) : ")
+		params := fmt.Sprintf("strength=%s;radius=%s", strength, radius)
+		if cx, cy, ok := strings.Cut(center, ","); ok {
+			params += fmt.Sprintf(";cx=%s;cy=%s", strings.TrimSpace(cx), strings.TrimSpace(cy))
+		}
+		return name, params
+	case "emboss":
+		mode := askChoice(r, "Sortie", []string{"gray", "color"})
+		amount := askLine(r, "Force du relief (vide = 1) : ")
+		return name, fmt.Sprintf("mode=%s;amount=%s;%s", mode, amount, askBorder(r))
+	}
+
+	levels := askInt(r, "Niveaux de couleur par canal (levels >= 2) : ", 2, 256)
+	edge := askInt(r, "Seuil des contours (1..255, bas = plus de traits) : ", 1, 255)
+	params := fmt.Sprintf("levels=%d;edge=%d", levels, edge)
+	if s := askLine(r, "Sigma spatial du lissage (vide = 3) : "); s != "" {
+		params += ";sigmas=" + s
+	}
+	if s := askLine(r, "Sigma des couleurs du lissage (vide = 25) : "); s != "" {
+		params += ";sigmar=" + s
+	}
+	return name, params
+}
+
+// askRegion demande les rectangles à modifier, un éventuel masque (image de même taille,
+// noir = inchangé, blanc = filtré, gris = mélange), l'opacité et le mode de fusion.
+// Renvoie les paramètres "cle=valeur;..." et le contenu du fichier masque.
+func askRegion(r *bufio.Reader) (string, []byte) {
+	var params []string
+	if roi := askLine(r, "\nZones à modifier x,y,largeur,hauteur séparées par '|' (vide = toute l'image) : "); roi != "" {
+		params = append(params, "roi="+roi)
+	}
+
+	var mask []byte
+	for {
+		path := askLine(r, "Fichier masque (vide = aucun) : ")
+		if path == "" {
+			break
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Printf("❌ Fichier introuvable : %s\n", path)
+			continue
+		}
+		mask = data
+		break
+	}
+
+	if opacity := askLine(r, "Opacité du filtre 0..1 (vide = 1) : "); opacity != "" {
+		params = append(params, "opacity="+opacity)
+	}
+	if blend := askChoice(r, "Mode de fusion", blendModes); blend != "normal" {
+		params = append(params, "blend="+blend)
+	}
+	return strings.Join(params, ";"), mask
+}
+
+// askBorder demande la gestion des bords des filtres de voisinage
+func askBorder(r *bufio.Reader) string {
+	return askBorderOf(r, borderModes)
+}
+
+// askBorderOf demande la gestion des bords parmi modes
+func askBorderOf(r *bufio.Reader, modes []string) string {
+	mode := askChoice(r, "Gestion des bords", modes)
+	if mode != "constant" {
+		return "border=" + mode
+	}
+	c := askLine(r, "Couleur hors image (r,g,b ou #rrggbb, vide = noir) : ")
+	if c == "" {
+		return "border=constant"
+	}
+	return "border=constant;bordercolor=" + c
+}
+
+// askLinear demande si les moyennes se calculent en sRGB ou en lumière linéaire
+func askLinear(r *bufio.Reader) string {
+	space := askChoice(r, "Espace de calcul des moyennes", []string{"srgb", "linear (lumière linéaire)"})
+	return fmt.Sprintf("linear=%t", space != "srgb")
+}
+
+func askLine(r *bufio.Reader, prompt string) string {
+	fmt.Print(prompt)
+	s, _ := r.ReadString('\n')
+	return strings.TrimSpace(s)
+}
+
+func askChoice(r *bufio.Reader, title string, choices []string) string {
+	fmt.Printf("\n%s :\n", title)
+	for i, c := range choices {
+		fmt.Printf("  %d) %s\n", i+1, c)
+	}
+	n := askInt(r, "Ton choix (numéro) : ", 1, len(choices))
+	return choices[n-1]
+}
+
 func askWorkers(r *bufio.Reader) int {
 	fmt.Println("\nWorkers (nombre de goroutines côté serveur) :")
 	fmt.Println("  0) Laisser le serveur choisir (recommandé)")
@@ -160,10 +688,11 @@ func askInt(r *bufio.Reader, prompt string, min int, max int) int {
 }
 
 // Protocole binaire (client)
-func sendRequest(w io.Writer, filterName string, radius int, workers int, img []byte) error {
+func sendRequest(w io.Writer, filterName string, radius int, workers int, params string, img []byte, mask []byte) error {
 	nameBytes := []byte(filterName)
 
-	// [u32 nameLen][name][i32 radius][i32 workers][u64 imgSize][imgBytes]
+	// [u32 nameLen][name][i32 radius][i32 workers][u32 paramsLen][params "cle=valeur;..."][u64 imgSize][imgBytes]
+	// [u64 maskSize][maskBytes] (maskSize = 0 : pas de masque)
 	if err := binary.Write(w, binary.BigEndian, uint32(len(nameBytes))); err != nil {
 		return err
 	}
@@ -177,10 +706,22 @@ func sendRequest(w io.Writer, filterName string, radius int, workers int, img []
 	if err := binary.Write(w, binary.BigEndian, int32(workers)); err != nil {
 		return err
 	}
+	if err := binary.Write(w, binary.BigEndian, uint32(len(params))); err != nil {
+		return err
+	}
+	if _, err := w.Write([]byte(params)); err != nil {
+		return err
+	}
 	if err := binary.Write(w, binary.BigEndian, uint64(len(img))); err != nil {
 		return err
 	}
-	_, err := w.Write(img)
+	if _, err := w.Write(img); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.BigEndian, uint64(len(mask))); err != nil {
+		return err
+	}
+	_, err := w.Write(mask)
 	return err
 }
 
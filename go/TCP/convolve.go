@@ -0,0 +1,162 @@
+// convolve.go
+package main
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Taille maximale d'un noyau envoyé par le client (lignes et colonnes)
+const maxKernelSize = 63
+
+// parseKernel lit un noyau "1,2,1|2,4,2|1,2,1" : lignes séparées par '|',
+// valeurs (entières ou réelles) séparées par ',' ou des espaces.
+func parseKernel(s string) ([][]float64, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, fmt.Errorf("noyau manquant (paramètre kernel)")
+	}
+
+	var kernel [][]float64
+	for _, line := range strings.Split(s, "|") {
+		fields := strings.FieldsFunc(line, func(r rune) bool { return r == ',' || r == ' ' })
+		if len(fields) == 0 {
+			return nil, fmt.Errorf("noyau: ligne vide")
+		}
+
+		row := make([]float64, len(fields))
+		for i, f := range fields {
+			v, err := strconv.ParseFloat(f, 64)
+			if err != nil {
+				return nil, fmt.Errorf("noyau: valeur invalide %q", f)
+			}
+			row[i] = v
+		}
+		if len(kernel) > 0 && len(row) != len(kernel[0]) {
+			return nil, fmt.Errorf("noyau: toutes les lignes doivent avoir %d valeurs", len(kernel[0]))
+		}
+		kernel = append(kernel, row)
+	}
+
+	if len(kernel) > maxKernelSize || len(kernel[0]) > maxKernelSize {
+		return nil, fmt.Errorf("noyau trop grand: %dx%d (max %dx%d)",
+			len(kernel[0]), len(kernel), maxKernelSize, maxKernelSize)
+	}
+	return kernel, nil
+}
+
+// kernelSum : diviseur par défaut (somme des coefficients, 1 si elle est nulle)
+func kernelSum(kernel [][]float64) float64 {
+	sum := 0.0
+	for _, row := range kernel {
+		for _, v := range row {
+			sum += v
+		}
+	}
+	if sum == 0 {
+		return 1
+	}
+	return sum
+}
+
+// Convolve applique un noyau NxM quelconque : out = somme(noyau * voisinage) / divisor + bias.
+// Le noyau est centré sur le pixel (ancre = ligne N/2, colonne M/2).
+// border : valeur des pixels hors de l'image (clamp, mirror, wrap, constant).
+// linear : somme calculée en lumière linéaire (bias compris), puis ré-encodée en sRGB.
+func Convolve(img image.Image, workers int, kernel [][]float64, divisor float64, bias float64, border Border, linear bool) *image.RGBA {
+	src := toRGBA(img)
+	bounds := src.Bounds()
+	out := image.NewRGBA(bounds)
+
+	if divisor == 0 {
+		divisor = 1
+	}
+
+	// valeurs d'entrée (0..255) et encodage de la sortie, en sRGB ou en lumière linéaire
+	var dec [256]float64
+	for v := range dec {
+		dec[v] = float64(v)
+		if linear {
+			dec[v] = float64(srgb8ToLinear16[v]) / 0x101
+		}
+	}
+	enc := clampUint8
+	if linear {
+		enc = func(v float64) uint8 {
+			return linear16ToSRGB8[uint16(math.Min(0xffff, math.Max(0, math.Round(v*0x101))))]
+		}
+	}
+
+	bcR := dec[border.Color.R]
+	bcG := dec[border.Color.G]
+	bcB := dec[border.Color.B]
+
+	wImg := bounds.Dx()
+	hImg := bounds.Dy()
+	kh := len(kernel)
+	kw := len(kernel[0])
+	ay := kh / 2
+	ax := kw / 2
+
+	// xmap[x*kw+kx] : colonne source (relative) lue pour la sortie x et la colonne kx du noyau
+	xmap := make([]int, wImg*kw)
+	for x := 0; x < wImg; x++ {
+		for kx := 0; kx < kw; kx++ {
+			xmap[x*kw+kx] = border.index(x+kx-ax, wImg)
+		}
+	}
+
+	forBands(bounds, workers, func(startY, endY int) {
+		ymap := make([]int, kh)
+
+		for y := startY; y < endY; y++ {
+			yy := y - bounds.Min.Y
+			for ky := 0; ky < kh; ky++ {
+				ymap[ky] = border.index(yy+ky-ay, hImg)
+			}
+
+			di := out.PixOffset(bounds.Min.X, y)
+			for x := 0; x < wImg; x++ {
+				var sumR, sumG, sumB float64
+
+				for ky, row := range kernel {
+					sy := ymap[ky]
+					var line []uint8
+					if sy >= 0 {
+						line = src.Pix[src.PixOffset(bounds.Min.X, bounds.Min.Y+sy):]
+					}
+					for kx, k := range row {
+						if k == 0 {
+							continue
+						}
+						sx := xmap[x*kw+kx]
+						if sy < 0 || sx < 0 {
+							// hors image en mode constant
+							sumR += k * bcR
+							sumG += k * bcG
+							sumB += k * bcB
+							continue
+						}
+						sumR += k * dec[line[4*sx+0]]
+						sumG += k * dec[line[4*sx+1]]
+						sumB += k * dec[line[4*sx+2]]
+					}
+				}
+
+				out.Pix[di+0] = enc(sumR/divisor + bias)
+				out.Pix[di+1] = enc(sumG/divisor + bias)
+				out.Pix[di+2] = enc(sumB/divisor + bias)
+				out.Pix[di+3] = 255
+				di += 4
+			}
+		}
+	})
+	return out
+}
+
+// clampUint8 arrondit et borne une valeur dans 0..255
+func clampUint8(v float64) uint8 {
+	return uint8(math.Min(255, math.Max(0, math.Round(v))))
+}
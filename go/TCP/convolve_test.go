@@ -0,0 +1,142 @@
+// convolve_test.go
+package main
+
+import (
+	"image"
+	"testing"
+)
+
+// naiveBorderIndex : indice replié dans l'image pas à pas (réflexions ou périodes
+// successives), -1 hors image en mode constant
+func naiveBorderIndex(mode BorderMode, i, n int) int {
+	switch mode {
+	case BorderConstant:
+		if i < 0 || i >= n {
+			return -1
+		}
+	case BorderMirror:
+		for n > 1 && (i < 0 || i >= n) {
+			if i < 0 {
+				i = -i
+			} else {
+				i = 2*(n-1) - i
+			}
+		}
+		if n == 1 {
+			i = 0
+		}
+	case BorderWrap:
+		for i < 0 {
+			i += n
+		}
+		for i >= n {
+			i -= n
+		}
+	default:
+		i = min(max(i, 0), n-1)
+	}
+	return i
+}
+
+// convolveReference : somme directe sur l'image complétée selon le bord
+func convolveReference(src *image.RGBA, kernel [][]float64, divisor, bias float64, border Border) *image.RGBA {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	out := image.NewRGBA(b)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var sum [3]float64
+			for ky, row := range kernel {
+				for kx, k := range row {
+					sx := naiveBorderIndex(border.Mode, x+kx-len(row)/2, w)
+					sy := naiveBorderIndex(border.Mode, y+ky-len(kernel)/2, h)
+					c := border.Color
+					if sx >= 0 && sy >= 0 {
+						c = src.RGBAAt(b.Min.X+sx, b.Min.Y+sy)
+					}
+					sum[0] += k * float64(c.R)
+					sum[1] += k * float64(c.G)
+					sum[2] += k * float64(c.B)
+				}
+			}
+			i := out.PixOffset(b.Min.X+x, b.Min.Y+y)
+			for c := range sum {
+				out.Pix[i+c] = clampUint8(sum[c]/divisor + bias)
+			}
+			out.Pix[i+3] = 255
+		}
+	}
+	return out
+}
+
+func TestConvolveMatchesNaive(t *testing.T) {
+	src := randomImage(19, 14, 21)
+	kernels := []struct {
+		spec          string
+		divisor, bias float64
+	}{
+		{"0,-1,0|-1,5,-1|0,-1,0", 1, 0},
+		{"1,2,1|2,4,2|1,2,1", 16, 0},
+		{"1,1,1,1,1", 5, 0},
+		{"1|0|-1", 1, 128},
+		{"2,0,1|0,0,-1|1,-1,-3|0,1,1", 3, 20},
+	}
+	for _, k := range kernels {
+		kernel, err := parseKernel(k.spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, border := range testBorders {
+			want := convolveReference(src, kernel, k.divisor, k.bias, border)
+			for _, workers := range workerCounts {
+				got := Convolve(src, workers, kernel, k.divisor, k.bias, border, false)
+				if d := maxDiff(t, got, want); d > 1 {
+					t.Errorf("%s, bord %d, %d workers : écart %d", k.spec, border.Mode, workers, d)
+				}
+			}
+		}
+	}
+}
+
+// TestConvolveLinearFlat : une image unie reste unie sous un noyau normalisé, y compris en
+// lumière linéaire (décodage puis ré-encodage sRGB)
+func TestConvolveLinearFlat(t *testing.T) {
+	src := uniformImage(8, 6, 30, 128, 240, 255)
+	kernel, _ := parseKernel("1,2,1|2,4,2|1,2,1")
+	for _, linear := range []bool{false, true} {
+		got := Convolve(src, 2, kernel, 16, 0, Border{}, linear)
+		if d := maxDiff(t, got, src); d > 1 {
+			t.Errorf("linear=%t : écart %d", linear, d)
+		}
+	}
+}
+
+func TestParseKernel(t *testing.T) {
+	cases := []struct {
+		spec string
+		w, h int // 0 : erreur attendue
+	}{
+		{"1,2,1|2,4,2|1,2,1", 3, 3},
+		{"1 2 3", 3, 1},
+		{"-0.5|1|-0.5", 1, 3},
+		{"", 0, 0},
+		{"1,2|3", 0, 0},
+		{"1,x,1", 0, 0},
+		{"1||1", 0, 0},
+	}
+	for _, c := range cases {
+		kernel, err := parseKernel(c.spec)
+		if c.w == 0 {
+			if err == nil {
+				t.Errorf("%q : erreur attendue", c.spec)
+			}
+			continue
+		}
+		if err != nil || len(kernel) != c.h || len(kernel[0]) != c.w {
+			t.Errorf("%q : %v (%v), attendu %dx%d", c.spec, kernel, err, c.w, c.h)
+		}
+	}
+	if s := kernelSum([][]float64{{-1, 0, 1}}); s != 1 {
+		t.Errorf("somme nulle : diviseur %g, attendu 1", s)
+	}
+}
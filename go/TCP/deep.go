@@ -0,0 +1,620 @@
+// deep.go
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"sort"
+	"sync"
+)
+
+// Chemin 16 bits : les filtres de parallel.go réduisent tout à 8 bits par canal (>> 8).
+// Ici on travaille de bout en bout sur *image.RGBA64 (valeurs 0..65535) pour ne pas
+// perdre de précision sur les PNG 16 bits (scanners).
+
+// isHighBitDepth indique si l'image décodée a plus de 8 bits par canal.
+func isHighBitDepth(img image.Image) bool {
+	switch img.(type) {
+	case *image.RGBA64, *image.NRGBA64, *image.Gray16:
+		return true
+	}
+	return false
+}
+
+// toRGBA64 convertit l'image en *image.RGBA64 (copie) pour un accès direct.
+func toRGBA64(img image.Image) *image.RGBA64 {
+	bounds := img.Bounds()
+	src := image.NewRGBA64(bounds)
+	draw.Draw(src, bounds, img, bounds.Min, draw.Src)
+	return src
+}
+
+// matchDepth remet le résultat dans le modèle de l'entrée : une entrée Gray16
+// donne une sortie Gray16 (PNG gris 16 bits), sinon RGBA64 (PNG couleur 16 bits).
+func matchDepth(out *image.RGBA64, in image.Image) image.Image {
+	if _, ok := in.(*image.Gray16); ok {
+		bounds := out.Bounds()
+		gray := image.NewGray16(bounds)
+		draw.Draw(gray, bounds, out, bounds.Min, draw.Src)
+		return gray
+	}
+	return out
+}
+
+// has16Bit indique si le filtre existe sur le chemin 16 bits ; sinon l'image passe par le
+// chemin 8 bits habituel (ou est refusée si la requête demande strict16=true).
+func has16Bit(name string) bool {
+	switch name {
+	case "grayscale", "blur", "sobel", "median", "pixelate", "posterizequantilescolor",
+		"resize", "crop", "rotate", "flip":
+		return true
+	}
+	return false
+}
+
+// ApplyFilter16 : équivalent de ApplyFilter pour le chemin 16 bits.
+func ApplyFilter16(img *image.RGBA64, name string, workers int, radius int, params Params) (*image.RGBA64, error) {
+	p := params.reader()
+	switch name {
+	case "grayscale":
+		return Grayscale16(img, workers, params.String("mode", "rec601"))
+
+	case "blur":
+		if radius < 1 {
+			radius = 1
+		}
+		border, err := parseBlurBorder(params)
+		if err != nil {
+			return nil, err
+		}
+		linear := p.Bool("linear", false)
+		if p.err != nil {
+			return nil, p.err
+		}
+		return Blur16(img, workers, radius, border, linear), nil
+
+	case "sobel":
+		border, err := parseBorder(params)
+		if err != nil {
+			return nil, err
+		}
+		opts, err := sobelOptions(params)
+		if err != nil {
+			return nil, err
+		}
+		return Sobel16(img, workers, border, opts)
+
+	case "median":
+		border, err := parseBorder(params)
+		if err != nil {
+			return nil, err
+		}
+		percentile := p.Int("percentile", 50)
+		if p.err != nil {
+			return nil, p.err
+		}
+		return MedianFilter16(img, workers, radius, percentile, border), nil
+
+	case "pixelate":
+		if radius < 2 {
+			radius = 2 //blockSize par défaut
+		}
+		linear := p.Bool("linear", false)
+		if p.err != nil {
+			return nil, p.err
+		}
+		return Pixelate16(img, workers, radius, linear), nil
+
+	case "posterizequantilescolor":
+		if radius < 2 {
+			radius = 4 // levels par défaut
+		}
+		return PosterizeQuantilesColor16(img, workers, radius), nil
+
+	case "resize":
+		width, height, err := resizeTarget(params, img.Bounds())
+		if err != nil {
+			return nil, err
+		}
+		return Resize16(img, workers, width, height, params.String("method", "bilinear"))
+
+	case "crop":
+		rect, err := cropRect(params, img.Bounds())
+		if err != nil {
+			return nil, err
+		}
+		return Crop16(img, workers, rect), nil
+
+	case "rotate":
+		angle, background := p.Float("angle", 90), p.Color("background", color.RGBA{0, 0, 0, 255})
+		if p.err != nil {
+			return nil, p.err
+		}
+		return Rotate16(img, workers, angle, background, params.String("method", "bilinear"))
+
+	case "flip":
+		return Flip16(img, workers, params.String("direction", "horizontal"))
+
+	default:
+		return nil, fmt.Errorf("filtre inconnu.")
+	}
+}
+
+// Grayscale16 convertit l'image en niveaux de gris selon mode (16 bits, voir grayFunc)
+func Grayscale16(img *image.RGBA64, workers int, mode string) (*image.RGBA64, error) {
+	gray, err := grayFunc(mode)
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := img.Bounds()
+	result := image.NewRGBA64(bounds)
+
+	forBands(bounds, workers, func(startY, endY int) {
+		for y := startY; y < endY; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				c := img.RGBA64At(x, y)
+				v := uint16(gray(uint32(c.R), uint32(c.G), uint32(c.B)))
+				result.SetRGBA64(x, y, color.RGBA64{v, v, v, 0xffff})
+			}
+		}
+	})
+	return result, nil
+}
+
+// Blur16 applique un box blur de rayon donné (16 bits)
+// Même algorithme séparable que Blur (sommes glissantes, même gestion des bords).
+// linear : moyenne calculée en lumière linéaire (voir Blur).
+func Blur16(img *image.RGBA64, workers int, radius int, border Border, linear bool) *image.RGBA64 {
+	bounds := img.Bounds()
+	result := image.NewRGBA64(bounds)
+
+	if radius < 1 {
+		radius = 1
+	}
+
+	wImg := bounds.Dx()
+	hImg := bounds.Dy()
+	bc := toLight16(color.RGBA64Model.Convert(border.Color).(color.RGBA64), linear)
+	if border.Mode == BorderShrink {
+		bc = color.RGBA64{}
+	}
+
+	// pixel (coordonnées relatives déjà ramenées par border.index, -1 = hors image)
+	px := func(x, y int) color.RGBA64 {
+		if x < 0 || y < 0 {
+			return bc
+		}
+		return toLight16(img.RGBA64At(bounds.Min.X+x, bounds.Min.Y+y), linear)
+	}
+
+	// 1) Passe horizontale
+	rows := make([]uint64, 3*wImg*hImg)
+
+	forBands(bounds, workers, func(startY, endY int) {
+		for y := startY; y < endY; y++ {
+			yy := y - bounds.Min.Y
+			row := rows[3*wImg*yy:]
+
+			var sumR, sumG, sumB uint64
+			for x := -radius; x <= radius; x++ {
+				c := px(border.index(x, wImg), yy)
+				sumR += uint64(c.R)
+				sumG += uint64(c.G)
+				sumB += uint64(c.B)
+			}
+
+			for x := 0; x < wImg; x++ {
+				row[3*x+0] = sumR
+				row[3*x+1] = sumG
+				row[3*x+2] = sumB
+
+				c := px(border.index(x+radius+1, wImg), yy)
+				sumR += uint64(c.R)
+				sumG += uint64(c.G)
+				sumB += uint64(c.B)
+				c = px(border.index(x-radius, wImg), yy)
+				sumR -= uint64(c.R)
+				sumG -= uint64(c.G)
+				sumB -= uint64(c.B)
+			}
+		}
+	})
+
+	size := uint64(2*radius + 1)
+	constRow := make([]uint64, 3*wImg)
+	for x := 0; x < wImg; x++ {
+		constRow[3*x+0] = size * uint64(bc.R)
+		constRow[3*x+1] = size * uint64(bc.G)
+		constRow[3*x+2] = size * uint64(bc.B)
+	}
+	rowAt := func(y int) []uint64 {
+		sy := border.index(y, hImg)
+		if sy < 0 {
+			return constRow
+		}
+		return rows[3*wImg*sy : 3*wImg*(sy+1)]
+	}
+
+	spanX, spanY := windowSpans(wImg, radius, border), windowSpans(hImg, radius, border)
+
+	// 2) Passe verticale
+	forBands(bounds, workers, func(startY, endY int) {
+		y0 := startY - bounds.Min.Y
+		y1 := endY - bounds.Min.Y
+		sums := make([]uint64, 3*wImg)
+
+		for yy := y0 - radius; yy <= y0+radius; yy++ {
+			for i, v := range rowAt(yy) {
+				sums[i] += v
+			}
+		}
+
+		for y := y0; y < y1; y++ {
+			for x := 0; x < wImg; x++ {
+				count := spanX[x] * spanY[y]
+				result.SetRGBA64(bounds.Min.X+x, bounds.Min.Y+y, fromLight16(color.RGBA64{
+					uint16(sums[3*x+0] / count),
+					uint16(sums[3*x+1] / count),
+					uint16(sums[3*x+2] / count),
+					0xffff,
+				}, linear))
+			}
+
+			for i, v := range rowAt(y + radius + 1) {
+				sums[i] += v
+			}
+			for i, v := range rowAt(y - radius) {
+				sums[i] -= v
+			}
+		}
+	})
+
+	return result
+}
+
+// Sobel16 détecte les contours (16 bits), mêmes options que Sobel.
+// Le seuil reste exprimé sur l'échelle 0..255.
+func Sobel16(img *image.RGBA64, workers int, border Border, opts SobelOptions) (*image.RGBA64, error) {
+	kx, ky, scale, err := edgeKernels(opts.Operator)
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := img.Bounds()
+	out := image.NewRGBA64(bounds)
+
+	wImg := bounds.Dx()
+	hImg := bounds.Dy()
+	outside := luma(float32(border.Color.R), float32(border.Color.G), float32(border.Color.B)) * 0x101
+
+	// Plan de luminance 0..65535
+	lum := make([]float32, wImg*hImg)
+	forBands(bounds, workers, func(startY, endY int) {
+		for y := startY; y < endY; y++ {
+			for x := 0; x < wImg; x++ {
+				c := img.RGBA64At(bounds.Min.X+x, y)
+				lum[(y-bounds.Min.Y)*wImg+x] = luma(float32(c.R), float32(c.G), float32(c.B))
+			}
+		}
+	})
+
+	gxs, gys := gradientPlanes(lum, wImg, hImg, workers, border, outside, kx, ky)
+	threshold := float64(opts.Threshold) * 0x101
+
+	forBands(bounds, workers, func(startY, endY int) {
+		for y := startY; y < endY; y++ {
+			for x := 0; x < wImg; x++ {
+				i := (y-bounds.Min.Y)*wImg + x
+				gx, gy := float64(gxs[i]), float64(gys[i])
+				magnitude := math.Min(0xffff, math.Sqrt(gx*gx+gy*gy)*float64(scale))
+
+				if opts.Threshold > 0 {
+					if magnitude >= threshold {
+						magnitude = 0xffff
+					} else {
+						magnitude = 0
+					}
+				}
+
+				var c color.RGBA64
+				if opts.Direction {
+					r, g, b := hueColor(math.Atan2(gy, gx)*180/math.Pi, magnitude/0xffff)
+					c = color.RGBA64{uint16(r*0xffff + 0.5), uint16(g*0xffff + 0.5), uint16(b*0xffff + 0.5), 0xffff}
+				} else {
+					m := uint16(magnitude)
+					c = color.RGBA64{m, m, m, 0xffff}
+				}
+				out.SetRGBA64(bounds.Min.X+x, y, c)
+			}
+		}
+	})
+	return out, nil
+}
+
+// MedianFilter16 applique un filtre de rang de rayon donné (16 bits)
+// Même fenêtre, même rang et mêmes bords que MedianFilter. L'histogramme de la fenêtre
+// glisse le long de la ligne (Huang) ; il est grossier puis fin, comme chez
+// Perreault–Hébert (voir rankHist16) : le rang se trouve en parcourant au plus 64 cases
+// au lieu de trier la fenêtre. Pas d'histogrammes de colonnes ici : 65536 cases par
+// colonne coûteraient trop de mémoire.
+func MedianFilter16(img *image.RGBA64, workers int, radius int, percentile int, border Border) *image.RGBA64 {
+	bounds := img.Bounds()
+	out := image.NewRGBA64(bounds)
+
+	if radius < 1 {
+		radius = 1
+	}
+	percentile = min(max(percentile, 0), 100)
+
+	wImg := bounds.Dx()
+	hImg := bounds.Dy()
+	size := 2*radius + 1
+	rank := int32(percentile * (size*size - 1) / 100)
+	bc := color.RGBA64Model.Convert(border.Color).(color.RGBA64)
+	bcs := [3]uint16{bc.R, bc.G, bc.B}
+
+	forBands(bounds, workers, func(startY, endY int) {
+		kernel := new([3]rankHist16)
+
+		// addCol ajoute (sign=1) ou retire (sign=-1) la colonne x (lignes y-r..y+r) de la fenêtre
+		addCol := func(x, y int, sign int32) {
+			sx := border.index(x, wImg)
+			if sx < 0 {
+				for c := range kernel {
+					kernel[c].add(bcs[c], sign*int32(size))
+				}
+				return
+			}
+			for yy := y - radius; yy <= y+radius; yy++ {
+				sy := border.index(yy, hImg)
+				if sy < 0 {
+					for c := range kernel {
+						kernel[c].add(bcs[c], sign)
+					}
+					continue
+				}
+				pi := img.PixOffset(bounds.Min.X+sx, bounds.Min.Y+sy)
+				for c := range kernel {
+					kernel[c].add(uint16(img.Pix[pi+2*c])<<8|uint16(img.Pix[pi+2*c+1]), sign)
+				}
+			}
+		}
+
+		for y := startY - bounds.Min.Y; y < endY-bounds.Min.Y; y++ {
+			for x := -radius; x <= radius; x++ {
+				addCol(x, y, 1)
+			}
+
+			for x := 0; x < wImg; x++ {
+				var v [3]uint16
+				for c := range kernel {
+					v[c] = kernel[c].value(rank)
+				}
+				out.SetRGBA64(bounds.Min.X+x, bounds.Min.Y+y, color.RGBA64{v[0], v[1], v[2], 0xffff})
+
+				addCol(x+radius+1, y, 1)
+				addCol(x-radius, y, -1)
+			}
+
+			// vider la fenêtre (colonnes wImg-r..wImg+r) plutôt que remettre 65536 cases à zéro
+			for x := wImg - radius; x <= wImg+radius; x++ {
+				addCol(x, y, -1)
+			}
+		}
+	})
+	return out
+}
+
+// rankHist16 : histogramme d'une fenêtre à plusieurs niveaux : octet de poids fort puis
+// de poids faible, chacun découpé en deux quartets -> l0[v>>12], l1[v>>8], l2[v>>4], l3[v].
+// Le rang se trouve en 4 étapes d'au plus 16 cases.
+type rankHist16 struct {
+	l0 [1 << 4]int32
+	l1 [1 << 8]int32
+	l2 [1 << 12]int32
+	l3 [1 << 16]int32
+}
+
+func (h *rankHist16) add(v uint16, n int32) {
+	h.l0[v>>12] += n
+	h.l1[v>>8] += n
+	h.l2[v>>4] += n
+	h.l3[v] += n
+}
+
+// value renvoie la valeur de rang donné (0 = plus petite) : à chaque niveau, on avance
+// parmi les 16 cases que couvre la case choisie au niveau précédent
+func (h *rankHist16) value(rank int32) uint16 {
+	var below int32
+	v := 0
+	for _, level := range [][]int32{h.l0[:], h.l1[:], h.l2[:], h.l3[:]} {
+		v <<= 4
+		for below+level[v] <= rank {
+			below += level[v]
+			v++
+		}
+	}
+	return uint16(v)
+}
+
+// toLight16 passe un pixel sRGB 16 bits en lumière linéaire (si linear)
+func toLight16(c color.RGBA64, linear bool) color.RGBA64 {
+	if linear {
+		c.R, c.G, c.B = srgb16ToLinear16[c.R], srgb16ToLinear16[c.G], srgb16ToLinear16[c.B]
+	}
+	return c
+}
+
+// fromLight16 ré-encode en sRGB un pixel calculé en lumière linéaire (si linear)
+func fromLight16(c color.RGBA64, linear bool) color.RGBA64 {
+	if linear {
+		c.R, c.G, c.B = linear16ToSRGB16[c.R], linear16ToSRGB16[c.G], linear16ToSRGB16[c.B]
+	}
+	return c
+}
+
+// Pixelate16 applique un effet mosaïque (16 bits)
+// linear : moyenne des blocs calculée en lumière linéaire.
+func Pixelate16(img *image.RGBA64, workers int, blockSize int, linear bool) *image.RGBA64 {
+	bounds := img.Bounds()
+	out := image.NewRGBA64(bounds)
+
+	if blockSize < 2 {
+		blockSize = 2
+	}
+
+	forBands(bounds, workers, func(startY, endY int) {
+		for y := startY; y < endY; y += blockSize {
+			for x := bounds.Min.X; x < bounds.Max.X; x += blockSize {
+				var sumR, sumG, sumB uint64
+				var count uint64
+
+				for yy := y; yy < y+blockSize && yy < bounds.Max.Y; yy++ {
+					for xx := x; xx < x+blockSize && xx < bounds.Max.X; xx++ {
+						c := toLight16(img.RGBA64At(xx, yy), linear)
+						sumR += uint64(c.R)
+						sumG += uint64(c.G)
+						sumB += uint64(c.B)
+						count++
+					}
+				}
+
+				avg := fromLight16(color.RGBA64{
+					R: uint16(sumR / count),
+					G: uint16(sumG / count),
+					B: uint16(sumB / count),
+					A: 0xffff,
+				}, linear)
+
+				for yy := y; yy < y+blockSize && yy < bounds.Max.Y; yy++ {
+					for xx := x; xx < x+blockSize && xx < bounds.Max.X; xx++ {
+						out.SetRGBA64(xx, yy, avg)
+					}
+				}
+			}
+		}
+	})
+	return out
+}
+
+// PosterizeQuantilesColor16 : posterization par quantiles globaux sur R, G et B (16 bits).
+// Comme PosterizeQuantilesColor, les quantiles viennent d'histogrammes (65536 cases par
+// canal) calculés par bandes puis fusionnés : O(N), sans tri ni copie des canaux.
+func PosterizeQuantilesColor16(img *image.RGBA64, workers int, levels int) *image.RGBA64 {
+	if levels < 2 {
+		levels = 2
+	}
+
+	bounds := img.Bounds()
+
+	// 1) Histogrammes R, G, B (par bandes, fusionnés) et LUT par canal
+	total := new([3][1 << 16]int)
+	var mu sync.Mutex
+	forBands(bounds, workers, func(startY, endY int) {
+		hist := new([3][1 << 16]int)
+		for y := startY; y < endY; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				c := img.RGBA64At(x, y)
+				hist[0][c.R]++
+				hist[1][c.G]++
+				hist[2][c.B]++
+			}
+		}
+
+		mu.Lock()
+		for c := range hist {
+			for v, n := range hist[c] {
+				total[c][v] += n
+			}
+		}
+		mu.Unlock()
+	})
+	lutR := quantileLUT16(&total[0], levels)
+	lutG := quantileLUT16(&total[1], levels)
+	lutB := quantileLUT16(&total[2], levels)
+
+	// 2) Application parallèle
+	out := image.NewRGBA64(bounds)
+
+	forBands(bounds, workers, func(startY, endY int) {
+		for y := startY; y < endY; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				c := img.RGBA64At(x, y)
+				out.SetRGBA64(x, y, color.RGBA64{lutR[c.R], lutG[c.G], lutB[c.B], c.A})
+			}
+		}
+	})
+	return out
+}
+
+// quantileLUT16 : même principe que quantileLUT, sur 0..65535 : les valeurs (données par
+// leur histogramme) sont découpées en levels groupes de même effectif, comme si elles
+// étaient triées, et chaque groupe est remplacé par sa moyenne.
+func quantileLUT16(hist *[1 << 16]int, levels int) []uint16 {
+	lut := make([]uint16, 1<<16)
+
+	// cum[v] = nombre de valeurs < v, sums[v] = somme des valeurs < v
+	cum := make([]int, 1<<16+1)
+	sums := make([]int, 1<<16+1)
+	for v, c := range hist {
+		cum[v+1] = cum[v] + c
+		sums[v+1] = sums[v] + v*c
+	}
+	n := cum[1<<16]
+
+	if n == 0 || levels < 2 {
+		for v := range lut {
+			lut[v] = uint16(v)
+		}
+		return lut
+	}
+	if levels > n {
+		levels = n
+	}
+
+	// valueAt(i) : i-ème valeur triée ; sumBefore(i) : somme des i premières
+	valueAt := func(i int) int {
+		return sort.Search(1<<16, func(v int) bool { return cum[v+1] > i })
+	}
+	sumBefore := func(i int) int {
+		if i >= n {
+			return sums[1<<16]
+		}
+		v := valueAt(i)
+		return sums[v] + v*(i-cum[v])
+	}
+
+	reps := make([]uint16, levels)
+	binMax := make([]int, levels)
+
+	for b := 0; b < levels; b++ {
+		start := b * n / levels
+		end := (b + 1) * n / levels
+		if b == levels-1 {
+			end = n
+		}
+		if end <= start {
+			end = start + 1
+			if end > n {
+				end = n
+				start = n - 1
+			}
+		}
+
+		reps[b] = uint16((sumBefore(end) - sumBefore(start)) / (end - start))
+		binMax[b] = valueAt(end - 1)
+	}
+
+	b := 0
+	for v := range lut {
+		for b < levels-1 && v > binMax[b] {
+			b++
+		}
+		lut[v] = reps[b]
+	}
+	return lut
+}
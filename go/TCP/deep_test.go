@@ -0,0 +1,183 @@
+// deep_test.go
+package main
+
+import (
+	"image"
+	"image/color"
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+// randomImage16 : image RGBA64 aléatoire opaque ; spread limite l'écart des valeurs autour
+// de 32768 (petit spread : beaucoup de valeurs dans la même case grossière).
+func randomImage16(w, h int, spread int, seed int64) *image.RGBA64 {
+	img := image.NewRGBA64(image.Rect(2, 7, 2+w, 7+h))
+	r := rand.New(rand.NewSource(seed))
+	for y := img.Rect.Min.Y; y < img.Rect.Max.Y; y++ {
+		for x := img.Rect.Min.X; x < img.Rect.Max.X; x++ {
+			v := func() uint16 { return uint16(32768 - spread/2 + r.Intn(spread)) }
+			img.SetRGBA64(x, y, color.RGBA64{v(), v(), v(), 0xffff})
+		}
+	}
+	return img
+}
+
+// medianReference16 : fenêtre triée pour chaque pixel
+func medianReference16(img *image.RGBA64, radius, percentile int, border Border) *image.RGBA64 {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	size := 2*radius + 1
+	rank := percentile * (size*size - 1) / 100
+	bc := color.RGBA64Model.Convert(border.Color).(color.RGBA64)
+	out := image.NewRGBA64(b)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var win [3][]uint16
+			for dy := -radius; dy <= radius; dy++ {
+				for dx := -radius; dx <= radius; dx++ {
+					sx, sy := border.index(x+dx, w), border.index(y+dy, h)
+					c := bc
+					if sx >= 0 && sy >= 0 {
+						c = img.RGBA64At(b.Min.X+sx, b.Min.Y+sy)
+					}
+					win[0], win[1], win[2] = append(win[0], c.R), append(win[1], c.G), append(win[2], c.B)
+				}
+			}
+			for c := range win {
+				slices.Sort(win[c])
+			}
+			out.SetRGBA64(b.Min.X+x, b.Min.Y+y, color.RGBA64{win[0][rank], win[1][rank], win[2][rank], 0xffff})
+		}
+	}
+	return out
+}
+
+func TestMedianFilter16MatchesSort(t *testing.T) {
+	borders := []Border{
+		{Mode: BorderClamp},
+		{Mode: BorderMirror},
+		{Mode: BorderWrap},
+		{Mode: BorderConstant, Color: color.RGBA{200, 10, 90, 255}},
+	}
+	for _, spread := range []int{65536, 300} {
+		src := randomImage16(17, 13, spread, int64(spread))
+		for _, border := range borders {
+			for _, radius := range []int{1, 2, 5} {
+				for _, percentile := range []int{0, 30, 50, 100} {
+					want := medianReference16(src, radius, percentile, border)
+					for _, workers := range workerCounts {
+						got := MedianFilter16(src, workers, radius, percentile, border)
+						if string(got.Pix) != string(want.Pix) {
+							t.Fatalf("spread %d, bord %d, rayon %d, percentile %d, %d workers : résultat différent",
+								spread, border.Mode, radius, percentile, workers)
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+// quantileReference16 : découpage des valeurs triées en levels groupes de même effectif
+func quantileReference16(vals []uint16, levels int) []uint16 {
+	sorted := slices.Clone(vals)
+	slices.Sort(sorted)
+	n := len(sorted)
+	levels = min(levels, n)
+	lut := make([]uint16, 1<<16)
+	reps := make([]uint16, levels)
+	binMax := make([]uint16, levels)
+	for b := 0; b < levels; b++ {
+		start, end := b*n/levels, (b+1)*n/levels
+		if b == levels-1 {
+			end = n
+		}
+		sum := 0
+		for _, v := range sorted[start:end] {
+			sum += int(v)
+		}
+		reps[b] = uint16(sum / (end - start))
+		binMax[b] = sorted[end-1]
+	}
+	b := 0
+	for v := range lut {
+		for b < levels-1 && uint16(v) > binMax[b] {
+			b++
+		}
+		lut[v] = reps[b]
+	}
+	return lut
+}
+
+func TestPosterizeQuantilesColor16MatchesSort(t *testing.T) {
+	for _, spread := range []int{65536, 40} {
+		src := randomImage16(23, 19, spread, 3)
+		b := src.Bounds()
+		var vals [3][]uint16
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				c := src.RGBA64At(x, y)
+				vals[0], vals[1], vals[2] = append(vals[0], c.R), append(vals[1], c.G), append(vals[2], c.B)
+			}
+		}
+		for _, levels := range []int{2, 5, 64} {
+			var luts [3][]uint16
+			for c := range luts {
+				luts[c] = quantileReference16(vals[c], levels)
+			}
+			for _, workers := range workerCounts {
+				out := PosterizeQuantilesColor16(src, workers, levels)
+				for y := b.Min.Y; y < b.Max.Y; y++ {
+					for x := b.Min.X; x < b.Max.X; x++ {
+						c, got := src.RGBA64At(x, y), out.RGBA64At(x, y)
+						if want := (color.RGBA64{luts[0][c.R], luts[1][c.G], luts[2][c.B], 0xffff}); got != want {
+							t.Fatalf("spread %d, %d niveaux, %d workers : (%d, %d) = %v, attendu %v",
+								spread, levels, workers, x, y, got, want)
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+// TestBlur16MatchesNaive : moyenne 16 bits directe de la fenêtre, fenêtre réduite à l'image
+// (défaut du flou) ou complétée selon le mode de bord
+func TestBlur16MatchesNaive(t *testing.T) {
+	img := randomImage16(13, 9, 60000, 29)
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	for _, border := range []Border{{Mode: BorderShrink}, {Mode: BorderClamp}, {Mode: BorderConstant, Color: color.RGBA{200, 10, 90, 255}}} {
+		bc := color.RGBA64Model.Convert(border.Color).(color.RGBA64)
+		for _, radius := range []int{1, 3, 15} {
+			want := image.NewRGBA64(b)
+			for y := 0; y < h; y++ {
+				for x := 0; x < w; x++ {
+					var sum [3]uint64
+					var count uint64
+					for dy := -radius; dy <= radius; dy++ {
+						for dx := -radius; dx <= radius; dx++ {
+							sx, sy := border.index(x+dx, w), border.index(y+dy, h)
+							if border.Mode == BorderShrink && (sx < 0 || sy < 0) {
+								continue
+							}
+							c := bc
+							if sx >= 0 && sy >= 0 {
+								c = img.RGBA64At(b.Min.X+sx, b.Min.Y+sy)
+							}
+							sum[0], sum[1], sum[2] = sum[0]+uint64(c.R), sum[1]+uint64(c.G), sum[2]+uint64(c.B)
+							count++
+						}
+					}
+					want.SetRGBA64(b.Min.X+x, b.Min.Y+y, color.RGBA64{uint16(sum[0] / count), uint16(sum[1] / count), uint16(sum[2] / count), 0xffff})
+				}
+			}
+			for _, workers := range workerCounts {
+				if got := Blur16(img, workers, radius, border, false); !slices.Equal(got.Pix, want.Pix) {
+					t.Errorf("bord %d, rayon %d, %d workers : résultat différent", border.Mode, radius, workers)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,124 @@
+// denoise.go
+package main
+
+import (
+	"fmt"
+	"image"
+	"math"
+)
+
+// Débruitage qui préserve les contours (contrairement à Blur et MedianFilter) :
+// filtre bilatéral (les voisins de couleur trop différente comptent peu) et filtre guidé
+// (He et al. : dans chaque fenêtre, sortie = a x entrée + b, a proche de 0 dans les zones
+// unies et de 1 sur les contours). Tous deux parallèles par bandes.
+
+// Bilateral : moyenne des voisins pondérée par exp(-d²/2 sigmaS²) (distance) et
+// exp(-c²/2 sigmaR²) (écart de couleur RGB, 0..255). Fenêtre de rayon 2 x sigmaS ;
+// les voisins hors de l'image sont ignorés.
+func Bilateral(img image.Image, workers int, sigmaS, sigmaR float64) (*image.RGBA, error) {
+	if sigmaS <= 0 || sigmaR <= 0 {
+		return nil, fmt.Errorf("bilateral: sigmas (%g) et sigmar (%g) doivent être > 0", sigmaS, sigmaR)
+	}
+	src := toRGBA(img)
+	bounds := src.Bounds()
+	out := image.NewRGBA(bounds)
+	radius := max(int(math.Ceil(2*sigmaS)), 1)
+
+	// poids tabulés : distance (par décalage) et couleur (par écart au carré)
+	size := 2*radius + 1
+	spatial := make([]float32, size*size)
+	for dy := -radius; dy <= radius; dy++ {
+		for dx := -radius; dx <= radius; dx++ {
+			spatial[(dy+radius)*size+dx+radius] = float32(math.Exp(-float64(dx*dx+dy*dy) / (2 * sigmaS * sigmaS)))
+		}
+	}
+	rangeW := make([]float32, 3*255*255+1)
+	for d2 := range rangeW {
+		rangeW[d2] = float32(math.Exp(-float64(d2) / (2 * sigmaR * sigmaR)))
+	}
+
+	forBands(bounds, workers, func(startY, endY int) {
+		for y := startY; y < endY; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				pi := src.PixOffset(x, y)
+				r0, g0, b0 := int(src.Pix[pi+0]), int(src.Pix[pi+1]), int(src.Pix[pi+2])
+
+				var sr, sg, sb, sw float32
+				for dy := max(-radius, bounds.Min.Y-y); dy <= min(radius, bounds.Max.Y-1-y); dy++ {
+					row := spatial[(dy+radius)*size:]
+					qi := src.PixOffset(x, y+dy)
+					for dx := max(-radius, bounds.Min.X-x); dx <= min(radius, bounds.Max.X-1-x); dx++ {
+						k := qi + dx*4
+						r, g, b := src.Pix[k+0], src.Pix[k+1], src.Pix[k+2]
+						dr, dg, db := int(r)-r0, int(g)-g0, int(b)-b0
+						w := row[dx+radius] * rangeW[dr*dr+dg*dg+db*db]
+						sr += w * float32(r)
+						sg += w * float32(g)
+						sb += w * float32(b)
+						sw += w
+					}
+				}
+
+				di := out.PixOffset(x, y)
+				out.Pix[di+0] = uint8(sr/sw + 0.5)
+				out.Pix[di+1] = uint8(sg/sw + 0.5)
+				out.Pix[di+2] = uint8(sb/sw + 0.5)
+				out.Pix[di+3] = src.Pix[pi+3]
+			}
+		}
+	})
+	return out, nil
+}
+
+// Guided : filtre guidé par l'image elle-même, canal par canal (valeurs ramenées à 0..1).
+// Dans chaque fenêtre de rayon radius : a = var / (var + eps), b = moyenne x (1 - a) ;
+// sortie = moyenne(a) x entrée + moyenne(b). eps règle le lissage (écart-type des
+// détails effacés ~ sqrt(eps)). Moyennes par images intégrales (boxMean).
+func Guided(img image.Image, workers int, radius int, eps float64) (*image.RGBA, error) {
+	if radius < 1 || eps <= 0 {
+		return nil, fmt.Errorf("guided: radius (%d) >= 1 et eps (%g) > 0", radius, eps)
+	}
+	src := toRGBA(img)
+	bounds := src.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	out := image.NewRGBA(bounds)
+
+	// element applique fn à chaque case i = y*w+x (parallèle par bandes)
+	element := func(fn func(i int)) {
+		forBands(image.Rect(0, 0, w, h), workers, func(startY, endY int) {
+			for i := startY * w; i < endY*w; i++ {
+				fn(i)
+			}
+		})
+	}
+
+	for c := 0; c < 3; c++ {
+		in := make([]float64, w*h)
+		sq := make([]float64, w*h)
+		element(func(i int) {
+			v := float64(src.Pix[src.PixOffset(bounds.Min.X+i%w, bounds.Min.Y+i/w)+c]) / 255
+			in[i], sq[i] = v, v*v
+		})
+
+		mean := boxMean(in, w, h, radius, workers)
+		meanSq := boxMean(sq, w, h, radius, workers)
+		a, b := make([]float64, w*h), make([]float64, w*h)
+		element(func(i int) {
+			variance := max(meanSq[i]-mean[i]*mean[i], 0)
+			a[i] = variance / (variance + eps)
+			b[i] = mean[i] * (1 - a[i])
+		})
+
+		meanA := boxMean(a, w, h, radius, workers)
+		meanB := boxMean(b, w, h, radius, workers)
+		element(func(i int) {
+			x, y := bounds.Min.X+i%w, bounds.Min.Y+i/w
+			di := out.PixOffset(x, y)
+			out.Pix[di+c] = clampUint8((meanA[i]*in[i] + meanB[i]) * 255)
+			if c == 0 {
+				out.Pix[di+3] = src.Pix[src.PixOffset(x, y)+3]
+			}
+		})
+	}
+	return out, nil
+}
@@ -0,0 +1,199 @@
+// denoise_test.go
+package main
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+// bilateralReference : somme pondérée directe en float64, poids recalculés à chaque voisin
+func bilateralReference(src *image.RGBA, sigmaS, sigmaR float64) *image.RGBA {
+	b := src.Bounds()
+	radius := max(int(math.Ceil(2*sigmaS)), 1)
+	out := image.NewRGBA(b)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c0 := src.RGBAAt(x, y)
+			var sum [3]float64
+			weights := 0.0
+			for dy := -radius; dy <= radius; dy++ {
+				for dx := -radius; dx <= radius; dx++ {
+					if !image.Pt(x+dx, y+dy).In(b) {
+						continue
+					}
+					c := src.RGBAAt(x+dx, y+dy)
+					dr, dg, db := float64(c.R)-float64(c0.R), float64(c.G)-float64(c0.G), float64(c.B)-float64(c0.B)
+					w := math.Exp(-float64(dx*dx+dy*dy)/(2*sigmaS*sigmaS)) *
+						math.Exp(-(dr*dr+dg*dg+db*db)/(2*sigmaR*sigmaR))
+					sum[0] += w * float64(c.R)
+					sum[1] += w * float64(c.G)
+					sum[2] += w * float64(c.B)
+					weights += w
+				}
+			}
+			out.SetRGBA(x, y, color.RGBA{clampUint8(sum[0] / weights), clampUint8(sum[1] / weights), clampUint8(sum[2] / weights), c0.A})
+		}
+	}
+	return out
+}
+
+// guidedReference : filtre guidé avec des moyennes directes sur les fenêtres réduites à l'image
+func guidedReference(src *image.RGBA, radius int, eps float64) *image.RGBA {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	mean := func(vals []float64) []float64 {
+		out := make([]float64, w*h)
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				n := 0
+				for sy := max(y-radius, 0); sy <= min(y+radius, h-1); sy++ {
+					for sx := max(x-radius, 0); sx <= min(x+radius, w-1); sx++ {
+						out[y*w+x] += vals[sy*w+sx]
+						n++
+					}
+				}
+				out[y*w+x] /= float64(n)
+			}
+		}
+		return out
+	}
+
+	out := image.NewRGBA(b)
+	for c := 0; c < 3; c++ {
+		in, sq := make([]float64, w*h), make([]float64, w*h)
+		for i := range in {
+			in[i] = float64(src.Pix[src.PixOffset(b.Min.X+i%w, b.Min.Y+i/w)+c]) / 255
+			sq[i] = in[i] * in[i]
+		}
+		m, m2 := mean(in), mean(sq)
+		a, bb := make([]float64, w*h), make([]float64, w*h)
+		for i := range a {
+			variance := max(m2[i]-m[i]*m[i], 0)
+			a[i] = variance / (variance + eps)
+			bb[i] = m[i] * (1 - a[i])
+		}
+		ma, mb := mean(a), mean(bb)
+		for i := range in {
+			x, y := b.Min.X+i%w, b.Min.Y+i/w
+			out.Pix[out.PixOffset(x, y)+c] = clampUint8((ma[i]*in[i] + mb[i]) * 255)
+			out.Pix[out.PixOffset(x, y)+3] = src.RGBAAt(x, y).A
+		}
+	}
+	return out
+}
+
+func TestBilateralMatchesReference(t *testing.T) {
+	src := randomImage(29, 21, 43)
+	for i := 3; i < len(src.Pix); i += 20 {
+		src.Pix[i] = 30
+	}
+	for _, sigmas := range [][2]float64{{0.4, 10}, {1.5, 30}, {3, 80}} {
+		want := bilateralReference(src, sigmas[0], sigmas[1])
+		for _, workers := range workerCounts {
+			got, err := Bilateral(src, workers, sigmas[0], sigmas[1])
+			if err != nil {
+				t.Fatal(err)
+			}
+			// poids et sommes en float32 côté filtre : arrondi à 1 près
+			if d := maxDiff(t, got, want); d > 1 {
+				t.Errorf("sigmas %v, %d workers : écart %d", sigmas, workers, d)
+			}
+		}
+		// SubImage : Stride de l'entrée différent de celui de la sortie
+		got, _ := Bilateral(embedded(src), 3, sigmas[0], sigmas[1])
+		if d := maxDiff(t, got, want); d > 1 {
+			t.Errorf("sigmas %v, SubImage : écart %d", sigmas, d)
+		}
+	}
+}
+
+func TestGuidedMatchesReference(t *testing.T) {
+	src := randomImage(29, 21, 44)
+	for _, c := range []struct {
+		radius int
+		eps    float64
+	}{{1, 0.001}, {3, 0.02}, {15, 0.1}} {
+		want := guidedReference(src, c.radius, c.eps)
+		for _, workers := range workerCounts {
+			got, err := Guided(src, workers, c.radius, c.eps)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if d := maxDiff(t, got, want); d > 1 {
+				t.Errorf("rayon %d, eps %g, %d workers : écart %d", c.radius, c.eps, workers, d)
+			}
+		}
+		got, _ := Guided(embedded(src), 3, c.radius, c.eps)
+		if d := maxDiff(t, got, want); d > 1 {
+			t.Errorf("rayon %d, eps %g, SubImage : écart %d", c.radius, c.eps, d)
+		}
+	}
+}
+
+// TestDenoiseHandValues : deux pixels gris 0 et 100 (255 pour le filtre guidé)
+func TestDenoiseHandValues(t *testing.T) {
+	pair := func(v uint8) *image.RGBA {
+		img := uniformImage(2, 1, 0, 0, 0, 255)
+		img.SetRGBA(1, 0, color.RGBA{v, v, v, 255})
+		return img
+	}
+	check := func(name string, got *image.RGBA, want [2]uint8) {
+		t.Helper()
+		for x, v := range want {
+			if c := got.RGBAAt(x, 0); c != (color.RGBA{v, v, v, 255}) {
+				t.Errorf("%s : pixel %d = %v, attendu %d", name, x, c, v)
+			}
+		}
+	}
+
+	// poids du voisin : exp(-1/2) x exp(-3 x 100² / (2 x 1000²)) = 0.5975 ;
+	// 100 x 0.5975 / 1.5975 = 37.4 et 100 / 1.5975 = 62.6
+	got, _ := Bilateral(pair(100), 2, 1, 1000)
+	check("bilateral sigmaR 1000", got, [2]uint8{37, 63})
+	// sigmaR 50 : poids exp(-1/2) x exp(-6) = 0.0015, la marche reste entière
+	got, _ = Bilateral(pair(100), 2, 1, 50)
+	check("bilateral sigmaR 50", got, [2]uint8{0, 100})
+
+	// fenêtre = les deux pixels : moyenne 0.5, variance 0.25 ; eps 0.25 donne a = 0.5,
+	// b = 0.25, soit 0.25 et 0.75 x 255 = 63.75 et 191.25
+	got, _ = Guided(pair(255), 2, 1, 0.25)
+	check("guided", got, [2]uint8{64, 191})
+}
+
+// TestDenoiseKeepsEdges : image unie inchangée ; une marche franche reste exacte avec un
+// sigmaR petit devant son contraste, et le filtre guidé avec un eps minuscule ne lisse rien
+func TestDenoiseKeepsEdges(t *testing.T) {
+	flat := uniformImage(12, 9, 90, 30, 200, 255)
+	bilateral, _ := Bilateral(flat, 2, 2, 10)
+	assertSame(t, bilateral, flat)
+	guided, _ := Guided(flat, 2, 3, 0.01)
+	assertSame(t, guided, flat)
+
+	step := uniformImage(12, 9, 40, 40, 40, 255)
+	for y := 0; y < 9; y++ {
+		for x := 6; x < 12; x++ {
+			step.SetRGBA(x, y, color.RGBA{200, 200, 200, 255})
+		}
+	}
+	bilateral, _ = Bilateral(step, 3, 2, 10)
+	assertSame(t, bilateral, step)
+
+	src := randomImage(20, 15, 45)
+	guided, _ = Guided(src, 2, 2, 1e-9)
+	if d := maxDiff(t, guided, src); d > 1 {
+		t.Errorf("eps 1e-9 : écart %d à l'image d'origine", d)
+	}
+
+	for _, err := range []error{
+		func() error { _, err := Bilateral(flat, 1, 0, 10); return err }(),
+		func() error { _, err := Bilateral(flat, 1, 2, -1); return err }(),
+		func() error { _, err := Guided(flat, 1, 0, 0.01); return err }(),
+		func() error { _, err := Guided(flat, 1, 2, 0); return err }(),
+	} {
+		if err == nil {
+			t.Error("paramètres invalides : erreur attendue")
+		}
+	}
+}
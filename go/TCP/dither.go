@@ -0,0 +1,469 @@
+// dither.go
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Tramage sur une palette donnée (1 bit, quelques niveaux de gris pour l'e-ink, ou couleurs).
+// Diffusion d'erreur (floyd, atkinson, jarvis) : chaque pixel dépend des pixels au-dessus et à
+// gauche, on parallélise donc en front d'onde : les lignes sont distribuées à tour de rôle
+// aux workers de splitWorkers et une ligne n'avance que si la ligne précédente a assez
+// d'avance (décalage de lag pixels). Le résultat est identique au parcours séquentiel.
+// Tramage ordonné (bayer2/4/8, bluenoise) : un seuil par position, parallèle par bandes.
+
+// DitherOptions : paramètres du tramage
+type DitherOptions struct {
+	Method  string        // floyd (défaut), atkinson, jarvis, bayer2, bayer4, bayer8, bluenoise
+	Palette color.Palette // couleurs de sortie (color.RGBA)
+}
+
+// diffusionWeight : part de l'erreur envoyée au pixel (x+dx, y+dy)
+type diffusionWeight struct {
+	dx, dy int
+	w      float32
+}
+
+// diffusionKernel : noyau de diffusion (poids déjà divisés)
+type diffusionKernel []diffusionWeight
+
+// newDiffusionKernel divise les poids entiers par divisor
+func newDiffusionKernel(divisor float32, weights ...[3]int) diffusionKernel {
+	k := make(diffusionKernel, len(weights))
+	for i, w := range weights {
+		k[i] = diffusionWeight{w[0], w[1], float32(w[2]) / divisor}
+	}
+	return k
+}
+
+var diffusionKernels = map[string]diffusionKernel{
+	"floyd": newDiffusionKernel(16,
+		[3]int{1, 0, 7},
+		[3]int{-1, 1, 3}, [3]int{0, 1, 5}, [3]int{1, 1, 1}),
+	// Atkinson ne diffuse que 6/8 de l'erreur (contraste plus marqué)
+	"atkinson": newDiffusionKernel(8,
+		[3]int{1, 0, 1}, [3]int{2, 0, 1},
+		[3]int{-1, 1, 1}, [3]int{0, 1, 1}, [3]int{1, 1, 1},
+		[3]int{0, 2, 1}),
+	"jarvis": newDiffusionKernel(48,
+		[3]int{1, 0, 7}, [3]int{2, 0, 5},
+		[3]int{-2, 1, 3}, [3]int{-1, 1, 5}, [3]int{0, 1, 7}, [3]int{1, 1, 5}, [3]int{2, 1, 3},
+		[3]int{-2, 2, 1}, [3]int{-1, 2, 3}, [3]int{0, 2, 5}, [3]int{1, 2, 3}, [3]int{2, 2, 1}),
+}
+
+// extent renvoie la portée du noyau : décalages max vers la gauche et la droite
+// (lignes suivantes) et nombre de lignes touchées sous le pixel.
+func (k diffusionKernel) extent() (left, right, depth int) {
+	for _, w := range k {
+		left = max(left, -w.dx)
+		right = max(right, w.dx)
+		depth = max(depth, w.dy)
+	}
+	return left, right, depth
+}
+
+// paletteRGB renvoie les couleurs de la palette en float32
+func paletteRGB(pal color.Palette) [][3]float32 {
+	out := make([][3]float32, len(pal))
+	for i, c := range pal {
+		r, g, b, _ := c.RGBA()
+		out[i] = [3]float32{float32(r >> 8), float32(g >> 8), float32(b >> 8)}
+	}
+	return out
+}
+
+// paletteIndexer renvoie la recherche de la couleur la plus proche (RGB) : directe pour les
+// petites palettes, par les candidates de paletteIndex au-delà de 16 couleurs.
+func paletteIndexer(pal color.Palette, workers int) func(v [3]float32) int {
+	colors := paletteRGB(pal)
+	if len(colors) <= 16 {
+		return func(v [3]float32) int {
+			best, bestD := 0, float32(math.MaxFloat32)
+			for i, c := range colors {
+				d0, d1, d2 := v[0]-c[0], v[1]-c[1], v[2]-c[2]
+				if d := d0*d0 + d1*d1 + d2*d2; d < bestD {
+					best, bestD = i, d
+				}
+			}
+			return best
+		}
+	}
+
+	toSpace, _ := colorSpace("rgb")
+	idx := newPaletteIndex(pal, toSpace, workers)
+	return func(v [3]float32) int {
+		return idx.nearest(float64(v[0]), float64(v[1]), float64(v[2]))
+	}
+}
+
+// rowProgress : nombre de pixels terminés d'une ligne de ErrorDiffusion. La ligne suivante
+// dort sur cond jusqu'à ce que l'avance publiée suffise (pas d'attente active : les workers
+// peuvent être plus nombreux que les cœurs).
+type rowProgress struct {
+	mu   sync.Mutex
+	cond sync.Cond
+	done int
+}
+
+// progressStep : la ligne publie son avance tous les progressStep pixels
+const progressStep = 32
+
+// publish enregistre l'avance et réveille la ligne qui attend
+func (p *rowProgress) publish(done int) {
+	p.mu.Lock()
+	p.done = done
+	p.mu.Unlock()
+	p.cond.Broadcast()
+}
+
+// wait attend que need pixels soient terminés et renvoie l'avance connue
+func (p *rowProgress) wait(need int) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for p.done < need {
+		p.cond.Wait()
+	}
+	return p.done
+}
+
+// ErrorDiffusion trame l'image sur la palette avec le noyau de diffusion.
+// Les lignes y, y+n, y+2n... vont au worker y%n ; avant de traiter le pixel x, une ligne
+// attend (rowProgress) que la précédente ait terminé x+lag pixels (lag = portée gauche +
+// droite + 1).
+// Ainsi toutes les erreurs reçues par un pixel sont arrivées avant qu'il soit lu, et deux
+// lignes n'écrivent jamais la même case en même temps. Les lignes d'erreur sont allouées par
+// la première ligne qui y écrit et libérées dès la fin de leur ligne.
+func ErrorDiffusion(img image.Image, workers int, kernel diffusionKernel, pal color.Palette) *image.RGBA {
+	src := toRGBA(img)
+	bounds := src.Bounds()
+	wImg, hImg := bounds.Dx(), bounds.Dy()
+	out := image.NewRGBA(bounds)
+	if wImg == 0 || hImg == 0 {
+		return out
+	}
+
+	index := paletteIndexer(pal, workers)
+	colors := paletteRGB(pal)
+	left, right, depth := kernel.extent()
+	lag := left + right + 1
+
+	errRows := make([][]float32, hImg)
+	for y := 0; y < min(depth, hImg); y++ {
+		errRows[y] = make([]float32, wImg*3)
+	}
+	progress := make([]rowProgress, hImg)
+	for y := range progress {
+		progress[y].cond.L = &progress[y].mu
+	}
+
+	n, _, _ := splitWorkers(bounds, workers)
+	var wg sync.WaitGroup
+
+	for k := 0; k < n; k++ {
+		wg.Add(1)
+		go func(k int) {
+			defer wg.Done()
+
+			for y := k; y < hImg; y += n {
+				if y+depth < hImg {
+					errRows[y+depth] = make([]float32, wImg*3)
+				}
+
+				// ready : avance connue de la ligne précédente (on ne la relit que si elle
+				// ne suffit plus)
+				ready := wImg
+				wait := func(need int) {
+					if ready < need {
+						ready = progress[y-1].wait(need)
+					}
+				}
+				if y > 0 {
+					ready = 0
+					wait(min(lag, wImg))
+				}
+
+				// lignes d'erreur touchées par cette ligne (allouées avant l'avance attendue)
+				rows := make([][]float32, depth+1)
+				for dy := range rows {
+					if y+dy < hImg {
+						rows[dy] = errRows[y+dy]
+					}
+				}
+
+				si := src.PixOffset(bounds.Min.X, bounds.Min.Y+y)
+				di := out.PixOffset(bounds.Min.X, bounds.Min.Y+y)
+				for x := 0; x < wImg; x++ {
+					wait(min(x+lag, wImg))
+
+					var v [3]float32
+					for c := 0; c < 3; c++ {
+						v[c] = min(max(float32(src.Pix[si+c])+rows[0][x*3+c], 0), 255)
+					}
+					p := colors[index(v)]
+					out.Pix[di+0], out.Pix[di+1], out.Pix[di+2], out.Pix[di+3] = uint8(p[0]), uint8(p[1]), uint8(p[2]), 255
+
+					for _, w := range kernel {
+						xx := x + w.dx
+						row := rows[w.dy]
+						if xx < 0 || xx >= wImg || row == nil {
+							continue
+						}
+						for c := 0; c < 3; c++ {
+							row[xx*3+c] += (v[c] - p[c]) * w.w
+						}
+					}
+
+					if (x+1)%progressStep == 0 {
+						progress[y].publish(x + 1)
+					}
+					si += 4
+					di += 4
+				}
+				progress[y].publish(wImg)
+				errRows[y] = nil
+			}
+		}(k)
+	}
+	wg.Wait()
+
+	return out
+}
+
+// thresholdMap : seuils du tramage ordonné (-0.5..0.5), matrice size x size répétée
+type thresholdMap struct {
+	size int
+	t    []float32
+}
+
+// bayerMap construit la matrice de Bayer size x size (size puissance de 2) :
+// M(2n) = [4M, 4M+2; 4M+3, 4M+1]
+func bayerMap(size int) thresholdMap {
+	m := []int{0}
+	for n := 1; n < size; n *= 2 {
+		next := make([]int, 4*n*n)
+		for y := 0; y < n; y++ {
+			for x := 0; x < n; x++ {
+				v := 4 * m[y*n+x]
+				next[y*2*n+x] = v
+				next[y*2*n+x+n] = v + 2
+				next[(y+n)*2*n+x] = v + 3
+				next[(y+n)*2*n+x+n] = v + 1
+			}
+		}
+		m = next
+	}
+	return rankMap(size, m)
+}
+
+// rankMap convertit des rangs 0..size²-1 en seuils centrés
+func rankMap(size int, ranks []int) thresholdMap {
+	tm := thresholdMap{size: size, t: make([]float32, len(ranks))}
+	for i, r := range ranks {
+		tm.t[i] = (float32(r)+0.5)/float32(len(ranks)) - 0.5
+	}
+	return tm
+}
+
+var (
+	blueNoiseOnce sync.Once
+	blueNoise     thresholdMap
+)
+
+// blueNoiseMap renvoie une matrice de bruit bleu 64x64 (void-and-cluster, calculée une seule
+// fois) : pas de motif régulier visible, contrairement à Bayer.
+func blueNoiseMap() thresholdMap {
+	blueNoiseOnce.Do(func() {
+		const size = 64
+		const n = size * size
+
+		// énergie gaussienne torique (sigma 1.5) entre deux positions
+		var gauss [size][size]float64
+		for dy := 0; dy < size; dy++ {
+			for dx := 0; dx < size; dx++ {
+				ddx, ddy := float64(min(dx, size-dx)), float64(min(dy, size-dy))
+				gauss[dy][dx] = math.Exp(-(ddx*ddx + ddy*ddy) / (2 * 1.5 * 1.5))
+			}
+		}
+
+		pattern := make([]bool, n)
+		energy := make([]float64, n)
+		toggle := func(pattern []bool, energy []float64, p int, on bool) {
+			pattern[p] = on
+			sign := 1.0
+			if !on {
+				sign = -1
+			}
+			px, py := p%size, p/size
+			for q := range energy {
+				dx, dy := (q%size-px+size)%size, (q/size-py+size)%size
+				energy[q] += sign * gauss[dy][dx]
+			}
+		}
+		// extreme renvoie le point allumé le plus entouré (cluster) ou le trou le plus vide
+		extreme := func(pattern []bool, energy []float64, cluster bool) int {
+			best := -1
+			for p := range energy {
+				if pattern[p] != cluster {
+					continue
+				}
+				if best < 0 || (cluster && energy[p] > energy[best]) || (!cluster && energy[p] < energy[best]) {
+					best = p
+				}
+			}
+			return best
+		}
+
+		// motif initial : 10 % de points aléatoires (graine fixe), puis relaxation
+		rng := rand.New(rand.NewSource(1))
+		ones := 0
+		for ones < n/10 {
+			if p := rng.Intn(n); !pattern[p] {
+				toggle(pattern, energy, p, true)
+				ones++
+			}
+		}
+		for {
+			c := extreme(pattern, energy, true)
+			toggle(pattern, energy, c, false)
+			v := extreme(pattern, energy, false)
+			toggle(pattern, energy, v, true)
+			if v == c {
+				break
+			}
+		}
+
+		ranks := make([]int, n)
+		// rangs < ones : on retire les clusters un par un
+		p1, e1 := append([]bool(nil), pattern...), append([]float64(nil), energy...)
+		for rank := ones - 1; rank >= 0; rank-- {
+			c := extreme(p1, e1, true)
+			toggle(p1, e1, c, false)
+			ranks[c] = rank
+		}
+		// rangs >= ones : on remplit les trous les plus vides
+		for rank := ones; rank < n; rank++ {
+			v := extreme(pattern, energy, false)
+			toggle(pattern, energy, v, true)
+			ranks[v] = rank
+		}
+		blueNoise = rankMap(size, ranks)
+	})
+	return blueNoise
+}
+
+// ditherSpread : amplitude du bruit ordonné, l'écart entre deux niveaux voisins de la palette
+// (niveaux de gris : 255/(n-1) ; couleurs : environ racine cubique de n niveaux par canal)
+func ditherSpread(pal color.Palette) float32 {
+	levels := float64(len(pal))
+	for _, c := range paletteRGB(pal) {
+		if c[0] != c[1] || c[1] != c[2] {
+			levels = math.Round(math.Cbrt(levels))
+			break
+		}
+	}
+	return 255 / float32(max(levels-1, 1))
+}
+
+// OrderedDither trame l'image sur la palette : chaque pixel est décalé du seuil de sa position
+// (x spread) avant de prendre la couleur la plus proche.
+func OrderedDither(img image.Image, workers int, tm thresholdMap, pal color.Palette) *image.RGBA {
+	src := toRGBA(img)
+	bounds := src.Bounds()
+	out := image.NewRGBA(bounds)
+
+	index := paletteIndexer(pal, workers)
+	colors := paletteRGB(pal)
+	spread := ditherSpread(pal)
+
+	forBands(bounds, workers, func(startY, endY int) {
+		for y := startY; y < endY; y++ {
+			row := tm.t[(y-bounds.Min.Y)%tm.size*tm.size:]
+			si := src.PixOffset(bounds.Min.X, y)
+			di := out.PixOffset(bounds.Min.X, y)
+			for x := 0; x < bounds.Dx(); x++ {
+				off := row[x%tm.size] * spread
+				var v [3]float32
+				for c := 0; c < 3; c++ {
+					v[c] = min(max(float32(src.Pix[si+c])+off, 0), 255)
+				}
+				p := colors[index(v)]
+				out.Pix[di+0], out.Pix[di+1], out.Pix[di+2], out.Pix[di+3] = uint8(p[0]), uint8(p[1]), uint8(p[2]), 255
+				si += 4
+				di += 4
+			}
+		}
+	})
+	return out
+}
+
+// Dither applique la méthode de tramage choisie
+func Dither(img image.Image, workers int, opts DitherOptions) (*image.RGBA, error) {
+	if len(opts.Palette) == 0 {
+		return nil, fmt.Errorf("palette vide")
+	}
+	switch opts.Method {
+	case "", "floyd":
+		return ErrorDiffusion(img, workers, diffusionKernels["floyd"], opts.Palette), nil
+	case "atkinson", "jarvis":
+		return ErrorDiffusion(img, workers, diffusionKernels[opts.Method], opts.Palette), nil
+	case "bayer2", "bayer4", "bayer8":
+		size, _ := strconv.Atoi(strings.TrimPrefix(opts.Method, "bayer"))
+		return OrderedDither(img, workers, bayerMap(size), opts.Palette), nil
+	case "bluenoise":
+		return OrderedDither(img, workers, blueNoiseMap(), opts.Palette), nil
+	default:
+		return nil, fmt.Errorf("tramage inconnu: %q (floyd, atkinson, jarvis, bayer2, bayer4, bayer8, bluenoise)", opts.Method)
+	}
+}
+
+// parseDitherPalette lit le paramètre "palette" : bw (défaut, 1 bit), grayN (N niveaux de
+// gris), adaptive (median-cut de l'image sur "colors" couleurs) ou une liste de couleurs
+// "r,g,b|#rrggbb|...".
+func parseDitherPalette(params Params, img image.Image, workers int) (color.Palette, error) {
+	spec := params.String("palette", "bw")
+	switch {
+	case spec == "bw":
+		return color.Palette{color.RGBA{0, 0, 0, 255}, color.RGBA{255, 255, 255, 255}}, nil
+
+	case strings.HasPrefix(spec, "gray"):
+		n, err := strconv.Atoi(strings.TrimPrefix(spec, "gray"))
+		if err != nil || n < 2 || n > 256 {
+			return nil, fmt.Errorf("palette invalide: %q (gray2..gray256)", spec)
+		}
+		pal := make(color.Palette, n)
+		for i := range pal {
+			v := uint8((i*255 + (n-1)/2) / (n - 1))
+			pal[i] = color.RGBA{v, v, v, 255}
+		}
+		return pal, nil
+
+	case spec == "adaptive":
+		p := params.reader()
+		colors := p.Int("colors", 16)
+		if p.err != nil {
+			return nil, p.err
+		}
+		return buildPalette([]*image.RGBA{toRGBA(img)}, workers, QuantizeOptions{Colors: colors})
+
+	default:
+		var pal color.Palette
+		for _, part := range strings.Split(spec, "|") {
+			c, err := parseColor(strings.TrimSpace(part))
+			if err != nil {
+				return nil, err
+			}
+			pal = append(pal, c)
+		}
+		if len(pal) > 256 {
+			return nil, fmt.Errorf("palette: %d couleurs (max 256)", len(pal))
+		}
+		return pal, nil
+	}
+}
@@ -0,0 +1,150 @@
+// dither_test.go
+package main
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// diffusionReference : diffusion d'erreur séquentielle, ligne par ligne, erreurs dans une
+// seule table
+func diffusionReference(src *image.RGBA, kernel diffusionKernel, pal color.Palette) *image.RGBA {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	errs := make([]float32, w*h*3)
+	out := image.NewRGBA(b)
+	colors := paletteRGB(pal)
+	index := paletteIndexer(pal, 1)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			si := src.PixOffset(b.Min.X+x, b.Min.Y+y)
+			var v [3]float32
+			for c := 0; c < 3; c++ {
+				v[c] = min(max(float32(src.Pix[si+c])+errs[(y*w+x)*3+c], 0), 255)
+			}
+			p := colors[index(v)]
+			di := out.PixOffset(b.Min.X+x, b.Min.Y+y)
+			out.Pix[di+0], out.Pix[di+1], out.Pix[di+2], out.Pix[di+3] = uint8(p[0]), uint8(p[1]), uint8(p[2]), 255
+			for _, k := range kernel {
+				xx, yy := x+k.dx, y+k.dy
+				if xx < 0 || xx >= w || yy >= h {
+					continue
+				}
+				for c := 0; c < 3; c++ {
+					errs[(yy*w+xx)*3+c] += (v[c] - p[c]) * k.w
+				}
+			}
+		}
+	}
+	return out
+}
+
+// TestErrorDiffusionWavefront : le front d'onde parallèle donne exactement la diffusion
+// séquentielle, y compris avec bien plus de workers que de cœurs ou de lignes.
+func TestErrorDiffusionWavefront(t *testing.T) {
+	sizes := [][2]int{{97, 61}, {3, 40}, {1, 1}, {40, 1}, {200, 9}}
+	for _, size := range sizes {
+		src := randomImage(size[0], size[1], 9)
+		for _, palette := range []string{"bw", "gray4", "adaptive"} {
+			pal, err := parseDitherPalette(Params{"palette": palette, "colors": "40"}, src, 2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for name, kernel := range diffusionKernels {
+				want := diffusionReference(src, kernel, pal)
+				for _, workers := range []int{1, 2, 3, 8, 100} {
+					got := ErrorDiffusion(src, workers, kernel, pal)
+					if d := maxDiff(t, got, want); d != 0 {
+						t.Fatalf("%v, %s, %s, %d workers : écart %d", size, palette, name, workers, d)
+					}
+				}
+				// SubImage : Stride de l'entrée différent de celui de la sortie
+				if d := maxDiff(t, ErrorDiffusion(embedded(src), 3, kernel, pal), want); d != 0 {
+					t.Fatalf("%v, %s, %s, SubImage : écart %d", size, palette, name, d)
+				}
+			}
+		}
+	}
+}
+
+// TestDitherMidGray : un gris à 50 % tramé en noir et blanc donne environ moitié de blanc
+func TestDitherMidGray(t *testing.T) {
+	src := uniformImage(64, 64, 128, 128, 128, 255)
+	bw := color.Palette{color.RGBA{0, 0, 0, 255}, color.RGBA{255, 255, 255, 255}}
+	for _, method := range []string{"bayer2", "bayer4", "bayer8", "bluenoise", "floyd", "atkinson", "jarvis"} {
+		out, err := Dither(src, 4, DitherOptions{Method: method, Palette: bw})
+		if err != nil {
+			t.Fatal(err)
+		}
+		white := 0
+		for i := 0; i < len(out.Pix); i += 4 {
+			if out.Pix[i] == 255 {
+				white++
+			}
+		}
+		if white < 1800 || white > 2300 {
+			t.Errorf("%s : %d pixels blancs sur 4096", method, white)
+		}
+	}
+
+	// SubImage : même trame que l'image seule
+	src = randomImage(37, 23, 10)
+	for _, method := range []string{"bayer8", "bluenoise", "floyd"} {
+		want, _ := Dither(src, 3, DitherOptions{Method: method, Palette: bw})
+		got, _ := Dither(embedded(src), 3, DitherOptions{Method: method, Palette: bw})
+		if d := maxDiff(t, got, want); d != 0 {
+			t.Errorf("%s, SubImage : écart %d", method, d)
+		}
+	}
+}
+
+func TestThresholdMaps(t *testing.T) {
+	cases := []struct {
+		name string
+		tm   thresholdMap
+		n    int
+	}{
+		{"bayer4", bayerMap(4), 16},
+		{"bayer8", bayerMap(8), 64},
+		{"bluenoise", blueNoiseMap(), 64 * 64},
+	}
+	for _, c := range cases {
+		seen := map[float32]bool{}
+		for _, v := range c.tm.t {
+			if v < -0.5 || v > 0.5 {
+				t.Fatalf("%s : seuil %g hors de -0.5..0.5", c.name, v)
+			}
+			seen[v] = true
+		}
+		if len(seen) != c.n {
+			t.Errorf("%s : %d seuils distincts, attendu %d", c.name, len(seen), c.n)
+		}
+	}
+}
+
+func TestParseDitherPalette(t *testing.T) {
+	src := randomImage(8, 8, 10)
+	cases := []struct {
+		palette string
+		colors  int // -1 : erreur attendue
+	}{
+		{"bw", 2},
+		{"gray4", 4},
+		{"#ff0000|0,0,0|255,255,255", 3},
+		{"gray1", -1},
+		{"#zz0000", -1},
+	}
+	for _, c := range cases {
+		pal, err := parseDitherPalette(Params{"palette": c.palette}, src, 1)
+		if c.colors < 0 {
+			if err == nil {
+				t.Errorf("%s : erreur attendue", c.palette)
+			}
+			continue
+		}
+		if err != nil || len(pal) != c.colors {
+			t.Errorf("%s : %d couleurs (%v), attendu %d", c.palette, len(pal), err, c.colors)
+		}
+	}
+}
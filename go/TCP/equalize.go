@@ -0,0 +1,279 @@
+// equalize.go
+package main
+
+import (
+	"fmt"
+	"image"
+	"sync"
+)
+
+// Amélioration du contraste par égalisation d'histogramme : globale (equalize) ou
+// locale par tuiles avec limitation du contraste (CLAHE).
+// mode "luma" (défaut) : on égalise la luminance et on décale R, G, B de la même quantité
+// (teinte et saturation conservées) ; mode "rgb" : chaque canal est égalisé séparément.
+
+// CLAHEOptions : paramètres de CLAHE
+type CLAHEOptions struct {
+	TilesX, TilesY int     // grille de tuiles (8 x 8 par défaut)
+	ClipLimit      float64 // hauteur max d'une classe, en multiple de la moyenne (< 1 = pas de limite)
+	Mode           string  // luma ou rgb
+}
+
+// equalizeLUT construit la table d'égalisation d'un histogramme : fonction de répartition
+// ramenée sur 0..255, la plus petite valeur présente allant en 0.
+func equalizeLUT(hist *[256]int) [256]uint8 {
+	var lut [256]uint8
+
+	n, cdfMin := 0, 0
+	for _, c := range hist {
+		if cdfMin == 0 {
+			cdfMin = c
+		}
+		n += c
+	}
+	if n == cdfMin {
+		// une seule valeur : rien à étaler
+		for v := range lut {
+			lut[v] = uint8(v)
+		}
+		return lut
+	}
+
+	cdf := 0
+	for v, c := range hist {
+		cdf += c
+		if cdf < cdfMin {
+			continue
+		}
+		lut[v] = uint8((int64(cdf-cdfMin)*255 + int64(n-cdfMin)/2) / int64(n-cdfMin))
+	}
+	return lut
+}
+
+// clipHistogram écrête chaque classe à limit et répartit l'excédent sur toutes les classes
+// (le reste de la division va aux premières classes).
+func clipHistogram(hist *[256]int, limit int) {
+	excess := 0
+	for v, c := range hist {
+		if c > limit {
+			excess += c - limit
+			hist[v] = limit
+		}
+	}
+	for v := range hist {
+		hist[v] += excess / 256
+		if v < excess%256 {
+			hist[v]++
+		}
+	}
+}
+
+// contrastPlanes extrait les plans à égaliser : la luminance (Rec.601, comme grayscale)
+// ou les trois canaux R, G, B.
+func contrastPlanes(src *image.RGBA, workers int, mode string) ([][]uint8, error) {
+	bounds := src.Bounds()
+	wImg, hImg := bounds.Dx(), bounds.Dy()
+
+	var count int
+	switch mode {
+	case "", "luma":
+		count = 1
+	case "rgb":
+		count = 3
+	default:
+		return nil, fmt.Errorf("mode inconnu: %q (luma, rgb)", mode)
+	}
+
+	planes := make([][]uint8, count)
+	for p := range planes {
+		planes[p] = make([]uint8, wImg*hImg)
+	}
+	gray, _ := grayFunc("rec601")
+
+	forBands(bounds, workers, func(startY, endY int) {
+		for y := startY; y < endY; y++ {
+			pi := src.PixOffset(bounds.Min.X, y)
+			i := (y - bounds.Min.Y) * wImg
+			for x := 0; x < wImg; x++ {
+				r, g, b := src.Pix[pi+0], src.Pix[pi+1], src.Pix[pi+2]
+				if count == 1 {
+					planes[0][i] = uint8(gray(uint32(r)*0x101, uint32(g)*0x101, uint32(b)*0x101) >> 8)
+				} else {
+					planes[0][i], planes[1][i], planes[2][i] = r, g, b
+				}
+				pi += 4
+				i++
+			}
+		}
+	})
+	return planes, nil
+}
+
+// tileGrid : découpage de l'image en tilesX x tilesY tuiles et tables d'égalisation
+// par tuile et par plan (luts[plan][ty*tilesX+tx]).
+type tileGrid struct {
+	w, h           int
+	tilesX, tilesY int
+	luts           [][][256]uint8
+}
+
+// tileRect renvoie le rectangle de la tuile (tx, ty)
+func (g *tileGrid) tileRect(tx, ty int) image.Rectangle {
+	return image.Rect(tx*g.w/g.tilesX, ty*g.h/g.tilesY, (tx+1)*g.w/g.tilesX, (ty+1)*g.h/g.tilesY)
+}
+
+// axis renvoie, pour la coordonnée pos, les deux tuiles voisines (centres encadrant pos)
+// et le poids de la seconde.
+func axis(pos int, size int, tiles int) (int, int, float32) {
+	t := (float32(pos)+0.5)*float32(tiles)/float32(size) - 0.5
+	if t <= 0 {
+		return 0, 0, 0
+	}
+	if t >= float32(tiles-1) {
+		return tiles - 1, tiles - 1, 0
+	}
+	i := int(t)
+	return i, i + 1, t - float32(i)
+}
+
+// remapPlanes applique les tables des tuiles à chaque pixel, avec interpolation bilinéaire
+// entre les tables des quatre tuiles les plus proches (pas de marches aux jointures).
+func (g *tileGrid) remapPlanes(planes [][]uint8, workers int) [][]uint8 {
+	out := make([][]uint8, len(planes))
+	for p := range out {
+		out[p] = make([]uint8, g.w*g.h)
+	}
+
+	forBands(image.Rect(0, 0, g.w, g.h), workers, func(startY, endY int) {
+		for y := startY; y < endY; y++ {
+			ty0, ty1, fy := axis(y, g.h, g.tilesY)
+			for x := 0; x < g.w; x++ {
+				tx0, tx1, fx := axis(x, g.w, g.tilesX)
+				i := y*g.w + x
+				for p, plane := range planes {
+					v := plane[i]
+					luts := g.luts[p]
+					top := float32(luts[ty0*g.tilesX+tx0][v])*(1-fx) + float32(luts[ty0*g.tilesX+tx1][v])*fx
+					bottom := float32(luts[ty1*g.tilesX+tx0][v])*(1-fx) + float32(luts[ty1*g.tilesX+tx1][v])*fx
+					out[p][i] = uint8(top*(1-fy) + bottom*fy + 0.5)
+				}
+			}
+		}
+	})
+	return out
+}
+
+// writeContrast reconstruit l'image : en mode luma, R, G, B sont décalés de
+// (nouvelle luminance - ancienne) ; en mode rgb les plans sont les canaux.
+func writeContrast(src *image.RGBA, before, after [][]uint8, workers int) *image.RGBA {
+	bounds := src.Bounds()
+	out := image.NewRGBA(bounds)
+	wImg := bounds.Dx()
+
+	forBands(bounds, workers, func(startY, endY int) {
+		for y := startY; y < endY; y++ {
+			si := src.PixOffset(bounds.Min.X, y)
+			di := out.PixOffset(bounds.Min.X, y)
+			i := (y - bounds.Min.Y) * wImg
+			for x := 0; x < wImg; x++ {
+				if len(after) == 1 {
+					delta := int(after[0][i]) - int(before[0][i])
+					for c := 0; c < 3; c++ {
+						out.Pix[di+c] = uint8(min(max(int(src.Pix[si+c])+delta, 0), 255))
+					}
+				} else {
+					out.Pix[di+0], out.Pix[di+1], out.Pix[di+2] = after[0][i], after[1][i], after[2][i]
+				}
+				out.Pix[di+3] = 255
+				si += 4
+				di += 4
+				i++
+			}
+		}
+	})
+	return out
+}
+
+// Equalize : égalisation globale de l'histogramme (mode luma ou rgb).
+// Les histogrammes sont ceux de la requête stats (par bandes, fusionnés).
+func Equalize(img image.Image, workers int, mode string) (*image.RGBA, error) {
+	src := toRGBA(img)
+	planes, err := contrastPlanes(src, workers, mode)
+	if err != nil {
+		return nil, err
+	}
+
+	hists := channelHistograms(src, workers, true)
+	g := &tileGrid{w: src.Bounds().Dx(), h: src.Bounds().Dy(), tilesX: 1, tilesY: 1}
+	if len(planes) == 1 {
+		g.luts = [][][256]uint8{{equalizeLUT(&hists[3])}}
+	} else {
+		for c := 0; c < 3; c++ {
+			g.luts = append(g.luts, [][256]uint8{equalizeLUT(&hists[c])})
+		}
+	}
+
+	return writeContrast(src, planes, g.remapPlanes(planes, workers), workers), nil
+}
+
+// CLAHE : égalisation adaptative par tuiles avec limitation du contraste.
+// Chaque tuile a sa table (histogramme écrêté à ClipLimit x moyenne, puis égalisé) ;
+// les tables sont calculées en parallèle, workers tuiles à la fois, puis chaque pixel
+// interpole entre les tables des quatre tuiles voisines.
+func CLAHE(img image.Image, workers int, opts CLAHEOptions) (*image.RGBA, error) {
+	src := toRGBA(img)
+	planes, err := contrastPlanes(src, workers, opts.Mode)
+	if err != nil {
+		return nil, err
+	}
+
+	wImg, hImg := src.Bounds().Dx(), src.Bounds().Dy()
+	g := &tileGrid{
+		w:      wImg,
+		h:      hImg,
+		tilesX: min(max(opts.TilesX, 1), wImg),
+		tilesY: min(max(opts.TilesY, 1), hImg),
+	}
+	tiles := g.tilesX * g.tilesY
+	g.luts = make([][][256]uint8, len(planes))
+	for p := range g.luts {
+		g.luts[p] = make([][256]uint8, tiles)
+	}
+
+	if workers < 1 {
+		workers = 1
+	}
+	sem := make(chan struct{}, workers)
+	var wg sync.WaitGroup
+
+	for t := 0; t < tiles; t++ {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(t int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			rect := g.tileRect(t%g.tilesX, t/g.tilesX)
+			limit := 0
+			if opts.ClipLimit >= 1 {
+				limit = max(1, int(opts.ClipLimit*float64(rect.Dx()*rect.Dy())/256))
+			}
+
+			for p, plane := range planes {
+				var hist [256]int
+				for y := rect.Min.Y; y < rect.Max.Y; y++ {
+					for _, v := range plane[y*wImg+rect.Min.X : y*wImg+rect.Max.X] {
+						hist[v]++
+					}
+				}
+				if limit > 0 {
+					clipHistogram(&hist, limit)
+				}
+				g.luts[p][t] = equalizeLUT(&hist)
+			}
+		}(t)
+	}
+	wg.Wait()
+
+	return writeContrast(src, planes, g.remapPlanes(planes, workers), workers), nil
+}
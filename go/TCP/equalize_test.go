@@ -0,0 +1,247 @@
+// equalize_test.go
+package main
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+// equalizeReference : table d'égalisation comptée valeur par valeur
+// (cdf(v) = nombre de valeurs <= v, la plus petite valeur présente va en 0)
+func equalizeReference(vals []int) [256]uint8 {
+	var lut [256]uint8
+	lo := 255
+	for _, v := range vals {
+		lo = min(lo, v)
+	}
+	count := func(limit int) int {
+		n := 0
+		for _, v := range vals {
+			if v <= limit {
+				n++
+			}
+		}
+		return n
+	}
+	n, cdfMin := len(vals), count(lo)
+	for v := range lut {
+		switch {
+		case n == cdfMin:
+			lut[v] = uint8(v)
+		case v >= lo:
+			lut[v] = uint8(math.Floor(float64(count(v)-cdfMin)*255/float64(n-cdfMin) + 0.5))
+		}
+	}
+	return lut
+}
+
+// claheReference : tables par tuile (histogramme écrêté développé en liste de valeurs),
+// puis interpolation bilinéaire en float64 entre les centres des tuiles
+func claheReference(src *image.RGBA, opts CLAHEOptions) *image.RGBA {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	gray, _ := Grayscale(src, 1, "rec601")
+
+	// plans : luminance ou canaux
+	planes := [][]uint8{make([]uint8, w*h)}
+	if opts.Mode == "rgb" {
+		planes = append(planes, make([]uint8, w*h), make([]uint8, w*h))
+	}
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := src.RGBAAt(b.Min.X+x, b.Min.Y+y)
+			if len(planes) == 1 {
+				planes[0][y*w+x] = gray.RGBAAt(b.Min.X+x, b.Min.Y+y).R
+			} else {
+				planes[0][y*w+x], planes[1][y*w+x], planes[2][y*w+x] = c.R, c.G, c.B
+			}
+		}
+	}
+
+	tx, ty := opts.TilesX, opts.TilesY
+	luts := make([][][256]uint8, len(planes))
+	for p, plane := range planes {
+		for t := 0; t < tx*ty; t++ {
+			x0, x1 := (t%tx)*w/tx, (t%tx+1)*w/tx
+			y0, y1 := (t/tx)*h/ty, (t/tx+1)*h/ty
+			var hist [256]int
+			for y := y0; y < y1; y++ {
+				for x := x0; x < x1; x++ {
+					hist[plane[y*w+x]]++
+				}
+			}
+			if opts.ClipLimit >= 1 {
+				limit := max(1, int(opts.ClipLimit*float64((x1-x0)*(y1-y0))/256))
+				excess := 0
+				for v := range hist {
+					excess += max(hist[v]-limit, 0)
+					hist[v] = min(hist[v], limit)
+				}
+				for v := range hist {
+					hist[v] += excess / 256
+					if v < excess%256 {
+						hist[v]++
+					}
+				}
+			}
+			var vals []int
+			for v, c := range hist {
+				for ; c > 0; c-- {
+					vals = append(vals, v)
+				}
+			}
+			luts[p] = append(luts[p], equalizeReference(vals))
+		}
+	}
+
+	// tuiles voisines et poids : centres des tuiles en (i + 0.5) * size / tiles
+	neighbours := func(pos, size, tiles int) (int, int, float64) {
+		t := (float64(pos)+0.5)*float64(tiles)/float64(size) - 0.5
+		t = min(max(t, 0), float64(tiles-1))
+		i := min(int(t), tiles-1)
+		return i, min(i+1, tiles-1), t - float64(i)
+	}
+
+	out := image.NewRGBA(b)
+	for y := 0; y < h; y++ {
+		ty0, ty1, fy := neighbours(y, h, ty)
+		for x := 0; x < w; x++ {
+			tx0, tx1, fx := neighbours(x, w, tx)
+			var after [3]int
+			for p, plane := range planes {
+				v := plane[y*w+x]
+				l := luts[p]
+				top := float64(l[ty0*tx+tx0][v])*(1-fx) + float64(l[ty0*tx+tx1][v])*fx
+				bottom := float64(l[ty1*tx+tx0][v])*(1-fx) + float64(l[ty1*tx+tx1][v])*fx
+				after[p] = int(math.Floor(top*(1-fy) + bottom*fy + 0.5))
+			}
+
+			c := src.RGBAAt(b.Min.X+x, b.Min.Y+y)
+			if len(planes) == 1 {
+				// luminance : R, G, B décalés de la même quantité
+				delta := after[0] - int(planes[0][y*w+x])
+				shift := func(v uint8) uint8 { return uint8(min(max(int(v)+delta, 0), 255)) }
+				c = color.RGBA{shift(c.R), shift(c.G), shift(c.B), 255}
+			} else {
+				c = color.RGBA{uint8(after[0]), uint8(after[1]), uint8(after[2]), 255}
+			}
+			out.SetRGBA(b.Min.X+x, b.Min.Y+y, c)
+		}
+	}
+	return out
+}
+
+// washedOut : image terne (valeurs 100..139) avec un peu de couleur
+func washedOut() *image.RGBA {
+	img := randomImage(37, 29, 28)
+	for i := 0; i < len(img.Pix); i += 4 {
+		for c := 0; c < 3; c++ {
+			img.Pix[i+c] = 100 + img.Pix[i+c]%40
+		}
+	}
+	return img
+}
+
+func TestEqualizeMatchesReference(t *testing.T) {
+	for _, src := range []*image.RGBA{washedOut(), randomImage(31, 22, 29)} {
+		for _, mode := range []string{"luma", "rgb"} {
+			want := claheReference(src, CLAHEOptions{TilesX: 1, TilesY: 1, Mode: mode})
+			for _, workers := range workerCounts {
+				// SubImage : Stride de l'entrée différent de celui de la sortie
+				for _, in := range []*image.RGBA{src, embedded(src)} {
+					got, err := Equalize(in, workers, mode)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if d := maxDiff(t, got, want); d != 0 {
+						t.Fatalf("mode %s, %d workers, stride %d : écart %d", mode, workers, in.Stride, d)
+					}
+				}
+			}
+		}
+	}
+
+	// l'image terne est étalée sur toute la plage
+	got, _ := Equalize(washedOut(), 2, "rgb")
+	if st := Stats(got, 1, 2); st.Red.Min != 0 || st.Red.Max != 255 {
+		t.Errorf("rouge égalisé : %d..%d, attendu 0..255", st.Red.Min, st.Red.Max)
+	}
+}
+
+func TestCLAHEMatchesReference(t *testing.T) {
+	src := washedOut()
+	grids := [][2]int{{1, 1}, {4, 3}, {8, 8}, {37, 2}}
+	for _, grid := range grids {
+		for _, clip := range []float64{0, 2, 4} {
+			for _, mode := range []string{"luma", "rgb"} {
+				opts := CLAHEOptions{TilesX: grid[0], TilesY: grid[1], ClipLimit: clip, Mode: mode}
+				want := claheReference(src, opts)
+				for _, workers := range workerCounts {
+					for _, in := range []*image.RGBA{src, embedded(src)} {
+						got, err := CLAHE(in, workers, opts)
+						if err != nil {
+							t.Fatal(err)
+						}
+						// interpolation en float32 côté filtre : arrondi à 1 près
+						if d := maxDiff(t, got, want); d > 1 {
+							t.Fatalf("%v, clip %g, mode %s, %d workers, stride %d : écart %d",
+								grid, clip, mode, workers, in.Stride, d)
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+// TestEqualizeHandValues : image 4x1. Rouge 10, 10, 20, 40 : cdf 2, 2, 3, 4, cdfMin 2,
+// soit (cdf - 2) x 255 / 2 arrondi = 0, 0, 128, 255 ; vert constant, inchangé ;
+// bleu 0, 100, 200, 255 : un pixel par valeur, donc 0, 85, 170, 255.
+func TestEqualizeHandValues(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 4, 1))
+	gray := image.NewRGBA(src.Bounds())
+	for x, c := range []color.RGBA{{10, 50, 0, 255}, {10, 50, 100, 255}, {20, 50, 200, 255}, {40, 50, 255, 255}} {
+		src.SetRGBA(x, 0, c)
+		gray.SetRGBA(x, 0, color.RGBA{c.R, c.R, c.R, 255})
+	}
+	check := func(name string, got *image.RGBA, want []color.RGBA) {
+		t.Helper()
+		for x, w := range want {
+			if c := got.RGBAAt(x, 0); c != w {
+				t.Errorf("%s : pixel %d = %v, attendu %v", name, x, c, w)
+			}
+		}
+	}
+
+	got, _ := Equalize(src, 2, "rgb")
+	check("rgb", got, []color.RGBA{{0, 50, 0, 255}, {0, 50, 85, 255}, {128, 50, 170, 255}, {255, 50, 255, 255}})
+
+	// pixels gris : la luminance est la valeur elle-même, décalée comme le rouge ci-dessus
+	got, _ = Equalize(gray, 2, "luma")
+	check("luma", got, []color.RGBA{{0, 0, 0, 255}, {0, 0, 0, 255}, {128, 128, 128, 255}, {255, 255, 255, 255}})
+
+	// écrêtage : limite max(1, 64 x 4 / 256) = 1, l'excédent du 10 va à la classe 0 ;
+	// cdf 1 (en 0), 2, 3, 4, cdfMin 1 : (cdf - 1) x 255 / 3 arrondi = 85, 85, 170, 255
+	got, _ = CLAHE(gray, 2, CLAHEOptions{TilesX: 1, TilesY: 1, ClipLimit: 64, Mode: "luma"})
+	check("clahe", got, []color.RGBA{{85, 85, 85, 255}, {85, 85, 85, 255}, {170, 170, 170, 255}, {255, 255, 255, 255}})
+}
+
+// TestEqualizeFlatAndErrors : une image unie ne change pas (sans écrêtage : l'excédent
+// réparti sur toutes les classes déplacerait la valeur) ; mode inconnu refusé
+func TestEqualizeFlatAndErrors(t *testing.T) {
+	flat := uniformImage(6, 4, 90, 120, 30, 255)
+	for _, mode := range []string{"luma", "rgb"} {
+		got, _ := Equalize(flat, 2, mode)
+		assertSame(t, got, flat)
+		got, _ = CLAHE(flat, 2, CLAHEOptions{TilesX: 2, TilesY: 2, Mode: mode})
+		assertSame(t, got, flat)
+	}
+	if _, err := Equalize(flat, 1, "hsv"); err == nil {
+		t.Error("mode hsv : erreur attendue")
+	}
+	if _, err := CLAHE(flat, 1, CLAHEOptions{Mode: "hsv"}); err == nil {
+		t.Error("CLAHE mode hsv : erreur attendue")
+	}
+}
@@ -0,0 +1,79 @@
+// helpers_test.go
+package main
+
+import (
+	"image"
+	"math/rand"
+	"testing"
+)
+
+// Outils communs aux tests : chaque chemin rapide est comparé à une référence naïve
+// sur de petites images.
+
+// randomImage : image RGBA aléatoire opaque ; les bornes ne commencent pas en (0, 0)
+// pour vérifier les calculs de PixOffset.
+func randomImage(w, h int, seed int64) *image.RGBA {
+	img := image.NewRGBA(image.Rect(3, 5, 3+w, 5+h))
+	r := rand.New(rand.NewSource(seed))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(r.Intn(256))
+	}
+	for i := 3; i < len(img.Pix); i += 4 {
+		img.Pix[i] = 255
+	}
+	return img
+}
+
+// embedded : copie de src au milieu d'une image plus grande, renvoyée en SubImage (mêmes
+// bornes, mais Stride plus grand : les offsets de src et d'une image neuve diffèrent)
+func embedded(src *image.RGBA) *image.RGBA {
+	b := src.Bounds()
+	big := image.NewRGBA(b.Inset(-4))
+	for i := range big.Pix {
+		big.Pix[i] = 77
+	}
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		copy(big.Pix[big.PixOffset(b.Min.X, y):big.PixOffset(b.Max.X, y)], src.Pix[src.PixOffset(b.Min.X, y):])
+	}
+	return big.SubImage(b).(*image.RGBA)
+}
+
+// uniformImage : image w x h d'une seule couleur
+func uniformImage(w, h int, r, g, b, a uint8) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for i := 0; i < len(img.Pix); i += 4 {
+		img.Pix[i+0], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3] = r, g, b, a
+	}
+	return img
+}
+
+// maxDiff : plus grand écart entre deux images de mêmes bornes, canal par canal
+func maxDiff(t *testing.T, got, want *image.RGBA) int {
+	t.Helper()
+	if got.Bounds() != want.Bounds() {
+		t.Fatalf("bornes %v, attendu %v", got.Bounds(), want.Bounds())
+	}
+	worst := 0
+	b := got.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			gi, wi := got.PixOffset(x, y), want.PixOffset(x, y)
+			for c := 0; c < 4; c++ {
+				d := int(got.Pix[gi+c]) - int(want.Pix[wi+c])
+				worst = max(worst, d, -d)
+			}
+		}
+	}
+	return worst
+}
+
+// assertSame échoue si les deux images diffèrent
+func assertSame(t *testing.T, got, want *image.RGBA) {
+	t.Helper()
+	if d := maxDiff(t, got, want); d != 0 {
+		t.Fatalf("images différentes (écart max %d)", d)
+	}
+}
+
+// workerCounts : nombres de workers essayés pour vérifier que le découpage ne change rien
+var workerCounts = []int{1, 3, 8}
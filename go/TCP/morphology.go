@@ -0,0 +1,289 @@
+// morphology.go
+package main
+
+import (
+	"fmt"
+	"image"
+	"strconv"
+	"strings"
+)
+
+// Morphologie mathématique en niveaux de gris (et donc binaire) : érosion, dilatation,
+// ouverture, fermeture, gradient, top-hat.
+// L'élément structurant est décomposé en une union de rectangles ; l'érosion par une union
+// est le minimum des érosions par chaque rectangle, et l'érosion par un rectangle est
+// séparable : une passe horizontale puis une passe verticale de van Herk/Gil-Werman,
+// 3 comparaisons par pixel quelle que soit la taille. Un carré coûte donc un rectangle,
+// une croix deux, un disque un par suite de lignes de même corde, soit O(r) rectangles
+// (d'où la limite maxMorphRadius).
+// La dilatation est l'érosion de l'image inversée par l'élément réfléchi.
+// Hors de l'image, les pixels sont neutres (ils ne font ni éroder ni dilater le bord).
+
+// maxMorphRadius : rayon maximal des éléments structurants (le disque coûte O(r) passes)
+const maxMorphRadius = 128
+
+// structElement : élément structurant sous forme de rectangles de décalages autour de
+// l'origine (Min inclus, Max exclu)
+type structElement struct {
+	rects []image.Rectangle
+}
+
+// newStructElement décompose le masque (origine en (ox, oy)) en une passe : chaque ligne est
+// découpée en segments, et un segment identique à un segment de la ligne précédente prolonge
+// son rectangle d'une ligne. Les rectangles obtenus sont disjoints.
+func newStructElement(mask [][]bool, ox, oy int) (structElement, error) {
+	var e structElement
+	open := map[[2]int]int{} // segment [x0, x1) -> rectangle qui finit à la ligne précédente
+	for y, row := range mask {
+		next := map[[2]int]int{}
+		for x := 0; x < len(row); x++ {
+			if !row[x] {
+				continue
+			}
+			x0 := x
+			for x+1 < len(row) && row[x+1] {
+				x++
+			}
+			span := [2]int{x0, x + 1}
+			if i, ok := open[span]; ok {
+				e.rects[i].Max.Y++
+				next[span] = i
+			} else {
+				next[span] = len(e.rects)
+				e.rects = append(e.rects, image.Rect(x0-ox, y-oy, x+1-ox, y+1-oy))
+			}
+		}
+		open = next
+	}
+	if len(e.rects) == 0 {
+		return structElement{}, fmt.Errorf("élément structurant vide")
+	}
+	return e, nil
+}
+
+// reflect renvoie l'élément symétrique par rapport à l'origine
+func (e structElement) reflect() structElement {
+	out := structElement{rects: make([]image.Rectangle, len(e.rects))}
+	for i, r := range e.rects {
+		out.rects[i] = image.Rect(-r.Max.X+1, -r.Max.Y+1, -r.Min.X+1, -r.Min.Y+1)
+	}
+	return out
+}
+
+// structuringElement construit l'élément : square, disk, cross (rayon radius, taille
+// 2 x radius + 1) ou custom ("1,0,1|0,1,0|..." : lignes séparées par '|', origine au centre).
+func structuringElement(shape string, radius int, custom string) (structElement, error) {
+	if shape == "custom" {
+		var mask [][]bool
+		for _, line := range strings.Split(custom, "|") {
+			var row []bool
+			for _, f := range strings.FieldsFunc(line, func(r rune) bool { return r == ',' || r == ' ' }) {
+				v, err := strconv.Atoi(f)
+				if err != nil || (v != 0 && v != 1) {
+					return structElement{}, fmt.Errorf("élément: valeur invalide %q (0 ou 1)", f)
+				}
+				row = append(row, v == 1)
+			}
+			if len(mask) > 0 && len(row) != len(mask[0]) {
+				return structElement{}, fmt.Errorf("élément: lignes de longueurs différentes")
+			}
+			mask = append(mask, row)
+		}
+		if len(mask) == 0 || len(mask[0]) == 0 {
+			return structElement{}, fmt.Errorf("élément manquant (paramètre element)")
+		}
+		if size := 2*maxMorphRadius + 1; len(mask) > size || len(mask[0]) > size {
+			return structElement{}, fmt.Errorf("élément trop grand: %dx%d (max %dx%d)", len(mask[0]), len(mask), size, size)
+		}
+		return newStructElement(mask, len(mask[0])/2, len(mask)/2)
+	}
+
+	if radius < 1 {
+		radius = 1
+	}
+	if radius > maxMorphRadius {
+		return structElement{}, fmt.Errorf("élément: rayon %d trop grand (max %d)", radius, maxMorphRadius)
+	}
+	switch shape {
+	case "", "square":
+		return structElement{rects: []image.Rectangle{image.Rect(-radius, -radius, radius+1, radius+1)}}, nil
+	case "cross":
+		return structElement{rects: []image.Rectangle{
+			image.Rect(-radius, 0, radius+1, 1),
+			image.Rect(0, -radius, 1, radius+1),
+		}}, nil
+	case "disk":
+		mask := make([][]bool, 2*radius+1)
+		for y := range mask {
+			mask[y] = make([]bool, 2*radius+1)
+			dy := y - radius
+			for x := range mask[y] {
+				dx := x - radius
+				mask[y][x] = dx*dx+dy*dy <= radius*radius+radius
+			}
+		}
+		return newStructElement(mask, radius, radius)
+	default:
+		return structElement{}, fmt.Errorf("élément inconnu: %q (square, disk, cross, custom)", shape)
+	}
+}
+
+// vhgwMin : out[i] = min(line[i+a .. i+b]) (van Herk/Gil-Werman), 255 hors de la ligne.
+// La ligne étendue est découpée en blocs de la taille de la fenêtre : chaque fenêtre est
+// à cheval sur au plus deux blocs, son minimum est celui de la fin du premier bloc
+// (bwd) et du début du second (fwd). ext, fwd et bwd : len(line) + b - a éléments.
+func vhgwMin(line, out []uint8, a, b int, ext, fwd, bwd []uint8) {
+	n := len(line)
+	size := b - a + 1
+	m := n + size - 1
+
+	for k := 0; k < m; k++ {
+		if j := k + a; j >= 0 && j < n {
+			ext[k] = line[j]
+		} else {
+			ext[k] = 255
+		}
+	}
+	for k := 0; k < m; k++ {
+		if k%size == 0 {
+			fwd[k] = ext[k]
+		} else {
+			fwd[k] = min(fwd[k-1], ext[k])
+		}
+	}
+	for k := m - 1; k >= 0; k-- {
+		if k%size == size-1 || k == m-1 {
+			bwd[k] = ext[k]
+		} else {
+			bwd[k] = min(bwd[k+1], ext[k])
+		}
+	}
+	for i := 0; i < n; i++ {
+		out[i] = min(bwd[i], fwd[i+size-1])
+	}
+}
+
+// erodeRect : érosion par un rectangle, passe horizontale (lignes en parallèle par bandes)
+// puis verticale (colonnes réparties entre les workers)
+func erodeRect(plane []uint8, w, h int, r image.Rectangle, workers int) []uint8 {
+	tmp := make([]uint8, w*h)
+	forBands(image.Rect(0, 0, w, h), workers, func(startY, endY int) {
+		m := w + r.Dx() - 1
+		ext, fwd, bwd := make([]uint8, m), make([]uint8, m), make([]uint8, m)
+		for y := startY; y < endY; y++ {
+			vhgwMin(plane[y*w:(y+1)*w], tmp[y*w:(y+1)*w], r.Min.X, r.Max.X-1, ext, fwd, bwd)
+		}
+	})
+
+	out := make([]uint8, w*h)
+	forBands(image.Rect(0, 0, 1, w), workers, func(startX, endX int) {
+		m := h + r.Dy() - 1
+		ext, fwd, bwd := make([]uint8, m), make([]uint8, m), make([]uint8, m)
+		col, res := make([]uint8, h), make([]uint8, h)
+		for x := startX; x < endX; x++ {
+			for y := 0; y < h; y++ {
+				col[y] = tmp[y*w+x]
+			}
+			vhgwMin(col, res, r.Min.Y, r.Max.Y-1, ext, fwd, bwd)
+			for y := 0; y < h; y++ {
+				out[y*w+x] = res[y]
+			}
+		}
+	})
+	return out
+}
+
+// erodePlane : minimum des érosions par les rectangles de l'élément
+func erodePlane(plane []uint8, w, h int, e structElement, workers int) []uint8 {
+	out := erodeRect(plane, w, h, e.rects[0], workers)
+	for _, r := range e.rects[1:] {
+		next := erodeRect(plane, w, h, r, workers)
+		for i, v := range next {
+			out[i] = min(out[i], v)
+		}
+	}
+	return out
+}
+
+// invertPlane : 255 - v
+func invertPlane(plane []uint8) []uint8 {
+	out := make([]uint8, len(plane))
+	for i, v := range plane {
+		out[i] = 255 - v
+	}
+	return out
+}
+
+// dilatePlane : dilatation = érosion de l'inverse par l'élément réfléchi, inversée
+func dilatePlane(plane []uint8, w, h int, e structElement, workers int) []uint8 {
+	return invertPlane(erodePlane(invertPlane(plane), w, h, e.reflect(), workers))
+}
+
+// morphPlane applique l'opération op à un plan
+func morphPlane(plane []uint8, w, h int, op string, e structElement, workers int) ([]uint8, error) {
+	erode := func(p []uint8) []uint8 { return erodePlane(p, w, h, e, workers) }
+	dilate := func(p []uint8) []uint8 { return dilatePlane(p, w, h, e, workers) }
+	// diff : a - b, borné à 0
+	diff := func(a, b []uint8) []uint8 {
+		for i := range a {
+			a[i] = a[i] - min(a[i], b[i])
+		}
+		return a
+	}
+
+	switch op {
+	case "erode":
+		return erode(plane), nil
+	case "dilate":
+		return dilate(plane), nil
+	case "open":
+		return dilate(erode(plane)), nil
+	case "close":
+		return erode(dilate(plane)), nil
+	case "gradient":
+		return diff(dilate(plane), erode(plane)), nil
+	case "tophat":
+		return diff(append([]uint8(nil), plane...), dilate(erode(plane))), nil
+	case "blackhat":
+		return diff(erode(dilate(plane)), plane), nil
+	default:
+		return nil, fmt.Errorf("opération inconnue: %q (erode, dilate, open, close, gradient, tophat, blackhat)", op)
+	}
+}
+
+// Morphology applique l'opération sur la luminance (mode luma, sortie en gris : images
+// binaires ou en niveaux de gris) ou sur chaque canal (mode rgb).
+func Morphology(img image.Image, workers int, op string, e structElement, mode string) (*image.RGBA, error) {
+	src := toRGBA(img)
+	planes, err := contrastPlanes(src, workers, mode)
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := src.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	for p := range planes {
+		if planes[p], err = morphPlane(planes[p], w, h, op, e, workers); err != nil {
+			return nil, err
+		}
+	}
+
+	out := image.NewRGBA(bounds)
+	forBands(bounds, workers, func(startY, endY int) {
+		for y := startY; y < endY; y++ {
+			si := src.PixOffset(bounds.Min.X, y)
+			di := out.PixOffset(bounds.Min.X, y)
+			i := (y - bounds.Min.Y) * w
+			for x := 0; x < w; x++ {
+				for c := 0; c < 3; c++ {
+					out.Pix[di+c] = planes[c%len(planes)][i]
+				}
+				out.Pix[di+3] = src.Pix[si+3]
+				si += 4
+				di += 4
+				i++
+			}
+		}
+	})
+	return out, nil
+}
@@ -0,0 +1,326 @@
+// morphology_test.go
+package main
+
+import (
+	"image"
+	"image/color"
+	"math/rand"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// morphCase : élément structurant et masque équivalent (origine en ox, oy)
+type morphCase struct {
+	name   string
+	mask   [][]bool
+	ox, oy int
+	e      structElement
+}
+
+// shapeMask : masque attendu pour square, disk et cross
+func shapeMask(shape string, r int) [][]bool {
+	mask := make([][]bool, 2*r+1)
+	for y := range mask {
+		mask[y] = make([]bool, 2*r+1)
+		for x := range mask[y] {
+			dx, dy := x-r, y-r
+			switch shape {
+			case "square":
+				mask[y][x] = true
+			case "disk":
+				mask[y][x] = dx*dx+dy*dy <= r*r+r
+			case "cross":
+				mask[y][x] = dx == 0 || dy == 0
+			}
+		}
+	}
+	return mask
+}
+
+// morphCases : formes prédéfinies de plusieurs rayons et masques custom aléatoires
+// (trous, lignes vides, origine hors du masque)
+func morphCases(t *testing.T) []morphCase {
+	var cases []morphCase
+	for _, shape := range []string{"square", "disk", "cross"} {
+		for _, r := range []int{1, 2, 5, 9} {
+			e, err := structuringElement(shape, r, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			cases = append(cases, morphCase{shape, shapeMask(shape, r), r, r, e})
+		}
+	}
+
+	rng := rand.New(rand.NewSource(30))
+	for len(cases) < 12+20 {
+		mw, mh := 1+rng.Intn(6), 1+rng.Intn(6)
+		mask := make([][]bool, mh)
+		rows := make([]string, mh)
+		empty := true
+		for y := range mask {
+			mask[y] = make([]bool, mw)
+			fields := make([]string, mw)
+			for x := range mask[y] {
+				mask[y][x] = rng.Intn(2) == 0
+				empty = empty && !mask[y][x]
+				fields[x] = "0"
+				if mask[y][x] {
+					fields[x] = "1"
+				}
+			}
+			rows[y] = strings.Join(fields, ",")
+		}
+		if empty {
+			continue
+		}
+		spec := strings.Join(rows, "|")
+		e, err := structuringElement("custom", 0, spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cases = append(cases, morphCase{spec, mask, mw / 2, mh / 2, e})
+	}
+	return cases
+}
+
+// morphReference : minimum (ou maximum pour la dilatation, élément réfléchi) sur les
+// voisins du masque ; les voisins hors de l'image sont ignorés
+func morphReference(plane []uint8, w, h int, c morphCase, dilate bool) []uint8 {
+	out := make([]uint8, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			v := uint8(255)
+			if dilate {
+				v = 0
+			}
+			for my, row := range c.mask {
+				for mx, on := range row {
+					dx, dy := mx-c.ox, my-c.oy
+					if dilate {
+						dx, dy = -dx, -dy
+					}
+					sx, sy := x+dx, y+dy
+					if !on || sx < 0 || sy < 0 || sx >= w || sy >= h {
+						continue
+					}
+					if dilate {
+						v = max(v, plane[sy*w+sx])
+					} else {
+						v = min(v, plane[sy*w+sx])
+					}
+				}
+			}
+			out[y*w+x] = v
+		}
+	}
+	return out
+}
+
+// randomPlane : canal rouge d'une image aléatoire
+func randomPlane(w, h int, seed int64) []uint8 {
+	img := randomImage(w, h, seed)
+	plane := make([]uint8, w*h)
+	for i := range plane {
+		plane[i] = img.Pix[4*i]
+	}
+	return plane
+}
+
+// TestVHGWMinMatchesNaive : minimum glissant sur [i+a, i+b], 255 hors de la ligne
+func TestVHGWMinMatchesNaive(t *testing.T) {
+	line := randomPlane(23, 1, 31)
+	for a := -12; a <= 3; a++ {
+		for b := a; b <= a+30; b++ {
+			n := len(line) + b - a
+			ext, fwd, bwd := make([]uint8, n), make([]uint8, n), make([]uint8, n)
+			out := make([]uint8, len(line))
+			vhgwMin(line, out, a, b, ext, fwd, bwd)
+			for i := range line {
+				want := uint8(255)
+				for j := max(i+a, 0); j <= min(i+b, len(line)-1); j++ {
+					want = min(want, line[j])
+				}
+				if out[i] != want {
+					t.Fatalf("[%d, %d], i=%d : %d, attendu %d", a, b, i, out[i], want)
+				}
+			}
+		}
+	}
+}
+
+func TestErodeDilateMatchesNaive(t *testing.T) {
+	w, h := 37, 29
+	plane := randomPlane(w, h, 32)
+	for _, c := range morphCases(t) {
+		erode, dilate := morphReference(plane, w, h, c, false), morphReference(plane, w, h, c, true)
+		for _, workers := range workerCounts {
+			if got := erodePlane(plane, w, h, c.e, workers); string(got) != string(erode) {
+				t.Fatalf("%s, %d workers : érosion différente", c.name, workers)
+			}
+			if got := dilatePlane(plane, w, h, c.e, workers); string(got) != string(dilate) {
+				t.Fatalf("%s, %d workers : dilatation différente", c.name, workers)
+			}
+		}
+	}
+}
+
+// TestMorphologyOps : opérations composées, en luminance et par canal, contre les
+// références d'érosion et de dilatation
+func TestMorphologyOps(t *testing.T) {
+	src := randomImage(31, 19, 33)
+	for i := 3; i < len(src.Pix); i += 16 {
+		src.Pix[i] = 128 // alpha conservé tel quel
+	}
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	gray, _ := Grayscale(src, 1, "rec601")
+	c := morphCases(t)[5] // disque de rayon 2
+
+	sub := func(a, b []uint8) []uint8 {
+		out := make([]uint8, len(a))
+		for i := range a {
+			out[i] = a[i] - min(a[i], b[i])
+		}
+		return out
+	}
+	ops := map[string]func(p []uint8) []uint8{
+		"erode":  func(p []uint8) []uint8 { return morphReference(p, w, h, c, false) },
+		"dilate": func(p []uint8) []uint8 { return morphReference(p, w, h, c, true) },
+	}
+	ops["open"] = func(p []uint8) []uint8 { return ops["dilate"](ops["erode"](p)) }
+	ops["close"] = func(p []uint8) []uint8 { return ops["erode"](ops["dilate"](p)) }
+	ops["gradient"] = func(p []uint8) []uint8 { return sub(ops["dilate"](p), ops["erode"](p)) }
+	ops["tophat"] = func(p []uint8) []uint8 { return sub(p, ops["open"](p)) }
+	ops["blackhat"] = func(p []uint8) []uint8 { return sub(ops["close"](p), p) }
+
+	for op, ref := range ops {
+		for _, mode := range []string{"luma", "rgb"} {
+			// plans lus pixel par pixel : luminance, ou R, G, B
+			planes := make([][]uint8, 3)
+			for y := 0; y < h; y++ {
+				for x := 0; x < w; x++ {
+					px := src.RGBAAt(b.Min.X+x, b.Min.Y+y)
+					vals := []uint8{px.R, px.G, px.B}
+					if mode == "luma" {
+						l := gray.RGBAAt(b.Min.X+x, b.Min.Y+y).R
+						vals = []uint8{l, l, l}
+					}
+					for p := range planes {
+						planes[p] = append(planes[p], vals[p])
+					}
+				}
+			}
+			for p := range planes {
+				planes[p] = ref(planes[p])
+			}
+			want := image.NewRGBA(b)
+			for i := range planes[0] {
+				want.Pix[4*i], want.Pix[4*i+1], want.Pix[4*i+2], want.Pix[4*i+3] =
+					planes[0][i], planes[1][i], planes[2][i], src.Pix[4*i+3]
+			}
+
+			for _, workers := range workerCounts {
+				got, err := Morphology(src, workers, op, c.e, mode)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if d := maxDiff(t, got, want); d != 0 {
+					t.Fatalf("%s, mode %s, %d workers : écart %d", op, mode, workers, d)
+				}
+			}
+			// SubImage : Stride de l'entrée différent de celui de la sortie
+			got, _ := Morphology(embedded(src), 3, op, c.e, mode)
+			if d := maxDiff(t, got, want); d != 0 {
+				t.Fatalf("%s, mode %s, SubImage : écart %d", op, mode, d)
+			}
+		}
+	}
+}
+
+func TestStructuringElement(t *testing.T) {
+	// carré : un rectangle ; croix : deux ; disque : un par suite de lignes de même corde
+	// (cordes 3, 5, 5, 5, 3 au rayon 2)
+	for _, c := range []struct {
+		shape string
+		want  []image.Rectangle
+	}{
+		{"square", []image.Rectangle{image.Rect(-2, -2, 3, 3)}},
+		{"cross", []image.Rectangle{image.Rect(-2, 0, 3, 1), image.Rect(0, -2, 1, 3)}},
+		{"disk", []image.Rectangle{image.Rect(-1, -2, 2, -1), image.Rect(-2, -1, 3, 2), image.Rect(-1, 2, 2, 3)}},
+	} {
+		e, err := structuringElement(c.shape, 2, "")
+		if err != nil || !slices.Equal(e.rects, c.want) {
+			t.Errorf("%s rayon 2 : %v (%v), attendu %v", c.shape, e.rects, err, c.want)
+		}
+	}
+	// O(r) rectangles pour le disque, même au rayon maximal
+	if e, _ := structuringElement("disk", maxMorphRadius, ""); len(e.rects) > 2*maxMorphRadius+1 {
+		t.Errorf("disque rayon %d : %d rectangles", maxMorphRadius, len(e.rects))
+	}
+	big := strings.TrimSuffix(strings.Repeat("1|", 2*maxMorphRadius+2), "|")
+
+	for _, c := range []struct {
+		shape, custom string
+		radius        int
+	}{
+		{"star", "", 2},
+		{"custom", "", 2},
+		{"custom", "1,2|0,1", 2},
+		{"custom", "1,0|1", 2},
+		{"custom", "0,0|0,0", 2},
+		{"custom", big, 2},
+		{"square", "", maxMorphRadius + 1},
+	} {
+		if _, err := structuringElement(c.shape, c.radius, c.custom); err == nil {
+			t.Errorf("%s %.20q, rayon %d : erreur attendue", c.shape, c.custom, c.radius)
+		}
+	}
+
+	e, _ := structuringElement("square", 1, "")
+	if _, err := Morphology(randomImage(4, 4, 34), 1, "thin", e, "luma"); err == nil {
+		t.Error("opération thin : erreur attendue")
+	}
+}
+
+// TestMorphologyHandValues : fond 50 avec un point à 200 au centre d'une image 5x5 ;
+// la fenêtre est réduite à l'image au bord
+func TestMorphologyHandValues(t *testing.T) {
+	src := uniformImage(5, 5, 50, 50, 50, 255)
+	src.SetRGBA(2, 2, color.RGBA{200, 200, 200, 255})
+
+	// grilles attendues, une chaîne par ligne : '.' = fond, 'X' = valeur v
+	cases := []struct {
+		op, shape string
+		bg, v     uint8
+		grid      []string
+	}{
+		{"dilate", "cross", 50, 200, []string{".....", "..X..", ".XXX.", "..X..", "....."}},
+		{"dilate", "square", 50, 200, []string{".....", ".XXX.", ".XXX.", ".XXX.", "....."}},
+		{"erode", "cross", 50, 50, []string{".....", ".....", ".....", ".....", "....."}},
+		{"gradient", "cross", 0, 150, []string{".....", "..X..", ".XXX.", "..X..", "....."}},
+		{"tophat", "square", 0, 150, []string{".....", ".....", "..X..", ".....", "....."}},
+		{"close", "square", 50, 200, []string{".....", ".....", "..X..", ".....", "....."}},
+	}
+	for _, c := range cases {
+		e, err := structuringElement(c.shape, 1, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := Morphology(src, 2, c.op, e, "rgb")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for y, row := range c.grid {
+			for x := range row {
+				want := c.bg
+				if row[x] == 'X' {
+					want = c.v
+				}
+				if px := got.RGBAAt(x, y); px != (color.RGBA{want, want, want, 255}) {
+					t.Errorf("%s %s : (%d, %d) = %v, attendu %d", c.op, c.shape, x, y, px, want)
+				}
+			}
+		}
+	}
+}
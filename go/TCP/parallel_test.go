@@ -0,0 +1,401 @@
+// parallel_test.go
+package main
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"slices"
+	"testing"
+)
+
+// testBorders : un bord de chaque mode
+var testBorders = []Border{
+	{Mode: BorderClamp},
+	{Mode: BorderMirror},
+	{Mode: BorderWrap},
+	{Mode: BorderConstant, Color: color.RGBA{200, 10, 90, 255}},
+}
+
+// medianReference : fenêtre triée pour chaque pixel
+func medianReference(src *image.RGBA, radius, percentile int, border Border) *image.RGBA {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	size := 2*radius + 1
+	rank := percentile * (size*size - 1) / 100
+	out := image.NewRGBA(b)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var win [3][]uint8
+			for dy := -radius; dy <= radius; dy++ {
+				for dx := -radius; dx <= radius; dx++ {
+					sx, sy := border.index(x+dx, w), border.index(y+dy, h)
+					c := border.Color
+					if sx >= 0 && sy >= 0 {
+						c = src.RGBAAt(b.Min.X+sx, b.Min.Y+sy)
+					}
+					win[0], win[1], win[2] = append(win[0], c.R), append(win[1], c.G), append(win[2], c.B)
+				}
+			}
+			for c := range win {
+				slices.Sort(win[c])
+			}
+			out.SetRGBA(b.Min.X+x, b.Min.Y+y, color.RGBA{win[0][rank], win[1][rank], win[2][rank], 255})
+		}
+	}
+	return out
+}
+
+// TestMedianFilterMatchesSort : histogramme glissant (Huang) pour les petites fenêtres,
+// histogrammes de colonnes (Perreault–Hébert) au-delà de medianColumnThreshold.
+func TestMedianFilterMatchesSort(t *testing.T) {
+	src := randomImage(23, 15, 20)
+	cases := []struct {
+		radius      int
+		percentiles []int
+	}{
+		{1, []int{0, 25, 50, 100}},
+		{3, []int{0, 25, 50, 100}},
+		{medianColumnThreshold/2 + 1, []int{10, 50}},
+	}
+	for _, border := range testBorders {
+		for _, c := range cases {
+			for _, percentile := range c.percentiles {
+				want := medianReference(src, c.radius, percentile, border)
+				for _, workers := range workerCounts {
+					got := MedianFilter(src, workers, c.radius, percentile, border)
+					if d := maxDiff(t, got, want); d != 0 {
+						t.Fatalf("bord %d, rayon %d, percentile %d, %d workers : écart %d",
+							border.Mode, c.radius, percentile, workers, d)
+					}
+				}
+			}
+		}
+	}
+}
+
+// TestMedianFilterRemovesImpulses : un pixel isolé disparaît avec la médiane 3x3
+func TestMedianFilterRemovesImpulses(t *testing.T) {
+	src := uniformImage(9, 9, 100, 100, 100, 255)
+	src.SetRGBA(4, 4, color.RGBA{255, 0, 255, 255})
+	assertSame(t, MedianFilter(src, 2, 1, 50, Border{}), uniformImage(9, 9, 100, 100, 100, 255))
+}
+
+// blurReference : moyenne directe de la fenêtre (valeurs 16 bits, comme Blur) ; en
+// BorderShrink, moyenne des seuls pixels de la fenêtre qui sont dans l'image
+func blurReference(src *image.RGBA, radius int, border Border, linear bool) *image.RGBA {
+	dec, enc := lightTables(linear)
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	out := image.NewRGBA(b)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var sum [3]uint64
+			var count uint64
+			for dy := -radius; dy <= radius; dy++ {
+				for dx := -radius; dx <= radius; dx++ {
+					if border.Mode == BorderShrink && !image.Pt(x+dx, y+dy).In(image.Rect(0, 0, w, h)) {
+						continue
+					}
+					count++
+					sx := naiveBorderIndex(border.Mode, x+dx, w)
+					sy := naiveBorderIndex(border.Mode, y+dy, h)
+					c := border.Color
+					if sx >= 0 && sy >= 0 {
+						c = src.RGBAAt(b.Min.X+sx, b.Min.Y+sy)
+					}
+					sum[0] += uint64(dec[c.R])
+					sum[1] += uint64(dec[c.G])
+					sum[2] += uint64(dec[c.B])
+				}
+			}
+			out.SetRGBA(b.Min.X+x, b.Min.Y+y, color.RGBA{enc[sum[0]/count], enc[sum[1]/count], enc[sum[2]/count], 255})
+		}
+	}
+	return out
+}
+
+// TestBlurMatchesNaive : sommes glissantes séparables, pour chaque mode de bord, y compris
+// des rayons plus grands que l'image
+func TestBlurMatchesNaive(t *testing.T) {
+	src := randomImage(17, 11, 22)
+	for _, border := range append(testBorders, Border{Mode: BorderShrink}) {
+		for _, radius := range []int{1, 4, 20} {
+			for _, linear := range []bool{false, true} {
+				want := blurReference(src, radius, border, linear)
+				for _, workers := range workerCounts {
+					got := Blur(src, workers, radius, border, linear)
+					if d := maxDiff(t, got, want); d != 0 {
+						t.Fatalf("bord %d, rayon %d, linear=%t, %d workers : écart %d",
+							border.Mode, radius, linear, workers, d)
+					}
+				}
+			}
+		}
+	}
+}
+
+// sobelReference : gradient 3x3 direct en float64 sur la luminance Rec.601, noyaux écrits à la main
+func sobelReference(src *image.RGBA, border Border, operator string) (gx, gy []float64) {
+	kx := map[string][3][3]float64{
+		"sobel":   {{-1, 0, 1}, {-2, 0, 2}, {-1, 0, 1}},
+		"scharr":  {{-3, 0, 3}, {-10, 0, 10}, {-3, 0, 3}},
+		"prewitt": {{-1, 0, 1}, {-1, 0, 1}, {-1, 0, 1}},
+	}[operator]
+	// magnitude ramenée à l'échelle de Sobel (somme des poids positifs = 4)
+	scale := map[string]float64{"sobel": 1, "scharr": 4.0 / 16, "prewitt": 4.0 / 3}[operator]
+
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	lum := func(c color.RGBA) float64 { return 0.299*float64(c.R) + 0.587*float64(c.G) + 0.114*float64(c.B) }
+	gx, gy = make([]float64, w*h), make([]float64, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			for dy := -1; dy <= 1; dy++ {
+				for dx := -1; dx <= 1; dx++ {
+					sx, sy := naiveBorderIndex(border.Mode, x+dx, w), naiveBorderIndex(border.Mode, y+dy, h)
+					c := border.Color
+					if sx >= 0 && sy >= 0 {
+						c = src.RGBAAt(b.Min.X+sx, b.Min.Y+sy)
+					}
+					// gy : transposée de gx, positive quand le haut est plus clair
+					gx[y*w+x] += lum(c) * kx[dy+1][dx+1] * scale
+					gy[y*w+x] -= lum(c) * kx[dx+1][dy+1] * scale
+				}
+			}
+		}
+	}
+	return gx, gy
+}
+
+// TestSobelMatchesReference : magnitude, seuil et direction contre la convolution directe,
+// pour chaque opérateur et chaque mode de bord
+func TestSobelMatchesReference(t *testing.T) {
+	src := randomImage(19, 13, 30)
+	b := src.Bounds()
+	for _, operator := range []string{"sobel", "scharr", "prewitt"} {
+		for _, border := range testBorders {
+			gx, gy := sobelReference(src, border, operator)
+			magnitude := image.NewRGBA(b)
+			for i := range gx {
+				m := uint8(math.Min(255, math.Hypot(gx[i], gy[i])))
+				magnitude.SetRGBA(b.Min.X+i%b.Dx(), b.Min.Y+i/b.Dx(), color.RGBA{m, m, m, 255})
+			}
+
+			for _, workers := range workerCounts {
+				got, err := Sobel(src, workers, border, SobelOptions{Operator: operator})
+				if err != nil {
+					t.Fatal(err)
+				}
+				// gradient en float32 côté filtre : troncature à 1 près
+				if d := maxDiff(t, got, magnitude); d > 1 {
+					t.Errorf("%s, bord %d, %d workers : écart %d", operator, border.Mode, workers, d)
+				}
+
+				// seuil : blanc exactement là où la magnitude (tronquée) atteint le seuil
+				thresholded, _ := Sobel(src, workers, border, SobelOptions{Operator: operator, Threshold: 100})
+				for i := 0; i < len(got.Pix); i += 4 {
+					want := uint8(0)
+					if got.Pix[i] >= 100 {
+						want = 255
+					}
+					if thresholded.Pix[i] != want || thresholded.Pix[i+1] != want || thresholded.Pix[i+2] != want {
+						t.Fatalf("%s, seuil 100 : pixel %d = %d pour une magnitude %d", operator, i/4, thresholded.Pix[i], got.Pix[i])
+					}
+				}
+			}
+		}
+	}
+}
+
+// TestSobelHandValues : marches de contraste 30, gradient 4 x 30 = 120 pour les trois
+// opérateurs ; la direction code l'orientation du gradient en teinte
+func TestSobelHandValues(t *testing.T) {
+	vertical := uniformImage(8, 6, 100, 100, 100, 255)   // sombre à gauche, clair à droite
+	horizontal := uniformImage(8, 6, 100, 100, 100, 255) // clair en haut, sombre en bas
+	for y := 0; y < 6; y++ {
+		for x := 0; x < 8; x++ {
+			if x >= 4 {
+				vertical.SetRGBA(x, y, color.RGBA{130, 130, 130, 255})
+			}
+			if y < 3 {
+				horizontal.SetRGBA(x, y, color.RGBA{130, 130, 130, 255})
+			}
+		}
+	}
+	diff := func(a, b uint8) int { return max(int(a)-int(b), int(b)-int(a)) }
+	// pixel de la marche ou non
+	onEdge := func(img *image.RGBA, x, y int) bool {
+		if img == vertical {
+			return x == 3 || x == 4
+		}
+		return y == 2 || y == 3
+	}
+
+	for _, c := range []struct {
+		img  *image.RGBA
+		edge color.RGBA // couleur attendue sur la marche en sortie direction
+	}{
+		{vertical, color.RGBA{120, 0, 0, 255}},    // gradient vers la droite : teinte 0, rouge
+		{horizontal, color.RGBA{60, 120, 0, 255}}, // gradient vers le haut : teinte 90
+	} {
+		for _, operator := range []string{"sobel", "scharr", "prewitt"} {
+			mag, _ := Sobel(c.img, 2, Border{}, SobelOptions{Operator: operator})
+			dir, _ := Sobel(c.img, 2, Border{}, SobelOptions{Operator: operator, Direction: true})
+			low, _ := Sobel(c.img, 2, Border{}, SobelOptions{Operator: operator, Threshold: 119})
+			high, _ := Sobel(c.img, 2, Border{}, SobelOptions{Operator: operator, Threshold: 121})
+			for y := 0; y < 6; y++ {
+				for x := 0; x < 8; x++ {
+					wantMag, wantDir, wantLow := color.RGBA{0, 0, 0, 255}, color.RGBA{0, 0, 0, 255}, color.RGBA{0, 0, 0, 255}
+					if onEdge(c.img, x, y) {
+						wantMag, wantDir, wantLow = color.RGBA{120, 120, 120, 255}, c.edge, color.RGBA{255, 255, 255, 255}
+					}
+					for _, check := range []struct {
+						name      string
+						got, want color.RGBA
+					}{
+						{"magnitude", mag.RGBAAt(x, y), wantMag},
+						{"direction", dir.RGBAAt(x, y), wantDir},
+						{"seuil 119", low.RGBAAt(x, y), wantLow},
+						{"seuil 121", high.RGBAAt(x, y), color.RGBA{0, 0, 0, 255}},
+					} {
+						if d := max(diff(check.got.R, check.want.R), diff(check.got.G, check.want.G), diff(check.got.B, check.want.B)); d > 1 {
+							t.Errorf("%s, %s (%d, %d) : %v, attendu %v", operator, check.name, x, y, check.got, check.want)
+						}
+					}
+				}
+			}
+		}
+	}
+
+	// contour isoluminant (rouge / vert de même luminance) : rien à détecter
+	iso := uniformImage(8, 6, 255, 0, 0, 255)
+	for y := 0; y < 6; y++ {
+		for x := 4; x < 8; x++ {
+			iso.SetRGBA(x, y, color.RGBA{0, 130, 0, 255}) // 0.587 x 130 = 76.3, 0.299 x 255 = 76.2
+		}
+	}
+	out, _ := Sobel(iso, 2, Border{}, SobelOptions{})
+	assertSame(t, out, uniformImage(8, 6, 0, 0, 0, 255))
+
+	if _, err := Sobel(iso, 1, Border{}, SobelOptions{Operator: "roberts"}); err == nil {
+		t.Error("opérateur roberts : erreur attendue")
+	}
+}
+
+// TestGrayscaleModes : chaque mode contre sa formule, en 16 bits comme RGBA() ; average doit
+// rester exactement l'ancien (r+g+b)/3, et une *image.Gray est recopiée telle quelle
+func TestGrayscaleModes(t *testing.T) {
+	src := randomImage(23, 17, 35)
+	closed := map[string]func(r, g, b float64) float64{
+		"rec601":    func(r, g, b float64) float64 { return 0.299*r + 0.587*g + 0.114*b },
+		"rec709":    func(r, g, b float64) float64 { return 0.2126*r + 0.7152*g + 0.0722*b },
+		"average":   func(r, g, b float64) float64 { return math.Floor((r + g + b) / 3) },
+		"lightness": func(r, g, b float64) float64 { return math.Floor((max(r, g, b) + min(r, g, b)) / 2) },
+		"red":       func(r, g, b float64) float64 { return r },
+		"green":     func(r, g, b float64) float64 { return g },
+		"blue":      func(r, g, b float64) float64 { return b },
+		"linear": func(r, g, b float64) float64 {
+			y := 0.2126*srgbToLinear(r/65535) + 0.7152*srgbToLinear(g/65535) + 0.0722*srgbToLinear(b/65535)
+			return linearToSRGB(y) * 65535
+		},
+	}
+	// modes entiers exacts ; pondérés : poids arrondis à 1/65536 ou tables, 1 près
+	exact := map[string]bool{"average": true, "lightness": true, "red": true, "green": true, "blue": true}
+
+	for mode, f := range closed {
+		want := image.NewRGBA(src.Bounds())
+		for i := 0; i < len(src.Pix); i += 4 {
+			r, g, b := float64(src.Pix[i])*0x101, float64(src.Pix[i+1])*0x101, float64(src.Pix[i+2])*0x101
+			v := uint8(int(math.Round(f(r, g, b))) >> 8)
+			want.Pix[i], want.Pix[i+1], want.Pix[i+2], want.Pix[i+3] = v, v, v, 255
+		}
+		for _, workers := range workerCounts {
+			got, err := Grayscale(src, workers, mode)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if d := maxDiff(t, got, want); d > 1 || (exact[mode] && d != 0) {
+				t.Errorf("%s, %d workers : écart %d", mode, workers, d)
+			}
+		}
+	}
+
+	// valeurs calculées à la main pour un rouge pur et un gris moyen
+	for _, c := range []struct {
+		mode      string
+		red, gray uint8
+	}{
+		{"rec601", 76, 128},     // 0.299 x 255 = 76.2
+		{"rec709", 54, 128},     // 0.2126 x 255 = 54.2
+		{"average", 85, 128},    // 255 / 3
+		{"lightness", 127, 128}, // (65535 + 0) / 2 = 32767 -> 127
+		{"red", 255, 128},
+		{"green", 0, 128},
+		{"linear", 127, 128}, // 1.055 x 0.2126^(1/2.4) - 0.055 = 0.4985
+	} {
+		img := uniformImage(2, 2, 255, 0, 0, 255)
+		img.SetRGBA(1, 1, color.RGBA{128, 128, 128, 255})
+		got, _ := Grayscale(img, 1, c.mode)
+		if r, g := got.RGBAAt(0, 0), got.RGBAAt(1, 1); r.R != c.red || g.R != c.gray {
+			t.Errorf("%s : rouge %d, gris %d, attendu %d et %d", c.mode, r.R, g.R, c.red, c.gray)
+		}
+	}
+
+	// *image.Gray : tous les modes rendent la valeur d'origine
+	gray := image.NewGray(image.Rect(0, 0, 16, 16))
+	for i := range gray.Pix {
+		gray.Pix[i] = uint8(i)
+	}
+	for mode := range closed {
+		got, _ := Grayscale(gray, 3, mode)
+		for i, v := range gray.Pix {
+			if c := got.RGBAAt(i%16, i/16); c != (color.RGBA{v, v, v, 255}) {
+				t.Fatalf("%s, gris %d : %v", mode, v, c)
+			}
+		}
+	}
+
+	if _, err := Grayscale(src, 1, "luma"); err == nil {
+		t.Error("mode luma : erreur attendue")
+	}
+}
+
+// TestPixelateAverage : sans linear, moyenne entière des valeurs 8 bits du bloc (comme avant
+// l'option linear) ; avec linear, moyenne en lumière linéaire
+func TestPixelateAverage(t *testing.T) {
+	src := randomImage(10, 7, 36)
+	want := image.NewRGBA(src.Bounds())
+	b := src.Bounds()
+	for by := b.Min.Y; by < b.Max.Y; by += 3 {
+		for bx := b.Min.X; bx < b.Max.X; bx += 3 {
+			var sum [3]int
+			n := 0
+			for y := by; y < min(by+3, b.Max.Y); y++ {
+				for x := bx; x < min(bx+3, b.Max.X); x++ {
+					c := src.RGBAAt(x, y)
+					sum[0], sum[1], sum[2] = sum[0]+int(c.R), sum[1]+int(c.G), sum[2]+int(c.B)
+					n++
+				}
+			}
+			for y := by; y < min(by+3, b.Max.Y); y++ {
+				for x := bx; x < min(bx+3, b.Max.X); x++ {
+					want.SetRGBA(x, y, color.RGBA{uint8(sum[0] / n), uint8(sum[1] / n), uint8(sum[2] / n), 255})
+				}
+			}
+		}
+	}
+	assertSame(t, Pixelate(src, 1, 3, false), want)
+
+	// bloc 254 / 255 : 509 / 2 = 254 en 8 bits (les tables 16 bits donneraient 255) ;
+	// noir / blanc : 127 en sRGB, 188 en lumière linéaire (0.5 encodé en sRGB = 0.7354)
+	pair := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	pair.SetRGBA(0, 0, color.RGBA{254, 0, 0, 255})
+	pair.SetRGBA(1, 0, color.RGBA{255, 255, 255, 255})
+	if c := Pixelate(pair, 1, 2, false).RGBAAt(0, 0); c != (color.RGBA{254, 127, 127, 255}) {
+		t.Errorf("sRGB : %v, attendu {254 127 127 255}", c)
+	}
+	if c := Pixelate(pair, 1, 2, true).RGBAAt(1, 0); c.G != 188 {
+		t.Errorf("linéaire : %v, attendu 188 en vert", c)
+	}
+}
@@ -0,0 +1,104 @@
+// params_test.go
+package main
+
+import (
+	"image/color"
+	"strings"
+	"testing"
+)
+
+func TestParamReader(t *testing.T) {
+	params, err := parseParams("n=-3; x=0.25;on=TRUE;c=#ff8000;empty=;Mode=Sobel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := params.reader()
+	if n := p.Int("n", 1); n != -3 {
+		t.Errorf("n : %d, attendu -3", n)
+	}
+	if x := p.Float("x", 1); x != 0.25 {
+		t.Errorf("x : %g, attendu 0.25", x)
+	}
+	if on := p.Bool("on", false); !on {
+		t.Error("on : false, attendu true")
+	}
+	if c := p.Color("c", color.RGBA{}); c != (color.RGBA{255, 128, 0, 255}) {
+		t.Errorf("c : %v", c)
+	}
+	if n := p.Int("absent", 7); n != 7 {
+		t.Errorf("absent : %d, attendu 7", n)
+	}
+	if s := p.String("mode", "x"); s != "sobel" {
+		t.Errorf("mode : %q, attendu sobel", s)
+	}
+	if p.err != nil {
+		t.Fatalf("erreur inattendue : %v", p.err)
+	}
+
+	// valeur mal formée : valeur par défaut et première erreur gardée
+	for _, read := range []func(p *paramReader){
+		func(p *paramReader) { p.Int("empty", 0) },
+		func(p *paramReader) { p.Int("x", 0) },
+		func(p *paramReader) { p.Float("mode", 0) },
+		func(p *paramReader) { p.Bool("n", false) },
+		func(p *paramReader) { p.Color("x", color.RGBA{}) },
+	} {
+		p := params.reader()
+		read(p)
+		if p.err == nil {
+			t.Error("valeur mal formée : erreur attendue")
+		}
+	}
+	p = params.reader()
+	p.Float("mode", 0)
+	p.Int("x", 0)
+	if p.err == nil || !strings.Contains(p.err.Error(), "mode") {
+		t.Errorf("première erreur attendue (mode), obtenu %v", p.err)
+	}
+}
+
+// TestApplyFilterRejectsMalformedParams : une valeur mal formée est une erreur de requête,
+// pas un retour silencieux à la valeur par défaut
+func TestApplyFilterRejectsMalformedParams(t *testing.T) {
+	src := randomImage(8, 6, 1)
+	cases := []struct{ name, params string }{
+		{"median", "percentile=5o"},
+		{"blur", "linear=oui"},
+		{"blur", "border=constant;bordercolor=bad"},
+		{"sobel", "threshold=abc"},
+		{"canny", "high=1e"},
+		{"rotate", "background=1,2"},
+		{"resize", "width=abc"},
+		{"crop", "x=1.5"},
+		{"quantize", "colors=seize"},
+		{"dither", "palette=adaptive;colors=x"},
+		{"threshold", "method=fixed;threshold=NaN"},
+		{"cartoon", "edgecolor=rouge"},
+		{"hsv", "value=+"},
+	}
+	for _, c := range cases {
+		params, err := parseParams(c.params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ApplyFilter(src, c.name, 2, 2, params); err == nil {
+			t.Errorf("%s %q : erreur attendue", c.name, c.params)
+		}
+	}
+
+	src16 := toRGBA64(src)
+	for _, c := range []struct{ name, params string }{
+		{"median", "percentile=5o"},
+		{"pixelate", "linear=2"},
+		{"rotate", "angle=quatre-vingt-dix"},
+	} {
+		params, _ := parseParams(c.params)
+		if _, err := ApplyFilter16(src16, c.name, 2, 2, params); err == nil {
+			t.Errorf("16 bits, %s %q : erreur attendue", c.name, c.params)
+		}
+	}
+
+	if _, err := parseRegion(Params{"opacity": "demi"}, nil, src.Bounds().Size()); err == nil {
+		t.Error("opacity=demi : erreur attendue")
+	}
+}
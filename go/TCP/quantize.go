@@ -0,0 +1,590 @@
+// quantize.go
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"sort"
+	"sync"
+)
+
+// Quantification sur une vraie palette (contrairement à PosterizeQuantilesColor qui traite
+// R, G et B séparément) : median-cut, octree ou k-means (RGB ou Lab).
+// Les couleurs sont d'abord regroupées dans un histogramme 5 bits par canal (32768 cases,
+// moyenne exacte des pixels de chaque case) : les algorithmes travaillent sur au plus
+// 32768 points pondérés au lieu de tous les pixels.
+
+// QuantizeOptions : paramètres de la quantification
+type QuantizeOptions struct {
+	Method     string // mediancut (défaut), octree, kmeans
+	Colors     int    // taille de la palette (2..256)
+	Space      string // espace des distances : rgb (défaut) ou lab
+	Dither     string // none (défaut), ordered (Bayer 8x8) ou une méthode de Dither (floyd, atkinson...)
+	Iterations int    // k-means : nombre max d'itérations
+}
+
+// colorPoint : une case non vide de l'histogramme (couleur moyenne + nombre de pixels)
+type colorPoint struct {
+	r, g, b float64
+	count   int
+}
+
+// colorBinIndex : case 5 bits par canal d'une couleur
+func colorBinIndex(r, g, b uint8) int {
+	return int(r>>3)<<10 | int(g>>3)<<5 | int(b>>3)
+}
+
+// colorHistogram regroupe les pixels d'une ou plusieurs images par case :
+// un histogramme local par bande, fusionnés à la fin.
+func colorHistogram(images []*image.RGBA, workers int) []colorPoint {
+	type bin struct{ count, r, g, b int }
+	total := make([]bin, 1<<15)
+	var mu sync.Mutex
+
+	for _, src := range images {
+		bounds := src.Bounds()
+		forBands(bounds, workers, func(startY, endY int) {
+			local := make([]bin, 1<<15)
+			for y := startY; y < endY; y++ {
+				pi := src.PixOffset(bounds.Min.X, y)
+				for x := bounds.Min.X; x < bounds.Max.X; x++ {
+					r, g, b := src.Pix[pi+0], src.Pix[pi+1], src.Pix[pi+2]
+					c := &local[colorBinIndex(r, g, b)]
+					c.count++
+					c.r += int(r)
+					c.g += int(g)
+					c.b += int(b)
+					pi += 4
+				}
+			}
+
+			mu.Lock()
+			for i, c := range local {
+				if c.count > 0 {
+					t := &total[i]
+					t.count += c.count
+					t.r += c.r
+					t.g += c.g
+					t.b += c.b
+				}
+			}
+			mu.Unlock()
+		})
+	}
+
+	var points []colorPoint
+	for _, c := range total {
+		if c.count > 0 {
+			n := float64(c.count)
+			points = append(points, colorPoint{float64(c.r) / n, float64(c.g) / n, float64(c.b) / n, c.count})
+		}
+	}
+	return points
+}
+
+// meanColor : moyenne pondérée d'un groupe de points
+func meanColor(points []colorPoint) color.RGBA {
+	var r, g, b, n float64
+	for _, p := range points {
+		w := float64(p.count)
+		r += p.r * w
+		g += p.g * w
+		b += p.b * w
+		n += w
+	}
+	return color.RGBA{uint8(r/n + 0.5), uint8(g/n + 0.5), uint8(b/n + 0.5), 255}
+}
+
+// Median-cut
+
+// medianCut coupe récursivement la boîte de plus grande étendue, le long de son canal
+// le plus étendu, à la médiane pondérée ; une couleur par boîte (moyenne).
+func medianCut(points []colorPoint, colors int) color.Palette {
+	boxes := [][]colorPoint{append([]colorPoint(nil), points...)}
+
+	// channel renvoie la composante c (0 = R, 1 = G, 2 = B) d'un point
+	channel := func(p *colorPoint, c int) float64 {
+		switch c {
+		case 0:
+			return p.r
+		case 1:
+			return p.g
+		}
+		return p.b
+	}
+	// widest renvoie le canal le plus étendu de la boîte et son étendue
+	widest := func(box []colorPoint) (int, float64) {
+		bestC, bestRange := 0, -1.0
+		for c := 0; c < 3; c++ {
+			lo, hi := math.Inf(1), math.Inf(-1)
+			for i := range box {
+				v := channel(&box[i], c)
+				lo, hi = math.Min(lo, v), math.Max(hi, v)
+			}
+			if hi-lo > bestRange {
+				bestC, bestRange = c, hi-lo
+			}
+		}
+		return bestC, bestRange
+	}
+
+	for len(boxes) < colors {
+		// boîte à couper : la plus étendue parmi celles qui ont au moins deux points
+		best, bestC, bestRange := -1, 0, -1.0
+		for i, box := range boxes {
+			if len(box) < 2 {
+				continue
+			}
+			if c, rng := widest(box); rng > bestRange {
+				best, bestC, bestRange = i, c, rng
+			}
+		}
+		if best < 0 {
+			break
+		}
+
+		box := boxes[best]
+		sort.Slice(box, func(i, j int) bool { return channel(&box[i], bestC) < channel(&box[j], bestC) })
+
+		total := 0
+		for _, p := range box {
+			total += p.count
+		}
+		cut, acc := 1, box[0].count
+		for cut < len(box)-1 && acc*2 < total {
+			acc += box[cut].count
+			cut++
+		}
+		boxes[best] = box[:cut]
+		boxes = append(boxes, box[cut:])
+	}
+
+	pal := make(color.Palette, len(boxes))
+	for i, box := range boxes {
+		pal[i] = meanColor(box)
+	}
+	return pal
+}
+
+// Octree
+
+// octNode : nœud de l'octree (chaque niveau prend un bit de R, G et B)
+type octNode struct {
+	children [8]*octNode
+	points   []colorPoint // feuilles : points regroupés
+	count    int          // pixels sous le nœud
+	level    int
+}
+
+// octree range les points dans un octree de profondeur 5 (les cases de l'histogramme),
+// puis fusionne les nœuds les plus profonds et les moins peuplés jusqu'à colors feuilles.
+func octree(points []colorPoint, colors int) color.Palette {
+	const depth = 5
+	root := &octNode{}
+	levels := make([][]*octNode, depth)
+	levels[0] = []*octNode{root}
+	leaves := 0
+
+	for _, p := range points {
+		r, g, b := uint8(p.r)>>3, uint8(p.g)>>3, uint8(p.b)>>3
+		node := root
+		node.count += p.count
+		for level := 0; level < depth; level++ {
+			shift := depth - 1 - level
+			i := (r>>shift&1)<<2 | (g>>shift&1)<<1 | (b >> shift & 1)
+			child := node.children[i]
+			if child == nil {
+				child = &octNode{level: level + 1}
+				node.children[i] = child
+				if level+1 < depth {
+					levels[level+1] = append(levels[level+1], child)
+				} else {
+					leaves++
+				}
+			}
+			child.count += p.count
+			node = child
+		}
+		node.points = append(node.points, p)
+	}
+
+	// fusion : un nœud interne dont tous les enfants sont des feuilles devient feuille
+	for level := depth - 1; level >= 0 && leaves > colors; level-- {
+		nodes := levels[level]
+		sort.SliceStable(nodes, func(i, j int) bool { return nodes[i].count < nodes[j].count })
+		for _, node := range nodes {
+			if leaves <= colors {
+				break
+			}
+			merged := 0
+			for i, child := range node.children {
+				if child != nil {
+					node.points = append(node.points, child.points...)
+					node.children[i] = nil
+					merged++
+				}
+			}
+			leaves -= merged - 1
+		}
+	}
+
+	var pal color.Palette
+	var collect func(n *octNode)
+	collect = func(n *octNode) {
+		if len(n.points) > 0 {
+			pal = append(pal, meanColor(n.points))
+			return
+		}
+		for _, child := range n.children {
+			if child != nil {
+				collect(child)
+			}
+		}
+	}
+	collect(root)
+	return pal
+}
+
+// K-means
+
+// rgbToLab convertit une couleur sRGB (0..255) en CIELAB (D65)
+func rgbToLab(r, g, b float64) [3]float64 {
+	lr, lg, lb := srgbToLinear(r/255), srgbToLinear(g/255), srgbToLinear(b/255)
+	x := (0.4124*lr + 0.3576*lg + 0.1805*lb) / 0.95047
+	y := 0.2126*lr + 0.7152*lg + 0.0722*lb
+	z := (0.0193*lr + 0.1192*lg + 0.9505*lb) / 1.08883
+
+	f := func(t float64) float64 {
+		if t > 216.0/24389 {
+			return math.Cbrt(t)
+		}
+		return (24389.0/27*t + 16) / 116
+	}
+	fx, fy, fz := f(x), f(y), f(z)
+	return [3]float64{116*fy - 16, 500 * (fx - fy), 200 * (fy - fz)}
+}
+
+// colorSpace renvoie la conversion vers l'espace des distances (rgb ou lab)
+func colorSpace(space string) (func(r, g, b float64) [3]float64, error) {
+	switch space {
+	case "", "rgb":
+		return func(r, g, b float64) [3]float64 { return [3]float64{r, g, b} }, nil
+	case "lab":
+		return rgbToLab, nil
+	default:
+		return nil, fmt.Errorf("espace inconnu: %q (rgb, lab)", space)
+	}
+}
+
+// nearest renvoie l'indice du centre le plus proche (distance euclidienne au carré)
+func nearest(centers [][3]float64, v [3]float64) int {
+	best, bestD := 0, math.Inf(1)
+	for i, c := range centers {
+		d0, d1, d2 := v[0]-c[0], v[1]-c[1], v[2]-c[2]
+		if d := d0*d0 + d1*d1 + d2*d2; d < bestD {
+			best, bestD = i, d
+		}
+	}
+	return best
+}
+
+// kMeans affine une palette median-cut par k-means (pondéré par le nombre de pixels) dans
+// l'espace choisi. L'affectation des points est parallèle (workers paquets, sommes locales
+// fusionnées) ; la couleur finale d'un groupe est la moyenne RGB de ses pixels.
+func kMeans(points []colorPoint, colors int, toSpace func(r, g, b float64) [3]float64, iterations int, workers int) color.Palette {
+	pal := medianCut(points, colors)
+	k := len(pal)
+
+	coords := make([][3]float64, len(points))
+	for i, p := range points {
+		coords[i] = toSpace(p.r, p.g, p.b)
+	}
+	centers := make([][3]float64, k)
+	for i, c := range pal {
+		rgba := c.(color.RGBA)
+		centers[i] = toSpace(float64(rgba.R), float64(rgba.G), float64(rgba.B))
+	}
+
+	type cluster struct {
+		coord [3]float64
+		rgb   [3]float64
+		n     float64
+	}
+	assign := make([]int, len(points))
+	for i := range assign {
+		assign[i] = -1
+	}
+	if workers < 1 {
+		workers = 1
+	}
+	chunk := (len(points) + workers - 1) / workers
+
+	var sums []cluster
+	for it := 0; it < max(iterations, 1); it++ {
+		sums = make([]cluster, k)
+		changed := false
+		var mu sync.Mutex
+		var wg sync.WaitGroup
+
+		for start := 0; start < len(points); start += chunk {
+			end := min(start+chunk, len(points))
+			wg.Add(1)
+			go func(start, end int) {
+				defer wg.Done()
+				local := make([]cluster, k)
+				moved := false
+				for i := start; i < end; i++ {
+					c := nearest(centers, coords[i])
+					if c != assign[i] {
+						assign[i] = c
+						moved = true
+					}
+					w := float64(points[i].count)
+					s := &local[c]
+					for d := 0; d < 3; d++ {
+						s.coord[d] += coords[i][d] * w
+					}
+					s.rgb[0] += points[i].r * w
+					s.rgb[1] += points[i].g * w
+					s.rgb[2] += points[i].b * w
+					s.n += w
+				}
+
+				mu.Lock()
+				for c := range local {
+					for d := 0; d < 3; d++ {
+						sums[c].coord[d] += local[c].coord[d]
+						sums[c].rgb[d] += local[c].rgb[d]
+					}
+					sums[c].n += local[c].n
+				}
+				changed = changed || moved
+				mu.Unlock()
+			}(start, end)
+		}
+		wg.Wait()
+
+		// nouveaux centres (un groupe vide garde son centre)
+		for c := range centers {
+			if sums[c].n > 0 {
+				for d := 0; d < 3; d++ {
+					centers[c][d] = sums[c].coord[d] / sums[c].n
+				}
+			}
+		}
+		if !changed {
+			break
+		}
+	}
+
+	out := make(color.Palette, 0, k)
+	for c := range sums {
+		if sums[c].n == 0 {
+			continue
+		}
+		n := sums[c].n
+		out = append(out, color.RGBA{
+			uint8(sums[c].rgb[0]/n + 0.5), uint8(sums[c].rgb[1]/n + 0.5), uint8(sums[c].rgb[2]/n + 0.5), 255,
+		})
+	}
+	return out
+}
+
+// Palette et application
+
+// buildPalette calcule la palette des images selon la méthode
+func buildPalette(images []*image.RGBA, workers int, opts QuantizeOptions) (color.Palette, error) {
+	colors := min(max(opts.Colors, 2), 256)
+	toSpace, err := colorSpace(opts.Space)
+	if err != nil {
+		return nil, err
+	}
+
+	points := colorHistogram(images, workers)
+	if len(points) == 0 {
+		return color.Palette{color.RGBA{0, 0, 0, 255}}, nil
+	}
+
+	switch opts.Method {
+	case "", "mediancut":
+		return medianCut(points, colors), nil
+	case "octree":
+		return octree(points, colors), nil
+	case "kmeans":
+		return kMeans(points, colors, toSpace, opts.Iterations, workers), nil
+	default:
+		return nil, fmt.Errorf("méthode inconnue: %q (mediancut, octree, kmeans)", opts.Method)
+	}
+}
+
+// paletteIndex : recherche de la couleur de palette la plus proche dans l'espace des
+// distances. Chaque case 5 bits (8 x 8 x 8 valeurs RGB) ne garde que les couleurs qui peuvent
+// être la plus proche d'un de ses pixels ; le choix se fait ensuite sur la vraie couleur du
+// pixel, parmi ces seules candidates.
+type paletteIndex struct {
+	centers [][3]float64
+	toSpace func(r, g, b float64) [3]float64
+	start   []int32 // candidates de la case i : cands[start[i]:start[i+1]]
+	cands   []uint8
+}
+
+// distance : distance euclidienne
+func distance(a, b [3]float64) float64 {
+	d0, d1, d2 := a[0]-b[0], a[1]-b[1], a[2]-b[2]
+	return math.Sqrt(d0*d0 + d1*d1 + d2*d2)
+}
+
+// newPaletteIndex construit les listes de candidates (cases en parallèle). Pour une case de
+// centre c et de rayon rad (distance de c au plus lointain de ses coins), tout pixel p de la
+// case vérifie |p - e| >= |c - e| - rad et |p - best| <= d0 + rad (d0 : distance de c à la
+// couleur la plus proche) : seules les couleurs à moins de d0 + 2 rad de c peuvent gagner.
+// La case couvre les valeurs réelles qui s'y arrondissent (tramage), et rad reçoit 10 % de
+// marge car en Lab la case n'est plus tout à fait un cube.
+func newPaletteIndex(pal color.Palette, toSpace func(r, g, b float64) [3]float64, workers int) *paletteIndex {
+	idx := &paletteIndex{centers: make([][3]float64, len(pal)), toSpace: toSpace}
+	for i, c := range pal {
+		rgba := c.(color.RGBA)
+		idx.centers[i] = toSpace(float64(rgba.R), float64(rgba.G), float64(rgba.B))
+	}
+
+	// bin : valeurs extrêmes de la case v (0..31) sur un axe
+	bin := func(v int) [2]float64 {
+		return [2]float64{max(float64(v<<3)-0.5, 0), min(float64(v<<3)+7.5, 255)}
+	}
+	lists := make([][]uint8, 1<<15)
+	forBands(image.Rect(0, 0, 1, 1<<5), workers, func(startR, endR int) {
+		for r := startR; r < endR; r++ {
+			for g := 0; g < 1<<5; g++ {
+				for b := 0; b < 1<<5; b++ {
+					br, bg, bb := bin(r), bin(g), bin(b)
+					c := toSpace((br[0]+br[1])/2, (bg[0]+bg[1])/2, (bb[0]+bb[1])/2)
+					rad := 0.0
+					for corner := 0; corner < 8; corner++ {
+						p := toSpace(br[corner>>2], bg[corner>>1&1], bb[corner&1])
+						rad = max(rad, distance(c, p))
+					}
+					rad *= 1.1
+
+					d0 := math.Inf(1)
+					for _, e := range idx.centers {
+						d0 = min(d0, distance(c, e))
+					}
+					var list []uint8
+					for i, e := range idx.centers {
+						if distance(c, e) <= d0+2*rad {
+							list = append(list, uint8(i))
+						}
+					}
+					lists[r<<10|g<<5|b] = list
+				}
+			}
+		}
+	})
+
+	idx.start = make([]int32, len(lists)+1)
+	for i, list := range lists {
+		idx.start[i+1] = idx.start[i] + int32(len(list))
+		idx.cands = append(idx.cands, list...)
+	}
+	return idx
+}
+
+// nearest renvoie l'indice de la couleur de palette la plus proche de (r, g, b) (0..255,
+// éventuellement non entiers) ; à distance égale, le plus petit indice, comme nearest.
+func (idx *paletteIndex) nearest(r, g, b float64) int {
+	i := colorBinIndex(uint8(r+0.5), uint8(g+0.5), uint8(b+0.5))
+	cands := idx.cands[idx.start[i]:idx.start[i+1]]
+	if len(cands) == 1 {
+		return int(cands[0])
+	}
+	v := idx.toSpace(r, g, b)
+	best, bestD := 0, math.Inf(1)
+	for _, c := range cands {
+		e := idx.centers[c]
+		d0, d1, d2 := v[0]-e[0], v[1]-e[1], v[2]-e[2]
+		if d := d0*d0 + d1*d1 + d2*d2; d < bestD {
+			best, bestD = int(c), d
+		}
+	}
+	return best
+}
+
+// remapPalette remplace chaque pixel par la couleur de palette la plus proche, en parallèle
+// par bandes.
+func remapPalette(src *image.RGBA, pal color.Palette, idx *paletteIndex, workers int) *image.RGBA {
+	bounds := src.Bounds()
+	out := image.NewRGBA(bounds)
+
+	forBands(bounds, workers, func(startY, endY int) {
+		for y := startY; y < endY; y++ {
+			si := src.PixOffset(bounds.Min.X, y)
+			di := out.PixOffset(bounds.Min.X, y)
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				c := pal[idx.nearest(float64(src.Pix[si+0]), float64(src.Pix[si+1]), float64(src.Pix[si+2]))].(color.RGBA)
+				out.Pix[di+0], out.Pix[di+1], out.Pix[di+2], out.Pix[di+3] = c.R, c.G, c.B, 255
+				si += 4
+				di += 4
+			}
+		}
+	})
+	return out
+}
+
+// Quantize réduit l'image à une palette de opts.Colors couleurs et renvoie aussi la palette.
+// Le tramage éventuel passe par les filtres de dither.go (ordered = bayer8).
+func Quantize(img image.Image, workers int, opts QuantizeOptions) (*image.RGBA, color.Palette, error) {
+	src := toRGBA(img)
+	pal, err := buildPalette([]*image.RGBA{src}, workers, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch opts.Dither {
+	case "", "none":
+		toSpace, _ := colorSpace(opts.Space)
+		return remapPalette(src, pal, newPaletteIndex(pal, toSpace, workers), workers), pal, nil
+
+	case "ordered":
+		opts.Dither = "bayer8"
+	}
+	out, err := Dither(src, workers, DitherOptions{Method: opts.Dither, Palette: pal})
+	return out, pal, err
+}
+
+// paletteQuantizer : draw.Quantizer utilisé par l'encodeur GIF (palette adaptative
+// median-cut au lieu de la palette fixe Plan9)
+type paletteQuantizer struct {
+	workers int
+}
+
+func (q paletteQuantizer) Quantize(p color.Palette, m image.Image) color.Palette {
+	pal, _ := buildPalette([]*image.RGBA{toRGBA(m)}, q.workers, QuantizeOptions{Colors: cap(p) - len(p)})
+	return append(p, pal...)
+}
+
+// PaletteColor : couleur de la palette renvoyée en JSON (output=palette)
+type PaletteColor struct {
+	R   uint8  `json:"r"`
+	G   uint8  `json:"g"`
+	B   uint8  `json:"b"`
+	Hex string `json:"hex"`
+}
+
+// PaletteInfo : réponse JSON de quantize avec output=palette
+type PaletteInfo struct {
+	Method string         `json:"method"`
+	Space  string         `json:"space"`
+	Colors []PaletteColor `json:"colors"`
+}
+
+// paletteColors convertit la palette pour la réponse JSON
+func paletteColors(pal color.Palette) []PaletteColor {
+	out := make([]PaletteColor, len(pal))
+	for i, c := range pal {
+		rgba := c.(color.RGBA)
+		out[i] = PaletteColor{rgba.R, rgba.G, rgba.B, fmt.Sprintf("#%02x%02x%02x", rgba.R, rgba.G, rgba.B)}
+	}
+	return out
+}
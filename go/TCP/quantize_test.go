@@ -0,0 +1,112 @@
+// quantize_test.go
+package main
+
+import (
+	"image"
+	"image/color"
+	"math/rand"
+	"testing"
+)
+
+// randomPalette : n couleurs aléatoires
+func randomPalette(n int, seed int64) color.Palette {
+	r := rand.New(rand.NewSource(seed))
+	pal := make(color.Palette, n)
+	for i := range pal {
+		pal[i] = color.RGBA{uint8(r.Intn(256)), uint8(r.Intn(256)), uint8(r.Intn(256)), 255}
+	}
+	return pal
+}
+
+// TestPaletteIndexNearest : la recherche par candidates donne la couleur la plus proche de la
+// vraie couleur du pixel (référence : nearest sur toute la palette), y compris pour des
+// valeurs non entières (tramage) et des palettes qui tombent dans une seule case.
+func TestPaletteIndexNearest(t *testing.T) {
+	palettes := []color.Palette{
+		randomPalette(2, 1),
+		randomPalette(5, 2),
+		randomPalette(17, 3),
+		randomPalette(64, 4),
+		randomPalette(256, 5),
+		{color.RGBA{0, 0, 0, 255}, color.RGBA{3, 3, 3, 255}, color.RGBA{6, 2, 5, 255}},
+	}
+	r := rand.New(rand.NewSource(6))
+	for _, space := range []string{"rgb", "lab"} {
+		toSpace, err := colorSpace(space)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, pal := range palettes {
+			idx := newPaletteIndex(pal, toSpace, 4)
+			for k := 0; k < 20000; k++ {
+				v := [3]float64{float64(r.Intn(256)), float64(r.Intn(256)), float64(r.Intn(256))}
+				if k%2 == 1 {
+					v = [3]float64{r.Float64() * 255, r.Float64() * 255, r.Float64() * 255}
+				}
+				want := nearest(idx.centers, toSpace(v[0], v[1], v[2]))
+				if got := idx.nearest(v[0], v[1], v[2]); got != want {
+					t.Fatalf("%s, %d couleurs : %v -> %v, attendu %v", space, len(pal), v, pal[got], pal[want])
+				}
+			}
+		}
+	}
+}
+
+func TestQuantizeUsesPaletteColors(t *testing.T) {
+	src := randomImage(64, 48, 7)
+	for _, method := range []string{"mediancut", "octree", "kmeans"} {
+		for _, space := range []string{"rgb", "lab"} {
+			for _, dither := range []string{"none", "ordered", "floyd"} {
+				opts := QuantizeOptions{Method: method, Colors: 16, Space: space, Dither: dither, Iterations: 10}
+				var first []uint8
+				for _, workers := range workerCounts {
+					out, pal, err := Quantize(src, workers, opts)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if len(pal) == 0 || len(pal) > 16 {
+						t.Fatalf("%+v : %d couleurs", opts, len(pal))
+					}
+					inPalette := map[color.RGBA]bool{}
+					for _, c := range pal {
+						inPalette[c.(color.RGBA)] = true
+					}
+					for i := 0; i < len(out.Pix); i += 4 {
+						if !inPalette[color.RGBA{out.Pix[i], out.Pix[i+1], out.Pix[i+2], out.Pix[i+3]}] {
+							t.Fatalf("%+v : couleur hors palette", opts)
+						}
+					}
+					if first == nil {
+						first = out.Pix
+					} else if string(first) != string(out.Pix) {
+						t.Fatalf("%+v : le résultat dépend du nombre de workers", opts)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestQuantizeFewColorsExact(t *testing.T) {
+	colors := []color.RGBA{{255, 0, 0, 255}, {0, 128, 0, 255}, {10, 20, 30, 255}}
+	src := randomImage(50, 40, 8)
+	b := src.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			src.SetRGBA(x, y, colors[(x+y)%3])
+		}
+	}
+	for _, method := range []string{"mediancut", "octree", "kmeans"} {
+		// SubImage : Stride de l'entrée différent de celui de la sortie
+		for _, in := range []*image.RGBA{src, embedded(src)} {
+			out, pal, err := Quantize(in, 3, QuantizeOptions{Method: method, Colors: 8})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(pal) != len(colors) {
+				t.Fatalf("%s : %d couleurs, attendu %d", method, len(pal), len(colors))
+			}
+			assertSame(t, out, src)
+		}
+	}
+}
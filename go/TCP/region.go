@@ -0,0 +1,215 @@
+// region.go
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/draw"
+	"strconv"
+	"strings"
+)
+
+// Region : zone de l'image modifiée par un filtre et façon de fusionner le résultat avec
+// l'image d'origine. Le filtre est calculé sur toute l'image (les filtres de voisinage voient
+// donc les pixels autour de la zone), puis mélangé à l'origine pixel par pixel :
+// out = src + poids * (blend(src, filtré) - src), poids = opacité x masque (0 hors des roi).
+// Construite par parseRegion (valeur zéro = opacité 0, le filtre n'aurait aucun effet).
+type Region struct {
+	Rects   []image.Rectangle // rectangles "roi", relatifs au coin haut-gauche (vide = pas de limite)
+	Mask    *image.Gray       // masque de la taille de l'image (nil = pas de masque) : poids 0 (noir) .. 255 (blanc)
+	Opacity float64           // 0..1, 1 = résultat du filtre seul
+	Mode    string            // mode de fusion : normal, multiply, screen, overlay
+}
+
+// parseRects lit "x,y,w,h|x,y,w,h" (un ou plusieurs rectangles)
+func parseRects(s string) ([]image.Rectangle, error) {
+	var rects []image.Rectangle
+	for _, part := range strings.Split(s, "|") {
+		fields := strings.FieldsFunc(part, func(r rune) bool { return r == ',' || r == ' ' })
+		if len(fields) != 4 {
+			return nil, fmt.Errorf("roi invalide: %q (attendu x,y,largeur,hauteur)", part)
+		}
+		var v [4]int
+		for i, f := range fields {
+			n, err := strconv.Atoi(f)
+			if err != nil {
+				return nil, fmt.Errorf("roi: valeur invalide %q", f)
+			}
+			v[i] = n
+		}
+		if v[2] <= 0 || v[3] <= 0 {
+			return nil, fmt.Errorf("roi: taille invalide %dx%d", v[2], v[3])
+		}
+		rects = append(rects, image.Rect(v[0], v[1], v[0]+v[2], v[1]+v[3]))
+	}
+	return rects, nil
+}
+
+// parseRegion construit la zone à partir du paramètre "roi" et du masque envoyé avec la
+// requête (vide = pas de masque), pour une image de taille size.
+func parseRegion(params Params, mask []byte, size image.Point) (Region, error) {
+	p := params.reader()
+	region := Region{
+		Opacity: min(max(p.Float("opacity", 1), 0), 1),
+		Mode:    params.String("blend", "normal"),
+	}
+	if p.err != nil {
+		return region, p.err
+	}
+	if _, err := blendFunc(region.Mode); err != nil {
+		return region, err
+	}
+
+	if s, ok := params["roi"]; ok && s != "" {
+		rects, err := parseRects(s)
+		if err != nil {
+			return region, err
+		}
+		inside := false
+		for _, r := range rects {
+			if r.Overlaps(image.Rectangle{Max: size}) {
+				inside = true
+			}
+		}
+		if !inside {
+			return region, fmt.Errorf("roi hors de l'image (%dx%d)", size.X, size.Y)
+		}
+		region.Rects = rects
+	}
+
+	if len(mask) > 0 {
+		m, _, err := image.Decode(bytes.NewReader(mask))
+		if err != nil {
+			return region, fmt.Errorf("échec décodage masque")
+		}
+		mb := m.Bounds()
+		if mb.Size() != size {
+			return region, fmt.Errorf("masque %dx%d, image %dx%d : tailles différentes",
+				mb.Dx(), mb.Dy(), size.X, size.Y)
+		}
+		gray := image.NewGray(image.Rectangle{Max: size})
+		draw.Draw(gray, gray.Bounds(), m, mb.Min, draw.Src)
+		region.Mask = gray
+	}
+	return region, nil
+}
+
+// IsWhole indique que le résultat du filtre remplace toute l'image
+// (ni roi ni masque, opacité 1, mode normal)
+func (r Region) IsWhole() bool {
+	return len(r.Rects) == 0 && r.Mask == nil && r.Opacity >= 1 && (r.Mode == "" || r.Mode == "normal")
+}
+
+// blendFunc renvoie le mode de fusion, sur des valeurs 0..1 (a = origine, b = filtré)
+func blendFunc(mode string) (func(a, b float32) float32, error) {
+	switch mode {
+	case "", "normal":
+		return func(a, b float32) float32 { return b }, nil
+	case "multiply":
+		return func(a, b float32) float32 { return a * b }, nil
+	case "screen":
+		return func(a, b float32) float32 { return 1 - (1-a)*(1-b) }, nil
+	case "overlay":
+		return func(a, b float32) float32 {
+			if a < 0.5 {
+				return 2 * a * b
+			}
+			return 1 - 2*(1-a)*(1-b)
+		}, nil
+	default:
+		return nil, fmt.Errorf("mode de fusion inconnu: %q (normal, multiply, screen, overlay)", mode)
+	}
+}
+
+// selection renvoie, pour une image w x h, le poids du masque par pixel
+// (255 = zone entière, 0 = hors zone).
+func (r Region) selection(w, h int, workers int) []uint8 {
+	sel := make([]uint8, w*h)
+	full := image.Rect(0, 0, w, h)
+
+	if len(r.Rects) == 0 {
+		for i := range sel {
+			sel[i] = 255
+		}
+	}
+	for _, rect := range r.Rects {
+		rect = rect.Intersect(full)
+		for y := rect.Min.Y; y < rect.Max.Y; y++ {
+			row := sel[y*w+rect.Min.X : y*w+rect.Max.X]
+			for i := range row {
+				row[i] = 255
+			}
+		}
+	}
+
+	if r.Mask != nil {
+		forBands(full, workers, func(startY, endY int) {
+			for y := startY; y < endY; y++ {
+				m := r.Mask.Pix[y*r.Mask.Stride:]
+				for x := 0; x < w; x++ {
+					sel[y*w+x] = min(sel[y*w+x], m[x])
+				}
+			}
+		})
+	}
+	return sel
+}
+
+// merge fusionne dst (résultat du filtre) avec src selon le mode, le poids sel et l'opacité.
+// Hors zone (poids 0) le pixel d'origine est recopié tel quel.
+func merge(dst, src raster, sel []uint8, opacity float32, blend func(a, b float32) float32, workers int) {
+	forBands(image.Rect(0, 0, dst.w, dst.h), workers, func(startY, endY int) {
+		for y := startY; y < endY; y++ {
+			di, si := dst.offset(0, y), src.offset(0, y)
+			for x := 0; x < dst.w; x++ {
+				weight := opacity * float32(sel[y*dst.w+x]) / 255
+				switch {
+				case weight == 0:
+					copy(dst.pix[di:di+dst.bpp], src.pix[si:si+src.bpp])
+				case weight < 1 || blend != nil:
+					a, b := src.get(x, y), dst.get(x, y)
+					var v [4]float32
+					for c := range v {
+						f := b[c]
+						if blend != nil && c < 3 {
+							f = blend(a[c]/0xffff, b[c]/0xffff) * 0xffff
+						}
+						v[c] = a[c] + weight*(f-a[c])
+					}
+					dst.set(x, y, v)
+				}
+				di += dst.bpp
+				si += src.bpp
+			}
+		}
+	})
+}
+
+// compose applique la zone et la fusion au résultat dst du filtre (src = image d'origine)
+func (r Region) compose(dst, src raster, workers int) {
+	var blend func(a, b float32) float32
+	if r.Mode != "" && r.Mode != "normal" {
+		blend, _ = blendFunc(r.Mode)
+	}
+	sel := r.selection(dst.w, dst.h, workers)
+	merge(dst, src, sel, float32(r.Opacity), blend, workers)
+}
+
+// Apply fusionne le résultat out du filtre avec l'image d'origine src (zone, opacité, mode).
+func (r Region) Apply(out *image.RGBA, src image.Image, workers int) *image.RGBA {
+	if r.IsWhole() {
+		return out
+	}
+	r.compose(rasterRGBA(out), rasterRGBA(toRGBA(src)), workers)
+	return out
+}
+
+// Apply16 : équivalent de Apply pour le chemin 16 bits.
+func (r Region) Apply16(out *image.RGBA64, src *image.RGBA64, workers int) *image.RGBA64 {
+	if r.IsWhole() {
+		return out
+	}
+	r.compose(rasterRGBA64(out), rasterRGBA64(src), workers)
+	return out
+}
@@ -0,0 +1,168 @@
+// region_test.go
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"testing"
+)
+
+// gradientMask : masque PNG w x h, noir à gauche, blanc à droite
+func gradientMask(t *testing.T, w, h int) []byte {
+	m := image.NewGray(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			m.SetGray(x, y, color.Gray{uint8(x * 255 / (w - 1))})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, m); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// regionReference : poids et fusion calculés pixel par pixel en float64
+func regionReference(filtered, src *image.RGBA, rects []image.Rectangle, mask *image.Gray, opacity float64, mode string) *image.RGBA {
+	blends := map[string]func(a, b float64) float64{
+		"normal":   func(a, b float64) float64 { return b },
+		"multiply": func(a, b float64) float64 { return a * b },
+		"screen":   func(a, b float64) float64 { return 1 - (1-a)*(1-b) },
+		"overlay": func(a, b float64) float64 {
+			if a < 0.5 {
+				return 2 * a * b
+			}
+			return 1 - 2*(1-a)*(1-b)
+		},
+	}
+	blend := blends[mode]
+	b := src.Bounds()
+	out := image.NewRGBA(b)
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < b.Dx(); x++ {
+			weight := 1.0
+			if len(rects) > 0 {
+				weight = 0
+				for _, r := range rects {
+					if image.Pt(x, y).In(r) {
+						weight = 1
+					}
+				}
+			}
+			if mask != nil {
+				weight = min(weight, float64(mask.GrayAt(x, y).Y)/255)
+			}
+			weight *= opacity
+
+			a, f := src.RGBAAt(b.Min.X+x, b.Min.Y+y), filtered.RGBAAt(b.Min.X+x, b.Min.Y+y)
+			var v [3]uint8
+			for c, pair := range [3][2]uint8{{a.R, f.R}, {a.G, f.G}, {a.B, f.B}} {
+				av, bv := float64(pair[0])/255, float64(pair[1])/255
+				v[c] = uint8(math.Round(255 * (av + weight*(blend(av, bv)-av))))
+			}
+			out.SetRGBA(b.Min.X+x, b.Min.Y+y, color.RGBA{v[0], v[1], v[2], 255})
+		}
+	}
+	return out
+}
+
+func TestRegionApplyMatchesReference(t *testing.T) {
+	src := randomImage(40, 30, 24)
+	filtered := randomImage(40, 30, 25)
+	mask := gradientMask(t, 40, 30)
+
+	cases := []struct {
+		params string
+		mask   bool
+	}{
+		{"roi=5,5,10,10|30,20,50,50", false},
+		{"opacity=0.35", false},
+		{"blend=multiply", false},
+		{"blend=screen;opacity=0.8", false},
+		{"blend=overlay;roi=0,0,20,30", false},
+		{"", true},
+		{"roi=10,0,25,15;blend=overlay;opacity=0.6", true},
+	}
+	for _, c := range cases {
+		params, err := parseParams(c.params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var maskBytes []byte
+		if c.mask {
+			maskBytes = mask
+		}
+		region, err := parseRegion(params, maskBytes, image.Pt(40, 30))
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := regionReference(filtered, src, region.Rects, region.Mask, region.Opacity, params.String("blend", "normal"))
+		for _, workers := range workerCounts {
+			// Apply écrit dans out : copie du résultat filtré à chaque essai
+			out := image.NewRGBA(filtered.Bounds())
+			copy(out.Pix, filtered.Pix)
+			got := region.Apply(out, src, workers)
+			if d := maxDiff(t, got, want); d > 1 {
+				t.Errorf("%q, masque %t, %d workers : écart %d", c.params, c.mask, workers, d)
+			}
+
+			// chemin 16 bits : même résultat à l'arrondi près
+			got16 := region.Apply16(toRGBA64(filtered), toRGBA64(src), workers)
+			if d := maxDiff(t, toRGBA(got16), want); d > 1 {
+				t.Errorf("%q, masque %t, %d workers, 16 bits : écart %d", c.params, c.mask, workers, d)
+			}
+		}
+	}
+}
+
+// TestRegionOutsideUntouched : hors des roi, les pixels d'origine sont recopiés à l'identique
+func TestRegionOutsideUntouched(t *testing.T) {
+	src := randomImage(30, 20, 26)
+	region, err := parseRegion(Params{"roi": "4,3,8,6"}, nil, image.Pt(30, 20))
+	if err != nil {
+		t.Fatal(err)
+	}
+	full := Pixelate(src, 1, 4, false)
+	out := region.Apply(Pixelate(src, 2, 4, false), src, 3)
+	b := src.Bounds()
+	for y := 0; y < 20; y++ {
+		for x := 0; x < 30; x++ {
+			want := src.RGBAAt(b.Min.X+x, b.Min.Y+y)
+			if image.Pt(x, y).In(image.Rect(4, 3, 12, 9)) {
+				want = full.RGBAAt(b.Min.X+x, b.Min.Y+y)
+			}
+			if got := out.RGBAAt(b.Min.X+x, b.Min.Y+y); got != want {
+				t.Fatalf("(%d, %d) = %v, attendu %v", x, y, got, want)
+			}
+		}
+	}
+}
+
+func TestParseRegionErrors(t *testing.T) {
+	mask := gradientMask(t, 10, 10)
+	cases := []struct {
+		params Params
+		mask   []byte
+	}{
+		{Params{"roi": "100,100,5,5"}, nil},
+		{Params{"roi": "1,2,3"}, nil},
+		{Params{"roi": "1,2,0,4"}, nil},
+		{Params{"roi": "1,a,3,4"}, nil},
+		{Params{"blend": "darken"}, nil},
+		{Params{}, mask},
+		{Params{}, []byte("pas une image")},
+	}
+	for _, c := range cases {
+		if _, err := parseRegion(c.params, c.mask, image.Pt(40, 30)); err == nil {
+			t.Errorf("%v, masque de %d octets : erreur attendue", c.params, len(c.mask))
+		}
+	}
+
+	region, err := parseRegion(Params{"opacity": "3"}, nil, image.Pt(40, 30))
+	if err != nil || region.Opacity != 1 || !region.IsWhole() {
+		t.Errorf("opacité 3 : %+v (%v), attendu ramenée à 1", region, err)
+	}
+}
@@ -4,9 +4,11 @@ import (
 	"bufio"
 	"bytes"
 	"encoding/binary"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"image"
+	"image/color"
 	"image/gif"
 	"image/jpeg"
 	"image/png"
@@ -85,19 +87,12 @@ func handleConn(conn net.Conn, defaultWorkers int) {
 	r := bufio.NewReader(conn)
 
 	// Lire requete
-	filterName, radius, workers, imgBytes, err := readRequest(r)
+	filterName, radius, workers, params, imgBytes, maskBytes, err := readRequest(r)
 	if err != nil {
 		writeError(conn, fmt.Sprintf("lecture requête: %v", err))
 		return
 	}
 
-	// Décoder l'image
-	img, format, err := image.Decode(bytes.NewReader(imgBytes))
-	if err != nil {
-		writeError(conn, "échec décodage image (jpg/png/gif/etc)")
-		return
-	}
-
 	// Choisir workers
 	if workers <= 0 {
 		if defaultWorkers > 0 {
@@ -107,9 +102,142 @@ func handleConn(conn net.Conn, defaultWorkers int) {
 		}
 	}
 
+	// Statistiques : réponse JSON à la place de l'image (GIF animé : première frame)
+	if filterName == "stats" {
+		img, _, err := image.Decode(bytes.NewReader(imgBytes))
+		if err != nil {
+			writeError(conn, "échec décodage image (jpg/png/gif/etc)")
+			return
+		}
+
+		p := params.reader()
+		levels := p.Int("levels", 4)
+		if p.err != nil {
+			writeError(conn, p.err.Error())
+			return
+		}
+
+		start := time.Now()
+		st := Stats(img, workers, levels)
+		elapsed := time.Since(start)
+
+		data, err := json.Marshal(st)
+		if err != nil {
+			writeError(conn, fmt.Sprintf("échec encodage (json): %v", err))
+			return
+		}
+		_ = writeOKWithTime(conn, data, elapsed)
+		return
+	}
+
+	// Quantification avec output=palette : réponse JSON avec la palette au lieu de l'image
+	if filterName == "quantize" && params.String("output", "image") == "palette" {
+		img, _, err := image.Decode(bytes.NewReader(imgBytes))
+		if err != nil {
+			writeError(conn, "échec décodage image (jpg/png/gif/etc)")
+			return
+		}
+
+		opts, err := quantizeOptions(params)
+		if err != nil {
+			writeError(conn, err.Error())
+			return
+		}
+		start := time.Now()
+		pal, err := buildPalette([]*image.RGBA{toRGBA(img)}, workers, opts)
+		elapsed := time.Since(start)
+		if err != nil {
+			writeError(conn, err.Error())
+			return
+		}
+
+		data, err := json.Marshal(PaletteInfo{Method: opts.Method, Space: opts.Space, Colors: paletteColors(pal)})
+		if err != nil {
+			writeError(conn, fmt.Sprintf("échec encodage (json): %v", err))
+			return
+		}
+		_ = writeOKWithTime(conn, data, elapsed)
+		return
+	}
+
+	// Zone d'application et fusion (roi, masque, opacité, mode) : impossible si le filtre
+	// change la taille
+	hasRegion := params["roi"] != "" || len(maskBytes) > 0 || params["opacity"] != "" || params["blend"] != ""
+	if hasRegion && changesSize(filterName) {
+		writeError(conn, fmt.Sprintf("roi/masque/fusion impossible avec %s : la taille de l'image change", filterName))
+		return
+	}
+
+	// GIF animé : toutes les frames sont filtrées
+	if anim, ok := decodeAnimatedGIF(imgBytes); ok {
+		region, err := parseRegion(params, maskBytes, image.Pt(anim.Config.Width, anim.Config.Height))
+		if err != nil {
+			writeError(conn, err.Error())
+			return
+		}
+
+		start := time.Now()
+		out, err := ApplyFilterGIF(anim, filterName, workers, radius, params, region)
+		elapsed := time.Since(start)
+		if err != nil {
+			writeError(conn, err.Error())
+			return
+		}
+
+		encoded, err := encodeGIF(out)
+		if err != nil {
+			writeError(conn, fmt.Sprintf("échec encodage (gif): %v", err))
+			return
+		}
+
+		_ = writeOKWithTime(conn, encoded, elapsed)
+		return
+	}
+
+	// Décoder l'image
+	img, format, err := image.Decode(bytes.NewReader(imgBytes))
+	if err != nil {
+		writeError(conn, "échec décodage image (jpg/png/gif/etc)")
+		return
+	}
+
+	region, err := parseRegion(params, maskBytes, img.Bounds().Size())
+	if err != nil {
+		writeError(conn, err.Error())
+		return
+	}
+
+	// Image 16 bits (PNG scanner) : chemin 16 bits de bout en bout si le filtre l'a ; sinon
+	// réduction à 8 bits par canal, ou refus si la requête le demande (strict16=true)
+	p := params.reader()
+	strict16 := p.Bool("strict16", false)
+	if p.err != nil {
+		writeError(conn, p.err.Error())
+		return
+	}
+	deep := isHighBitDepth(img) && has16Bit(filterName)
+	if isHighBitDepth(img) && !deep && strict16 {
+		writeError(conn, fmt.Sprintf("%s n'existe pas en 16 bits : l'image serait réduite à 8 bits par canal (strict16=true)", filterName))
+		return
+	}
+
 	// Appliquer filtre (PARALLELE) + mesurer temps
 	start := time.Now()
-	out, err := ApplyFilter(img, filterName, workers, radius)
+	var out image.Image
+	if deep {
+		src16 := toRGBA64(img)
+		var out16 *image.RGBA64
+		out16, err = ApplyFilter16(src16, filterName, workers, radius, params)
+		if err == nil {
+			out = matchDepth(region.Apply16(out16, src16, workers), img)
+		}
+	} else {
+		var out8 *image.RGBA
+		out8, err = ApplyFilter(img, filterName, workers, radius, params)
+		if err == nil {
+			out = region.Apply(out8, img, workers)
+		}
+	}
 	elapsed := time.Since(start)
 	if err != nil {
 		writeError(conn, err.Error())
@@ -117,7 +245,7 @@ func handleConn(conn net.Conn, defaultWorkers int) {
 	}
 
 	// Ré-encoder dans le MÊME format que l'entrée
-	encoded, err := encodeSameFormat(out, format)
+	encoded, err := encodeSameFormat(out, format, workers)
 	if err != nil {
 		writeError(conn, fmt.Sprintf("échec encodage (%s): %v", format, err))
 		return
@@ -129,7 +257,7 @@ func handleConn(conn net.Conn, defaultWorkers int) {
 
 // Protocole (request/response)
 
-func readRequest(r *bufio.Reader) (name string, radius int, workers int, img []byte, err error) {
+func readRequest(r *bufio.Reader) (name string, radius int, workers int, params Params, img []byte, mask []byte, err error) {
 	var nameLen uint32
 	if err = binary.Read(r, binary.BigEndian, &nameLen); err != nil {
 		return
@@ -156,6 +284,22 @@ func readRequest(r *bufio.Reader) (name string, radius int, workers int, img []b
 	}
 	workers = int(w32)
 
+	var paramsLen uint32
+	if err = binary.Read(r, binary.BigEndian, &paramsLen); err != nil {
+		return
+	}
+	if paramsLen > 64*1024 {
+		err = fmt.Errorf("paramètres trop longs: %d octets", paramsLen)
+		return
+	}
+	paramsBytes := make([]byte, paramsLen)
+	if _, err = io.ReadFull(r, paramsBytes); err != nil {
+		return
+	}
+	if params, err = parseParams(string(paramsBytes)); err != nil {
+		return
+	}
+
 	var imgSize uint64
 	if err = binary.Read(r, binary.BigEndian, &imgSize); err != nil {
 		return
@@ -165,7 +309,21 @@ func readRequest(r *bufio.Reader) (name string, radius int, workers int, img []b
 		return
 	}
 	img = make([]byte, imgSize)
-	_, err = io.ReadFull(r, img)
+	if _, err = io.ReadFull(r, img); err != nil {
+		return
+	}
+
+	// masque optionnel (taille 0 = pas de masque)
+	var maskSize uint64
+	if err = binary.Read(r, binary.BigEndian, &maskSize); err != nil {
+		return
+	}
+	if maskSize > 200*1024*1024 {
+		err = fmt.Errorf("masque trop grand: %d octets", maskSize)
+		return
+	}
+	mask = make([]byte, maskSize)
+	_, err = io.ReadFull(r, mask)
 	return
 }
 
@@ -201,8 +359,8 @@ func writeOKWithTime(w io.Writer, img []byte, d time.Duration) error {
 	return err
 }
 
-// Encodage au meme format
-func encodeSameFormat(img image.Image, format string) ([]byte, error) {
+// Encodage au meme format (workers : palette adaptative des GIF)
+func encodeSameFormat(img image.Image, format string, workers int) ([]byte, error) {
 	var buf bytes.Buffer
 
 	switch strings.ToLower(format) {
@@ -215,7 +373,8 @@ func encodeSameFormat(img image.Image, format string) ([]byte, error) {
 		return buf.Bytes(), err
 
 	case "gif":
-		err := gif.Encode(&buf, img, nil)
+		// palette adaptative (median-cut) au lieu de la palette fixe Plan9
+		err := gif.Encode(&buf, img, &gif.Options{NumColors: 256, Quantizer: paletteQuantizer{workers: workers}})
 		return buf.Bytes(), err
 
 	default:
@@ -225,31 +384,126 @@ func encodeSameFormat(img image.Image, format string) ([]byte, error) {
 	}
 }
 
-// name : "grayscale|invert|blur|gaussian|sobel|median|pixelate|oilpaint"
+// quantizeOptions lit "method" (mediancut, octree, kmeans), "colors", "space" (rgb, lab),
+// "dither" (none, ordered ou une méthode du filtre dither) et "iterations"
+func quantizeOptions(params Params) (QuantizeOptions, error) {
+	p := params.reader()
+	return QuantizeOptions{
+		Method:     params.String("method", "mediancut"),
+		Colors:     p.Int("colors", 16),
+		Space:      params.String("space", "rgb"),
+		Dither:     params.String("dither", "none"),
+		Iterations: p.Int("iterations", 10),
+	}, p.err
+}
+
+// curvesParams lit les courbes "rgb" (commune), "red", "green" et "blue" ("x,y|x,y|...")
+func curvesParams(params Params) ([]curvePoint, [3][]curvePoint, error) {
+	var curves [4][]curvePoint
+	found := false
+	for i, key := range []string{"rgb", "red", "green", "blue"} {
+		if s := params[key]; s != "" {
+			points, err := parseCurvePoints(s)
+			if err != nil {
+				return nil, [3][]curvePoint{}, fmt.Errorf("%s: %v", key, err)
+			}
+			curves[i] = points
+			found = true
+		}
+	}
+	if !found {
+		return nil, [3][]curvePoint{}, fmt.Errorf("curves: aucune courbe (rgb, red, green, blue)")
+	}
+	return curves[0], [3][]curvePoint{curves[1], curves[2], curves[3]}, nil
+}
+
+// sobelOptions lit les paramètres "operator", "output" (magnitude, direction) et "threshold"
+func sobelOptions(params Params) (SobelOptions, error) {
+	p := params.reader()
+	return SobelOptions{
+		Operator:  params.String("operator", "sobel"),
+		Direction: params.String("output", "magnitude") == "direction",
+		Threshold: p.Int("threshold", 0),
+	}, p.err
+}
+
+// name : grayscale, blur, sobel, canny, median, pixelate, posterizequantilescolor, convolve,
+// equalize, clahe, resize, crop, rotate, flip, quantize, dither, unsharp, highpass, sharpen,
+// erode, dilate, open, close, gradient, tophat, blackhat, bilateral, guided, threshold,
+// brightness, contrast, gamma, levels, curves, hsl, hsv, sepia, vignette, emboss, cartoon
+// ("stats" est traité à part dans handleConn : la réponse est du JSON)
 // workers : nombre de goroutines
 // radius : intensité / paramètre selon filtre
-func ApplyFilter(img image.Image, name string, workers int, radius int) (*image.RGBA, error) {
+// params : paramètres supplémentaires (ex: percentile pour median, kernel pour convolve,
+// border/bordercolor pour les filtres de voisinage)
+func ApplyFilter(img image.Image, name string, workers int, radius int, params Params) (*image.RGBA, error) {
+	// valeurs typées lues avant le calcul : une valeur mal formée est une erreur de requête
+	p := params.reader()
 	switch name {
 	case "grayscale":
-		return Grayscale(img, workers), nil
+		return Grayscale(img, workers, params.String("mode", "rec601"))
 
 	case "blur":
 		if radius < 1 {
 			radius = 1
 		}
-		return Blur(img, workers, radius), nil
+		border, err := parseBlurBorder(params)
+		if err != nil {
+			return nil, err
+		}
+		linear := p.Bool("linear", false)
+		if p.err != nil {
+			return nil, p.err
+		}
+		return Blur(img, workers, radius, border, linear), nil
 
 	case "sobel":
-		return Sobel(img, workers), nil
+		border, err := parseBorder(params)
+		if err != nil {
+			return nil, err
+		}
+		opts, err := sobelOptions(params)
+		if err != nil {
+			return nil, err
+		}
+		return Sobel(img, workers, border, opts)
+
+	case "canny":
+		border, err := parseBorder(params)
+		if err != nil {
+			return nil, err
+		}
+		opts := CannyOptions{
+			Sigma:    p.Float("sigma", 1.4),
+			Low:      p.Float("low", 40),
+			High:     p.Float("high", 100),
+			Operator: params.String("operator", "sobel"),
+		}
+		if p.err != nil {
+			return nil, p.err
+		}
+		return Canny(img, workers, border, opts)
 
 	case "median":
-		return MedianFilter(img, workers), nil
+		border, err := parseBorder(params)
+		if err != nil {
+			return nil, err
+		}
+		percentile := p.Int("percentile", 50)
+		if p.err != nil {
+			return nil, p.err
+		}
+		return MedianFilter(img, workers, radius, percentile, border), nil
 
 	case "pixelate":
 		if radius < 2 {
 			radius = 2 //blockSize par défaut
 		}
-		return Pixelate(img, workers, radius), nil
+		linear := p.Bool("linear", false)
+		if p.err != nil {
+			return nil, p.err
+		}
+		return Pixelate(img, workers, radius, linear), nil
 
 	case "posterizequantilescolor":
 		if radius < 2 {
@@ -257,6 +511,240 @@ func ApplyFilter(img image.Image, name string, workers int, radius int) (*image.
 		}
 		return PosterizeQuantilesColor(img, workers, radius), nil
 
+	case "convolve":
+		kernel, err := parseKernel(params["kernel"])
+		if err != nil {
+			return nil, err
+		}
+		border, err := parseBorder(params)
+		if err != nil {
+			return nil, err
+		}
+		divisor, bias, linear := p.Float("divisor", kernelSum(kernel)), p.Float("bias", 0), p.Bool("linear", false)
+		if p.err != nil {
+			return nil, p.err
+		}
+		return Convolve(img, workers, kernel, divisor, bias, border, linear), nil
+
+	case "equalize":
+		return Equalize(img, workers, params.String("mode", "luma"))
+
+	case "clahe":
+		tiles := p.Int("tiles", 8)
+		opts := CLAHEOptions{
+			TilesX:    tiles,
+			TilesY:    tiles,
+			ClipLimit: p.Float("clip", 2),
+			Mode:      params.String("mode", "luma"),
+		}
+		if p.err != nil {
+			return nil, p.err
+		}
+		return CLAHE(img, workers, opts)
+
+	case "resize":
+		width, height, err := resizeTarget(params, img.Bounds())
+		if err != nil {
+			return nil, err
+		}
+		return Resize(img, workers, width, height, params.String("method", "bilinear"))
+
+	case "crop":
+		rect, err := cropRect(params, img.Bounds())
+		if err != nil {
+			return nil, err
+		}
+		return Crop(img, workers, rect), nil
+
+	case "rotate":
+		angle, background := p.Float("angle", 90), p.Color("background", color.RGBA{0, 0, 0, 255})
+		if p.err != nil {
+			return nil, p.err
+		}
+		return Rotate(img, workers, angle, background, params.String("method", "bilinear"))
+
+	case "flip":
+		return Flip(img, workers, params.String("direction", "horizontal"))
+
+	case "quantize":
+		opts, err := quantizeOptions(params)
+		if err != nil {
+			return nil, err
+		}
+		out, _, err := Quantize(img, workers, opts)
+		return out, err
+
+	case "dither":
+		pal, err := parseDitherPalette(params, img, workers)
+		if err != nil {
+			return nil, err
+		}
+		return Dither(img, workers, DitherOptions{Method: params.String("method", "floyd"), Palette: pal})
+
+	case "unsharp", "highpass":
+		if radius < 1 {
+			radius = 2
+		}
+		border, err := parseBorder(params)
+		if err != nil {
+			return nil, err
+		}
+		amount, threshold := p.Float("amount", 1), p.Float("threshold", 0)
+		if p.err != nil {
+			return nil, p.err
+		}
+		if name == "highpass" {
+			return HighPass(img, workers, radius, amount, border), nil
+		}
+		return UnsharpMask(img, workers, radius, amount, threshold, border), nil
+
+	case "sharpen":
+		border, err := parseBorder(params)
+		if err != nil {
+			return nil, err
+		}
+		amount, neighbours := p.Float("amount", 1), p.Int("neighbours", 4)
+		if p.err != nil {
+			return nil, p.err
+		}
+		return Sharpen(img, workers, amount, neighbours, border)
+
+	case "erode", "dilate", "open", "close", "gradient", "tophat", "blackhat":
+		e, err := structuringElement(params.String("shape", "square"), radius, params["element"])
+		if err != nil {
+			return nil, err
+		}
+		return Morphology(img, workers, name, e, params.String("mode", "luma"))
+
+	case "bilateral":
+		sigmaS, sigmaR := p.Float("sigmas", 3), p.Float("sigmar", 25)
+		if p.err != nil {
+			return nil, p.err
+		}
+		return Bilateral(img, workers, sigmaS, sigmaR)
+
+	case "guided":
+		if radius < 1 {
+			radius = 4
+		}
+		eps := p.Float("eps", 0.01)
+		if p.err != nil {
+			return nil, p.err
+		}
+		return Guided(img, workers, radius, eps)
+
+	case "threshold":
+		opts := ThresholdOptions{
+			Method:    params.String("method", "otsu"),
+			Threshold: p.Float("threshold", 128),
+			Block:     p.Int("block", 15),
+			C:         p.Float("c", 5),
+			K:         p.Float("k", 0.2),
+			R:         p.Float("r", 128),
+			Invert:    p.Bool("invert", false),
+		}
+		if p.err != nil {
+			return nil, p.err
+		}
+		return Threshold(img, workers, opts)
+
+	case "brightness":
+		amount := p.Float("amount", 0)
+		if p.err != nil {
+			return nil, p.err
+		}
+		return Brightness(img, workers, amount), nil
+
+	case "contrast":
+		amount := p.Float("amount", 0)
+		if p.err != nil {
+			return nil, p.err
+		}
+		return Contrast(img, workers, amount)
+
+	case "gamma":
+		gamma := p.Float("gamma", 1)
+		if p.err != nil {
+			return nil, p.err
+		}
+		return Gamma(img, workers, gamma)
+
+	case "levels":
+		opts := LevelsOptions{
+			Black:    p.Float("black", 0),
+			White:    p.Float("white", 255),
+			Mid:      p.Float("mid", 1),
+			OutBlack: p.Float("outblack", 0),
+			OutWhite: p.Float("outwhite", 255),
+			Channel:  params.String("channel", "rgb"),
+		}
+		if p.err != nil {
+			return nil, p.err
+		}
+		return Levels(img, workers, opts)
+
+	case "curves":
+		master, channels, err := curvesParams(params)
+		if err != nil {
+			return nil, err
+		}
+		return Curves(img, workers, master, channels), nil
+
+	case "hsl", "hsv":
+		opts := HSLOptions{
+			Model:      name,
+			Hue:        p.Float("hue", 0),
+			Saturation: p.Float("saturation", 0),
+			Lightness:  p.Float("lightness", p.Float("value", 0)),
+		}
+		if p.err != nil {
+			return nil, p.err
+		}
+		return HSLShift(img, workers, opts)
+
+	case "sepia":
+		amount := p.Float("amount", 1)
+		if p.err != nil {
+			return nil, p.err
+		}
+		return Sepia(img, workers, amount)
+
+	case "vignette":
+		opts := VignetteOptions{
+			Strength: p.Float("strength", 0.6),
+			Radius:   p.Float("radius", 0.4),
+			CenterX:  p.Float("cx", 0.5),
+			CenterY:  p.Float("cy", 0.5),
+		}
+		if p.err != nil {
+			return nil, p.err
+		}
+		return Vignette(img, workers, opts)
+
+	case "emboss":
+		border, err := parseBorder(params)
+		if err != nil {
+			return nil, err
+		}
+		amount := p.Float("amount", 1)
+		if p.err != nil {
+			return nil, p.err
+		}
+		return Emboss(img, workers, amount, params.String("mode", "gray"), border)
+
+	case "cartoon":
+		opts := CartoonOptions{
+			SigmaS:    p.Float("sigmas", 3),
+			SigmaR:    p.Float("sigmar", 25),
+			Levels:    p.Int("levels", 6),
+			Edge:      p.Int("edge", 60),
+			EdgeColor: p.Color("edgecolor", color.RGBA{0, 0, 0, 255}),
+		}
+		if p.err != nil {
+			return nil, p.err
+		}
+		return Cartoon(img, workers, opts)
+
 	default:
 		return nil, fmt.Errorf("filtre inconnu.")
 	}
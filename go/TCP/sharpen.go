@@ -0,0 +1,89 @@
+// sharpen.go
+package main
+
+import (
+	"fmt"
+	"image"
+	"math"
+)
+
+// Netteté : masque flou (unsharp), passe-haut et laplacien.
+// Le détail d'une image est ce que le flou enlève : detail = src - Blur(src).
+// unsharp ajoute amount x detail à l'image, highpass renvoie le détail seul (autour du gris
+// moyen, à fusionner en overlay), sharpen soustrait le laplacien par une convolution 3x3.
+
+// detailPass combine chaque canal de src et de blurred (valeurs 0..255) par fn,
+// en parallèle par bandes (alpha conservé)
+func detailPass(src, blurred *image.RGBA, workers int, fn func(s, b float64) float64) *image.RGBA {
+	bounds := src.Bounds()
+	out := image.NewRGBA(bounds)
+
+	forBands(bounds, workers, func(startY, endY int) {
+		for y := startY; y < endY; y++ {
+			si := src.PixOffset(bounds.Min.X, y)
+			bi := blurred.PixOffset(bounds.Min.X, y)
+			di := out.PixOffset(bounds.Min.X, y)
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				for c := 0; c < 3; c++ {
+					out.Pix[di+c] = clampUint8(fn(float64(src.Pix[si+c]), float64(blurred.Pix[bi+c])))
+				}
+				out.Pix[di+3] = src.Pix[si+3]
+				si += 4
+				bi += 4
+				di += 4
+			}
+		}
+	})
+	return out
+}
+
+// UnsharpMask : src + amount x (src - flou de rayon radius), seulement là où l'écart dépasse
+// threshold (0..255) pour ne pas renforcer le bruit des zones unies.
+func UnsharpMask(img image.Image, workers int, radius int, amount float64, threshold float64, border Border) *image.RGBA {
+	src := toRGBA(img)
+	blurred := Blur(src, workers, radius, border, false)
+	return detailPass(src, blurred, workers, func(s, b float64) float64 {
+		if math.Abs(s-b) < threshold {
+			return s
+		}
+		return s + amount*(s-b)
+	})
+}
+
+// HighPass : 128 + amount x (src - flou) ; gris moyen là où l'image est unie.
+func HighPass(img image.Image, workers int, radius int, amount float64, border Border) *image.RGBA {
+	src := toRGBA(img)
+	blurred := Blur(src, workers, radius, border, false)
+	return detailPass(src, blurred, workers, func(s, b float64) float64 {
+		return 128 + amount*(s-b)
+	})
+}
+
+// laplacianKernel : identité - amount x laplacien (4 ou 8 voisins)
+func laplacianKernel(amount float64, neighbours int) ([][]float64, error) {
+	switch neighbours {
+	case 4:
+		return [][]float64{
+			{0, -amount, 0},
+			{-amount, 1 + 4*amount, -amount},
+			{0, -amount, 0},
+		}, nil
+	case 8:
+		return [][]float64{
+			{-amount, -amount, -amount},
+			{-amount, 1 + 8*amount, -amount},
+			{-amount, -amount, -amount},
+		}, nil
+	default:
+		return nil, fmt.Errorf("sharpen: neighbours %d (4 ou 8)", neighbours)
+	}
+}
+
+// Sharpen : netteté laplacienne, convolution 3x3 (somme du noyau = 1, luminosité conservée)
+func Sharpen(img image.Image, workers int, amount float64, neighbours int, border Border) (*image.RGBA, error) {
+	kernel, err := laplacianKernel(amount, neighbours)
+	if err != nil {
+		return nil, err
+	}
+	return Convolve(img, workers, kernel, 1, 0, border, false), nil
+}
@@ -0,0 +1,161 @@
+// sharpen_test.go
+package main
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+// TestDetailPassSubImage : une entrée SubImage (Stride plus grand que la sortie) donne le
+// même résultat que l'image seule
+func TestDetailPassSubImage(t *testing.T) {
+	src := randomImage(21, 14, 60)
+	for _, run := range []func(img image.Image) *image.RGBA{
+		func(img image.Image) *image.RGBA { return UnsharpMask(img, 3, 2, 1.5, 4, Border{}) },
+		func(img image.Image) *image.RGBA { return HighPass(img, 3, 2, 1, Border{}) },
+	} {
+		assertSame(t, run(embedded(src)), run(src))
+	}
+}
+
+// spikeImage : champ uni à 100 avec un pixel à v au centre (5, 4)
+func spikeImage(v uint8) *image.RGBA {
+	img := uniformImage(11, 9, 100, 100, 100, 255)
+	img.SetRGBA(5, 4, color.RGBA{v, v, v, 255})
+	return img
+}
+
+// TestUnsharpMaskMatchesReference : src + amount x (src - flou direct), sauf là où l'écart
+// est sous le seuil
+func TestUnsharpMaskMatchesReference(t *testing.T) {
+	src := randomImage(23, 16, 61)
+	for _, border := range testBorders {
+		for _, c := range []struct {
+			radius            int
+			amount, threshold float64
+		}{{1, 1, 0}, {2, 0.6, 12}, {4, 2.5, 40}} {
+			blurred := blurReference(src, c.radius, border, false)
+			want := image.NewRGBA(src.Bounds())
+			for i := 0; i < len(src.Pix); i += 4 {
+				for ch := 0; ch < 3; ch++ {
+					s, b := float64(src.Pix[i+ch]), float64(blurred.Pix[i+ch])
+					v := s
+					if math.Abs(s-b) >= c.threshold {
+						v = s + c.amount*(s-b)
+					}
+					want.Pix[i+ch] = uint8(math.Min(255, math.Max(0, math.Round(v))))
+				}
+				want.Pix[i+3] = 255
+			}
+			for _, workers := range workerCounts {
+				got := UnsharpMask(src, workers, c.radius, c.amount, c.threshold, border)
+				if d := maxDiff(t, got, want); d != 0 {
+					t.Errorf("bord %d, %+v, %d workers : écart %d", border.Mode, c, workers, d)
+				}
+			}
+		}
+	}
+
+	// pic 200 sur 100, rayon 1 : flou 1000/9 = 111 sur le pic et ses voisins ;
+	// amount 0.5 : 200 + 44.5 = 245 et 100 - 5.5 = 95 (94.5 arrondi), 100 plus loin
+	spike := spikeImage(200)
+	got := UnsharpMask(spike, 2, 1, 0.5, 0, Border{})
+	for _, c := range []struct{ x, y, want int }{{5, 4, 245}, {4, 4, 95}, {6, 5, 95}, {3, 4, 100}, {0, 0, 100}} {
+		if v := got.RGBAAt(c.x, c.y).R; int(v) != c.want {
+			t.Errorf("unsharp (%d, %d) : %d, attendu %d", c.x, c.y, v, c.want)
+		}
+	}
+	// seuil 20 : l'écart 11 des voisins est ignoré, celui du pic (89) non
+	got = UnsharpMask(spike, 2, 1, 0.5, 20, Border{})
+	if p, n := got.RGBAAt(5, 4).R, got.RGBAAt(4, 4).R; p != 245 || n != 100 {
+		t.Errorf("unsharp seuil 20 : pic %d, voisin %d, attendu 245 et 100", p, n)
+	}
+}
+
+// TestHighPass : gris moyen sur une image unie ; détail centré sur 128 autour d'un pic
+func TestHighPass(t *testing.T) {
+	for _, border := range []Border{{Mode: BorderClamp}, {Mode: BorderMirror}, {Mode: BorderWrap}} {
+		flat := uniformImage(9, 7, 30, 200, 90, 255)
+		assertSame(t, HighPass(flat, 3, 3, 2, border), uniformImage(9, 7, 128, 128, 128, 255))
+	}
+
+	// pic 200 sur 100, rayon 1 : 128 + 89 = 217 au pic, 128 - 11 = 117 à côté
+	got := HighPass(spikeImage(200), 2, 1, 1, Border{})
+	for _, c := range []struct{ x, y, want int }{{5, 4, 217}, {4, 3, 117}, {7, 4, 128}} {
+		if v := got.RGBAAt(c.x, c.y).R; int(v) != c.want {
+			t.Errorf("highpass (%d, %d) : %d, attendu %d", c.x, c.y, v, c.want)
+		}
+	}
+}
+
+// TestSharpenMatchesLaplacian : (1 + n x amount) x centre - amount x somme des n voisins,
+// calculé directement pour 4 et 8 voisins
+func TestSharpenMatchesLaplacian(t *testing.T) {
+	src := randomImage(19, 13, 62)
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	for _, border := range testBorders {
+		at := func(x, y, ch int) float64 {
+			sx, sy := naiveBorderIndex(border.Mode, x, w), naiveBorderIndex(border.Mode, y, h)
+			if sx < 0 || sy < 0 {
+				return float64([]uint8{border.Color.R, border.Color.G, border.Color.B}[ch])
+			}
+			return float64(src.Pix[src.PixOffset(b.Min.X+sx, b.Min.Y+sy)+ch])
+		}
+		for _, neighbours := range []int{4, 8} {
+			for _, amount := range []float64{0.3, 1} {
+				want := image.NewRGBA(b)
+				for y := 0; y < h; y++ {
+					for x := 0; x < w; x++ {
+						i := want.PixOffset(b.Min.X+x, b.Min.Y+y)
+						for ch := 0; ch < 3; ch++ {
+							sum := at(x-1, y, ch) + at(x+1, y, ch) + at(x, y-1, ch) + at(x, y+1, ch)
+							if neighbours == 8 {
+								sum += at(x-1, y-1, ch) + at(x+1, y-1, ch) + at(x-1, y+1, ch) + at(x+1, y+1, ch)
+							}
+							v := (1+float64(neighbours)*amount)*at(x, y, ch) - amount*sum
+							want.Pix[i+ch] = uint8(math.Min(255, math.Max(0, math.Round(v))))
+						}
+						want.Pix[i+3] = 255
+					}
+				}
+				for _, workers := range workerCounts {
+					got, err := Sharpen(src, workers, amount, neighbours, border)
+					if err != nil {
+						t.Fatal(err)
+					}
+					// convolution en float32 côté filtre : arrondi à 1 près
+					if d := maxDiff(t, got, want); d > 1 {
+						t.Errorf("bord %d, %d voisins, amount %g, %d workers : écart %d",
+							border.Mode, neighbours, amount, workers, d)
+					}
+				}
+			}
+		}
+	}
+
+	// pic 110 sur 100, amount 1 : 5 x 110 - 400 = 150 au centre, 500 - 110 - 300 = 90 à
+	// côté (4 voisins) ; 9 x 110 - 800 = 190 et 90 aussi en diagonale (8 voisins)
+	spike := spikeImage(110)
+	four, _ := Sharpen(spike, 2, 1, 4, Border{})
+	eight, _ := Sharpen(spike, 2, 1, 8, Border{})
+	for _, c := range []struct {
+		img        *image.RGBA
+		x, y, want int
+	}{
+		{four, 5, 4, 150}, {four, 5, 3, 90}, {four, 4, 3, 100},
+		{eight, 5, 4, 190}, {eight, 5, 3, 90}, {eight, 4, 3, 90}, {eight, 3, 4, 100},
+	} {
+		if v := c.img.RGBAAt(c.x, c.y).R; int(v) != c.want {
+			t.Errorf("sharpen (%d, %d) : %d, attendu %d", c.x, c.y, v, c.want)
+		}
+	}
+
+	for _, neighbours := range []int{0, 6} {
+		if _, err := Sharpen(spike, 1, 1, neighbours, Border{}); err == nil {
+			t.Errorf("neighbours %d : erreur attendue", neighbours)
+		}
+	}
+}
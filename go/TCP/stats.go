@@ -0,0 +1,92 @@
+// stats.go
+package main
+
+import (
+	"image"
+	"math"
+)
+
+// Requête "stats" : au lieu d'une image, le serveur renvoie des statistiques en JSON
+// (histogrammes, min/max, moyenne, écart-type, entropie et niveaux de la posterization
+// par quantiles), pour choisir les paramètres d'un filtre avant de l'appliquer.
+
+// ChannelStats : statistiques d'un canal (valeurs 0..255)
+type ChannelStats struct {
+	Histogram [256]int      `json:"histogram"`
+	Min       int           `json:"min"`
+	Max       int           `json:"max"`
+	Mean      float64       `json:"mean"`
+	StdDev    float64       `json:"stddev"`
+	Entropy   float64       `json:"entropy"`   // bits par pixel (0..8)
+	Quantiles []QuantileBin `json:"quantiles"` // niveaux choisis par buildQuantileLUT pour levels
+}
+
+// ImageStats : réponse de la requête "stats"
+type ImageStats struct {
+	Width  int          `json:"width"`
+	Height int          `json:"height"`
+	Levels int          `json:"levels"`
+	Red    ChannelStats `json:"red"`
+	Green  ChannelStats `json:"green"`
+	Blue   ChannelStats `json:"blue"`
+	Luma   ChannelStats `json:"luma"` // luminance Rec.601, comme le filtre grayscale
+}
+
+// channelStats calcule les statistiques d'un canal à partir de son histogramme
+func channelStats(hist [256]int, levels int) ChannelStats {
+	st := ChannelStats{Histogram: hist, Min: -1}
+
+	n := 0
+	sum := 0.0
+	for v, c := range hist {
+		if c == 0 {
+			continue
+		}
+		if st.Min < 0 {
+			st.Min = v
+		}
+		st.Max = v
+		n += c
+		sum += float64(v * c)
+	}
+	if n == 0 {
+		st.Min = 0
+		return st
+	}
+	st.Mean = sum / float64(n)
+
+	variance := 0.0
+	for v, c := range hist {
+		if c == 0 {
+			continue
+		}
+		d := float64(v) - st.Mean
+		variance += d * d * float64(c)
+		p := float64(c) / float64(n)
+		st.Entropy -= p * math.Log2(p)
+	}
+	st.StdDev = math.Sqrt(variance / float64(n))
+
+	st.Quantiles = quantileBins(&hist, levels)
+	return st
+}
+
+// Stats calcule les statistiques de l'image ; levels = nombre de niveaux de posterization
+// pour lesquels on renvoie les bornes des quantiles.
+func Stats(img image.Image, workers int, levels int) ImageStats {
+	if levels < 2 {
+		levels = 2
+	}
+	src := toRGBA(img)
+	hists := channelHistograms(src, workers, true)
+
+	return ImageStats{
+		Width:  src.Bounds().Dx(),
+		Height: src.Bounds().Dy(),
+		Levels: levels,
+		Red:    channelStats(hists[0], levels),
+		Green:  channelStats(hists[1], levels),
+		Blue:   channelStats(hists[2], levels),
+		Luma:   channelStats(hists[3], levels),
+	}
+}
@@ -0,0 +1,109 @@
+// stats_test.go
+package main
+
+import (
+	"math"
+	"slices"
+	"testing"
+)
+
+// statsReference : statistiques d'une liste de valeurs, calculées après tri
+func statsReference(vals []uint8, levels int) ChannelStats {
+	sorted := slices.Clone(vals)
+	slices.Sort(sorted)
+	n := len(sorted)
+
+	st := ChannelStats{Min: int(sorted[0]), Max: int(sorted[n-1])}
+	sum := 0.0
+	for _, v := range sorted {
+		st.Histogram[v]++
+		sum += float64(v)
+	}
+	st.Mean = sum / float64(n)
+	for _, v := range sorted {
+		st.StdDev += (float64(v) - st.Mean) * (float64(v) - st.Mean)
+	}
+	st.StdDev = math.Sqrt(st.StdDev / float64(n))
+	for _, c := range st.Histogram {
+		if c > 0 {
+			p := float64(c) / float64(n)
+			st.Entropy -= p * math.Log2(p)
+		}
+	}
+
+	// niveaux : tranches de même effectif des valeurs triées
+	for b := 0; b < levels; b++ {
+		start, end := b*n/levels, (b+1)*n/levels
+		part := 0
+		for _, v := range sorted[start:end] {
+			part += int(v)
+		}
+		st.Quantiles = append(st.Quantiles, QuantileBin{sorted[start], sorted[end-1], uint8(part / (end - start))})
+	}
+	return st
+}
+
+// compareStats : égalité exacte des entiers, à 1e-9 près pour les flottants
+func compareStats(t *testing.T, name string, got, want ChannelStats) {
+	t.Helper()
+	if got.Histogram != want.Histogram || got.Min != want.Min || got.Max != want.Max {
+		t.Fatalf("%s : histogramme ou min/max différents (%d..%d, attendu %d..%d)", name, got.Min, got.Max, want.Min, want.Max)
+	}
+	for _, f := range [][2]float64{{got.Mean, want.Mean}, {got.StdDev, want.StdDev}, {got.Entropy, want.Entropy}} {
+		if math.Abs(f[0]-f[1]) > 1e-9 {
+			t.Fatalf("%s : moyenne %g, écart-type %g, entropie %g ; attendu %g, %g, %g", name,
+				got.Mean, got.StdDev, got.Entropy, want.Mean, want.StdDev, want.Entropy)
+		}
+	}
+	if !slices.Equal(got.Quantiles, want.Quantiles) {
+		t.Fatalf("%s : niveaux %v, attendu %v", name, got.Quantiles, want.Quantiles)
+	}
+}
+
+func TestStatsMatchesReference(t *testing.T) {
+	src := randomImage(53, 41, 27)
+	luma, err := Grayscale(src, 1, "rec601")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// canaux R, G, B puis luminance, lus pixel par pixel
+	var vals [4][]uint8
+	b := src.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := src.RGBAAt(x, y)
+			vals[0] = append(vals[0], c.R)
+			vals[1] = append(vals[1], c.G)
+			vals[2] = append(vals[2], c.B)
+			vals[3] = append(vals[3], luma.RGBAAt(x, y).R)
+		}
+	}
+
+	for _, levels := range []int{2, 5, 16} {
+		for _, workers := range workerCounts {
+			st := Stats(src, workers, levels)
+			if st.Width != 53 || st.Height != 41 || st.Levels != levels {
+				t.Fatalf("%d niveaux, %d workers : %dx%d, %d niveaux", levels, workers, st.Width, st.Height, st.Levels)
+			}
+			for c, got := range []ChannelStats{st.Red, st.Green, st.Blue, st.Luma} {
+				compareStats(t, []string{"rouge", "vert", "bleu", "luminance"}[c], got, statsReference(vals[c], levels))
+			}
+		}
+	}
+}
+
+// TestStatsUniform : image unie, écart-type et entropie nuls, niveaux tous égaux
+func TestStatsUniform(t *testing.T) {
+	st := Stats(uniformImage(7, 5, 10, 20, 30, 255), 2, 1)
+	if st.Levels != 2 {
+		t.Errorf("levels ramené à %d, attendu 2", st.Levels)
+	}
+	if st.Green.Min != 20 || st.Green.Max != 20 || st.Green.Mean != 20 || st.Green.StdDev != 0 || st.Green.Entropy != 0 {
+		t.Errorf("vert : %+v", st.Green)
+	}
+	want := []QuantileBin{{20, 20, 20}, {20, 20, 20}}
+	if !slices.Equal(st.Green.Quantiles, want) {
+		t.Errorf("niveaux %v, attendu %v", st.Green.Quantiles, want)
+	}
+}
@@ -0,0 +1,236 @@
+// threshold.go
+package main
+
+import (
+	"fmt"
+	"image"
+	"math"
+)
+
+// Binarisation (noir et blanc pour l'OCR) : seuil fixe, Otsu (seuil global automatique),
+// adaptatif moyenne ou gaussien (seuil = moyenne locale - C) et Sauvola (documents).
+// Le calcul se fait sur la luminance (Rec.601, comme grayscale) ; les sommes sur une
+// fenêtre viennent d'une image intégrale : coût constant quelle que soit la taille du bloc.
+
+// ThresholdOptions : paramètres de la binarisation
+type ThresholdOptions struct {
+	Method    string  // fixed, otsu, mean, gaussian, sauvola
+	Threshold float64 // fixed : seuil 0..255
+	Block     int     // mean, gaussian, sauvola : taille impaire de la fenêtre
+	C         float64 // mean, gaussian : constante retirée à la moyenne locale
+	K         float64 // sauvola : sensibilité à l'écart-type (0.2 .. 0.5)
+	R         float64 // sauvola : écart-type maximal (128 pour des valeurs 0..255)
+	Invert    bool    // texte blanc sur fond noir
+}
+
+// integralImage : sum[(y+1)*(w+1)+x+1] = somme des valeurs de (0, 0) à (x, y) inclus,
+// sq idem pour les carrés (nil si inutile). float64 : exact jusqu'à 2^53.
+type integralImage struct {
+	w, h    int
+	sum, sq []float64
+}
+
+// newIntegralImage construit l'image intégrale des valeurs at(i), i = y*w+x :
+// sommes cumulées par ligne (bandes en parallèle), puis par colonne (colonnes réparties
+// entre les workers).
+func newIntegralImage(w, h int, at func(i int) float64, squares bool, workers int) *integralImage {
+	ii := &integralImage{w: w, h: h, sum: make([]float64, (w+1)*(h+1))}
+	if squares {
+		ii.sq = make([]float64, (w+1)*(h+1))
+	}
+	stride := w + 1
+
+	forBands(image.Rect(0, 0, w, h), workers, func(startY, endY int) {
+		for y := startY; y < endY; y++ {
+			var s, q float64
+			row := (y + 1) * stride
+			for x := 0; x < w; x++ {
+				v := at(y*w + x)
+				s += v
+				ii.sum[row+x+1] = s
+				if squares {
+					q += v * v
+					ii.sq[row+x+1] = q
+				}
+			}
+		}
+	})
+
+	forBands(image.Rect(0, 0, 1, w), workers, func(startX, endX int) {
+		for y := 2; y <= h; y++ {
+			row, prev := y*stride, (y-1)*stride
+			for x := startX + 1; x <= endX; x++ {
+				ii.sum[row+x] += ii.sum[prev+x]
+				if squares {
+					ii.sq[row+x] += ii.sq[prev+x]
+				}
+			}
+		}
+	})
+	return ii
+}
+
+// window renvoie la somme, la somme des carrés et le nombre de pixels de la fenêtre
+// carrée de rayon radius centrée en (x, y), réduite aux bords de l'image
+func (ii *integralImage) window(x, y, radius int) (sum, sq float64, n int) {
+	x0, y0 := max(x-radius, 0), max(y-radius, 0)
+	x1, y1 := min(x+radius+1, ii.w), min(y+radius+1, ii.h)
+	stride := ii.w + 1
+	a, b, c, d := y0*stride+x0, y0*stride+x1, y1*stride+x0, y1*stride+x1
+
+	sum = ii.sum[d] - ii.sum[b] - ii.sum[c] + ii.sum[a]
+	if ii.sq != nil {
+		sq = ii.sq[d] - ii.sq[b] - ii.sq[c] + ii.sq[a]
+	}
+	return sum, sq, (x1 - x0) * (y1 - y0)
+}
+
+// boxMean : moyenne sur la fenêtre de rayon radius autour de chaque pixel
+func boxMean(values []float64, w, h int, radius int, workers int) []float64 {
+	ii := newIntegralImage(w, h, func(i int) float64 { return values[i] }, false, workers)
+	out := make([]float64, w*h)
+	forBands(image.Rect(0, 0, w, h), workers, func(startY, endY int) {
+		for y := startY; y < endY; y++ {
+			for x := 0; x < w; x++ {
+				s, _, n := ii.window(x, y, radius)
+				out[y*w+x] = s / float64(n)
+			}
+		}
+	})
+	return out
+}
+
+// gaussianBoxRadii : rayons de trois moyennes successives dont la composition approche une
+// gaussienne d'écart-type sigma (largeurs impaires wl et wl+2, la variance totale vaut sigma²)
+func gaussianBoxRadii(sigma float64) [3]int {
+	const passes = 3
+	ideal := math.Sqrt(12*sigma*sigma/passes + 1)
+	wl := int(ideal)
+	if wl%2 == 0 {
+		wl--
+	}
+	wl = max(wl, 1)
+	m := int(math.Round((12*sigma*sigma - passes*float64(wl*wl) - 4*passes*float64(wl) - 3*passes) / float64(-4*wl-4)))
+
+	var radii [3]int
+	for i := range radii {
+		width := wl + 2
+		if i < m {
+			width = wl
+		}
+		radii[i] = (width - 1) / 2
+	}
+	return radii
+}
+
+// otsuThreshold : seuil qui maximise la variance entre les deux classes (<= t et > t)
+func otsuThreshold(hist *[256]int) int {
+	total, sum := 0, 0.0
+	for v, c := range hist {
+		total += c
+		sum += float64(v * c)
+	}
+
+	best, bestVar := 0, -1.0
+	n0, sum0 := 0, 0.0
+	for t, c := range hist {
+		n0 += c
+		sum0 += float64(t * c)
+		n1 := total - n0
+		if n0 == 0 || n1 == 0 {
+			continue
+		}
+		m0, m1 := sum0/float64(n0), (sum-sum0)/float64(n1)
+		if v := float64(n0) * float64(n1) * (m0 - m1) * (m0 - m1); v > bestVar {
+			best, bestVar = t, v
+		}
+	}
+	return best
+}
+
+// Threshold binarise l'image : blanc si la luminance dépasse le seuil (global ou local).
+func Threshold(img image.Image, workers int, opts ThresholdOptions) (*image.RGBA, error) {
+	src := toRGBA(img)
+	planes, _ := contrastPlanes(src, workers, "luma")
+	luma := planes[0]
+	bounds := src.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+
+	block := opts.Block
+	local := opts.Method == "mean" || opts.Method == "gaussian" || opts.Method == "sauvola"
+	if local && (block < 3 || block%2 == 0) {
+		return nil, fmt.Errorf("threshold: block %d (impair >= 3)", block)
+	}
+	radius := block / 2
+
+	// level(x, y, i) : seuil du pixel
+	var level func(x, y, i int) float64
+	switch opts.Method {
+	case "", "fixed":
+		level = func(x, y, i int) float64 { return opts.Threshold }
+
+	case "otsu":
+		hists := channelHistograms(src, workers, true)
+		t := float64(otsuThreshold(&hists[3]))
+		level = func(x, y, i int) float64 { return t }
+
+	case "mean":
+		ii := newIntegralImage(w, h, func(i int) float64 { return float64(luma[i]) }, false, workers)
+		level = func(x, y, i int) float64 {
+			s, _, n := ii.window(x, y, radius)
+			return s/float64(n) - opts.C
+		}
+
+	case "gaussian":
+		// écart-type déduit du bloc comme OpenCV
+		sigma := 0.3*(float64(block-1)*0.5-1) + 0.8
+		mean := make([]float64, w*h)
+		for i, v := range luma {
+			mean[i] = float64(v)
+		}
+		for _, r := range gaussianBoxRadii(sigma) {
+			mean = boxMean(mean, w, h, r, workers)
+		}
+		level = func(x, y, i int) float64 { return mean[i] - opts.C }
+
+	case "sauvola":
+		if opts.R <= 0 {
+			return nil, fmt.Errorf("sauvola: r %g doit être > 0", opts.R)
+		}
+		ii := newIntegralImage(w, h, func(i int) float64 { return float64(luma[i]) }, true, workers)
+		level = func(x, y, i int) float64 {
+			s, sq, n := ii.window(x, y, radius)
+			m := s / float64(n)
+			sd := math.Sqrt(max(sq/float64(n)-m*m, 0))
+			return m * (1 + opts.K*(sd/opts.R-1))
+		}
+
+	default:
+		return nil, fmt.Errorf("méthode inconnue: %q (fixed, otsu, mean, gaussian, sauvola)", opts.Method)
+	}
+
+	white, black := uint8(255), uint8(0)
+	if opts.Invert {
+		white, black = black, white
+	}
+
+	out := image.NewRGBA(bounds)
+	forBands(bounds, workers, func(startY, endY int) {
+		for y := startY; y < endY; y++ {
+			si := src.PixOffset(bounds.Min.X, y)
+			di := out.PixOffset(bounds.Min.X, y)
+			i := (y - bounds.Min.Y) * w
+			for x := 0; x < w; x++ {
+				v := black
+				if float64(luma[i]) > level(x, y-bounds.Min.Y, i) {
+					v = white
+				}
+				out.Pix[di+0], out.Pix[di+1], out.Pix[di+2], out.Pix[di+3] = v, v, v, src.Pix[si+3]
+				si += 4
+				di += 4
+				i++
+			}
+		}
+	})
+	return out, nil
+}
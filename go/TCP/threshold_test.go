@@ -0,0 +1,260 @@
+// threshold_test.go
+package main
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"math/big"
+	"testing"
+)
+
+// otsuReference : seuil de variance inter-classes maximale, calculée en rationnels exacts
+// (n0 n1 (m0 - m1)² = (s0 n1 - s1 n0)² / (n0 n1)) ; le premier maximum l'emporte
+func otsuReference(hist *[256]int) int {
+	best, bestVar := 0, big.NewRat(-1, 1)
+	for t := 0; t < 256; t++ {
+		var n0, n1, s0, s1 int64
+		for v, c := range hist {
+			if v <= t {
+				n0, s0 = n0+int64(c), s0+int64(v*c)
+			} else {
+				n1, s1 = n1+int64(c), s1+int64(v*c)
+			}
+		}
+		if n0 == 0 || n1 == 0 {
+			continue
+		}
+		d := big.NewInt(s0*n1 - s1*n0)
+		num := new(big.Int).Mul(d, d)
+		if v := new(big.Rat).SetFrac(num, big.NewInt(n0*n1)); v.Cmp(bestVar) > 0 {
+			best, bestVar = t, v
+		}
+	}
+	return best
+}
+
+func TestOtsuMatchesReference(t *testing.T) {
+	var bimodal [256]int
+	bimodal[40], bimodal[50], bimodal[200], bimodal[210] = 100, 100, 100, 100
+	var single [256]int
+	single[77] = 12
+
+	hists := []*[256]int{&bimodal, &single}
+	for seed := int64(35); seed < 40; seed++ {
+		var hist [256]int
+		for _, v := range randomPlane(23, 17, seed) {
+			hist[v/(1+uint8(seed%4))]++ // plages de valeurs différentes
+		}
+		hists = append(hists, &hist)
+	}
+	for i, hist := range hists {
+		if got, want := otsuThreshold(hist), otsuReference(hist); got != want {
+			t.Errorf("histogramme %d : seuil %d, attendu %d", i, got, want)
+		}
+	}
+	if got := otsuThreshold(&bimodal); got < 50 || got >= 200 {
+		t.Errorf("bimodal : seuil %d, attendu entre les deux modes", got)
+	}
+}
+
+// windowReference : somme, somme des carrés et effectif de la fenêtre réduite à l'image
+func windowReference(plane []uint8, w, h, x, y, radius int) (sum, sq float64, n int) {
+	for sy := max(y-radius, 0); sy <= min(y+radius, h-1); sy++ {
+		for sx := max(x-radius, 0); sx <= min(x+radius, w-1); sx++ {
+			v := float64(plane[sy*w+sx])
+			sum += v
+			sq += v * v
+			n++
+		}
+	}
+	return sum, sq, n
+}
+
+func TestIntegralImageWindow(t *testing.T) {
+	w, h := 41, 33
+	plane := randomPlane(w, h, 40)
+	for _, workers := range workerCounts {
+		ii := newIntegralImage(w, h, func(i int) float64 { return float64(plane[i]) }, true, workers)
+		for _, radius := range []int{0, 1, 4, 30} {
+			for y := 0; y < h; y++ {
+				for x := 0; x < w; x++ {
+					s, q, n := ii.window(x, y, radius)
+					ws, wq, wn := windowReference(plane, w, h, x, y, radius)
+					if s != ws || q != wq || n != wn {
+						t.Fatalf("%d workers, rayon %d, (%d, %d) : %g %g %d, attendu %g %g %d",
+							workers, radius, x, y, s, q, n, ws, wq, wn)
+					}
+				}
+			}
+		}
+	}
+}
+
+// TestGaussianBoxRadii : la variance des trois moyennes ((largeur² - 1) / 12 chacune)
+// approche sigma²
+func TestGaussianBoxRadii(t *testing.T) {
+	for _, sigma := range []float64{0.8, 1, 2.3, 5, 12} {
+		variance := 0.0
+		for _, r := range gaussianBoxRadii(sigma) {
+			width := float64(2*r + 1)
+			variance += (width*width - 1) / 12
+		}
+		if math.Abs(math.Sqrt(variance)-sigma) > 0.5 {
+			t.Errorf("sigma %g : trois moyennes d'écart-type %g", sigma, math.Sqrt(variance))
+		}
+	}
+}
+
+func TestThresholdMatchesReference(t *testing.T) {
+	src := randomImage(41, 33, 41)
+	for i := 3; i < len(src.Pix); i += 12 {
+		src.Pix[i] = 64 // alpha conservé
+	}
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	gray, _ := Grayscale(src, 1, "rec601")
+	luma := make([]uint8, w*h)
+	var hist [256]int
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			luma[y*w+x] = gray.RGBAAt(b.Min.X+x, b.Min.Y+y).R
+			hist[luma[y*w+x]]++
+		}
+	}
+
+	// moyenne gaussienne : trois moyennes directes successives
+	gaussian := func(block int) []float64 {
+		mean := make([]float64, w*h)
+		for i, v := range luma {
+			mean[i] = float64(v)
+		}
+		for _, r := range gaussianBoxRadii(0.3*(float64(block-1)*0.5-1) + 0.8) {
+			next := make([]float64, w*h)
+			for y := 0; y < h; y++ {
+				for x := 0; x < w; x++ {
+					n := 0
+					for sy := max(y-r, 0); sy <= min(y+r, h-1); sy++ {
+						for sx := max(x-r, 0); sx <= min(x+r, w-1); sx++ {
+							next[y*w+x] += mean[sy*w+sx]
+							n++
+						}
+					}
+					next[y*w+x] /= float64(n)
+				}
+			}
+			mean = next
+		}
+		return mean
+	}
+
+	cases := []struct {
+		opts  ThresholdOptions
+		level func(x, y int) float64
+	}{
+		{ThresholdOptions{Method: "fixed", Threshold: 100}, func(x, y int) float64 { return 100 }},
+		{ThresholdOptions{Method: "otsu", Invert: true}, func(x, y int) float64 { return float64(otsuReference(&hist)) }},
+		{ThresholdOptions{Method: "mean", Block: 7, C: 2}, func(x, y int) float64 {
+			s, _, n := windowReference(luma, w, h, x, y, 3)
+			return s/float64(n) - 2
+		}},
+		{ThresholdOptions{Method: "mean", Block: 101, C: -5}, func(x, y int) float64 {
+			s, _, n := windowReference(luma, w, h, x, y, 50)
+			return s/float64(n) + 5
+		}},
+		{ThresholdOptions{Method: "sauvola", Block: 15, K: 0.3, R: 128}, func(x, y int) float64 {
+			s, sq, n := windowReference(luma, w, h, x, y, 7)
+			m := s / float64(n)
+			return m * (1 + 0.3*(math.Sqrt(max(sq/float64(n)-m*m, 0))/128-1))
+		}},
+	}
+	for _, block := range []int{3, 11, 31} {
+		mean := gaussian(block)
+		cases = append(cases, struct {
+			opts  ThresholdOptions
+			level func(x, y int) float64
+		}{ThresholdOptions{Method: "gaussian", Block: block, C: 3}, func(x, y int) float64 { return mean[y*w+x] - 3 }})
+	}
+
+	for _, c := range cases {
+		// SubImage : Stride de l'entrée différent de celui de la sortie
+		for _, in := range []*image.RGBA{src, embedded(src)} {
+			for _, workers := range workerCounts {
+				out, err := Threshold(in, workers, c.opts)
+				if err != nil {
+					t.Fatal(err)
+				}
+				for y := 0; y < h; y++ {
+					for x := 0; x < w; x++ {
+						v, level := float64(luma[y*w+x]), c.level(x, y)
+						want := uint8(0)
+						if (v > level) != c.opts.Invert {
+							want = 255
+						}
+						got := out.RGBAAt(b.Min.X+x, b.Min.Y+y)
+						// ordre des sommes différent : un pixel exactement sur le seuil peut basculer
+						if (got.R != want && math.Abs(v-level) > 1e-9) || got.G != got.R || got.B != got.R ||
+							got.A != src.RGBAAt(b.Min.X+x, b.Min.Y+y).A {
+							t.Fatalf("%+v, %d workers, (%d, %d) = %v, attendu %d (luminance %g, seuil %g)",
+								c.opts, workers, x, y, got, want, v, level)
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+// TestThresholdHandValues : une ligne de pixels gris (luminance = valeur), seuils calculés à la main
+func TestThresholdHandValues(t *testing.T) {
+	cases := []struct {
+		vals []uint8
+		opts ThresholdOptions
+		want []uint8
+	}{
+		// strictement au-dessus du seuil : 100 reste noir
+		{[]uint8{0, 100, 101, 200}, ThresholdOptions{Method: "fixed", Threshold: 100}, []uint8{0, 0, 255, 255}},
+		{[]uint8{0, 100, 101, 200}, ThresholdOptions{Method: "fixed", Threshold: 100, Invert: true}, []uint8{255, 255, 0, 0}},
+		// n0 n1 (m0 - m1)² : t = 0 -> 1 x 3 x 166.7² = 83333, t = 100 -> 2 x 2 x 150² = 90000
+		{[]uint8{0, 100, 200, 200}, ThresholdOptions{Method: "otsu"}, []uint8{0, 0, 255, 255}},
+		// fenêtres réduites à l'image : moyennes 25, 50, 70
+		{[]uint8{10, 40, 100}, ThresholdOptions{Method: "mean", Block: 3}, []uint8{0, 0, 255}},
+		{[]uint8{10, 40, 100}, ThresholdOptions{Method: "mean", Block: 3, C: 20}, []uint8{255, 255, 255}},
+		// image unie : la moyenne gaussienne vaut 80, seuil 80 - C
+		{[]uint8{80, 80, 80}, ThresholdOptions{Method: "gaussian", Block: 3, C: 1}, []uint8{255, 255, 255}},
+		{[]uint8{80, 80, 80}, ThresholdOptions{Method: "gaussian", Block: 3, C: -1}, []uint8{0, 0, 0}},
+		// moyenne 40, écart-type 10 : 40 x (1 + 0.5 x (10/100 - 1)) = 22
+		{[]uint8{30, 50}, ThresholdOptions{Method: "sauvola", Block: 3, K: 0.5, R: 100}, []uint8{255, 255}},
+		// moyenne 50, écart-type 50 : 50 x (1 + 0.5 x (50/100 - 1)) = 37.5
+		{[]uint8{0, 100}, ThresholdOptions{Method: "sauvola", Block: 3, K: 0.5, R: 100}, []uint8{0, 255}},
+	}
+	for _, c := range cases {
+		src := image.NewRGBA(image.Rect(0, 0, len(c.vals), 1))
+		for x, v := range c.vals {
+			src.SetRGBA(x, 0, color.RGBA{v, v, v, 255})
+		}
+		out, err := Threshold(src, 2, c.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for x, want := range c.want {
+			if got := out.RGBAAt(x, 0); got != (color.RGBA{want, want, want, 255}) {
+				t.Errorf("%+v, %v : pixel %d = %v, attendu %d", c.opts, c.vals, x, got, want)
+			}
+		}
+	}
+}
+
+func TestThresholdErrors(t *testing.T) {
+	src := randomImage(5, 5, 42)
+	for _, opts := range []ThresholdOptions{
+		{Method: "mean", Block: 4},
+		{Method: "gaussian", Block: 1},
+		{Method: "sauvola", Block: 5, R: 0},
+		{Method: "niblack", Block: 5},
+	} {
+		if _, err := Threshold(src, 1, opts); err == nil {
+			t.Errorf("%+v : erreur attendue", opts)
+		}
+	}
+}
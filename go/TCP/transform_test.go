@@ -0,0 +1,222 @@
+// transform_test.go
+package main
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+// naiveResize : rééchantillonnage direct en 2D (sans passes séparées ni tables de poids),
+// même convention de centres de pixels, noyau élargi en réduction et bords répétés.
+func naiveResize(src *image.RGBA, w, h int, method string) *image.RGBA {
+	k, _ := resampleKernelFor(method)
+	b := src.Bounds()
+	sw, sh := b.Dx(), b.Dy()
+	out := image.NewRGBA(image.Rect(0, 0, w, h))
+
+	// axis : pixels source et poids (non normalisés) pour la sortie i
+	axis := func(i, srcN, dstN int) (map[int]float64, float64) {
+		scale := float64(srcN) / float64(dstN)
+		weights := map[int]float64{}
+		if k.at == nil {
+			weights[min(int((float64(i)+0.5)*scale), srcN-1)] = 1
+			return weights, 1
+		}
+		fs := max(scale, 1)
+		center := (float64(i)+0.5)*scale - 0.5
+		sum := 0.0
+		for j := int(math.Ceil(center - k.support*fs)); j <= int(math.Floor(center+k.support*fs)); j++ {
+			wt := k.at((float64(j) - center) / fs)
+			weights[min(max(j, 0), srcN-1)] += wt
+			sum += wt
+		}
+		return weights, sum
+	}
+
+	for y := 0; y < h; y++ {
+		wy, sy := axis(y, sh, h)
+		for x := 0; x < w; x++ {
+			wx, sx := axis(x, sw, w)
+			var v [4]float64
+			for py, a := range wy {
+				for px, c := range wx {
+					p := src.RGBAAt(b.Min.X+px, b.Min.Y+py)
+					for n, s := range [4]uint8{p.R, p.G, p.B, p.A} {
+						v[n] += a * c * float64(s)
+					}
+				}
+			}
+			alpha := min(max(v[3]/(sx*sy), 0), 255)
+			var px [4]uint8
+			for n := range v {
+				px[n] = uint8(math.Round(min(max(v[n]/(sx*sy), 0), alpha)))
+			}
+			out.SetRGBA(x, y, color.RGBA{px[0], px[1], px[2], px[3]})
+		}
+	}
+	return out
+}
+
+func TestResizeMatchesNaive(t *testing.T) {
+	src := randomImage(23, 17, 11)
+	sizes := [][2]int{{23, 17}, {46, 34}, {9, 7}, {31, 5}, {1, 1}}
+	for _, method := range []string{"nearest", "bilinear", "bicubic", "lanczos"} {
+		for _, size := range sizes {
+			want := naiveResize(src, size[0], size[1], method)
+			for _, workers := range workerCounts {
+				got, err := Resize(src, workers, size[0], size[1], method)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if d := maxDiff(t, got, want); d > 1 {
+					t.Errorf("%s %v, %d workers : écart %d", method, size, workers, d)
+				}
+			}
+		}
+	}
+}
+
+// TestResizeBlocks : source plus haute qu'un bloc de resizeBlockRows lignes, en agrandissement,
+// en réduction et en très forte réduction (un seul pixel de sortie couvre plus d'un bloc).
+func TestResizeBlocks(t *testing.T) {
+	src := randomImage(6, 300, 15)
+	for _, size := range [][2]int{{5, 700}, {6, 150}, {3, 2}} {
+		for _, method := range []string{"bilinear", "lanczos"} {
+			want := naiveResize(src, size[0], size[1], method)
+			for _, workers := range workerCounts {
+				got, err := Resize(src, workers, size[0], size[1], method)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if d := maxDiff(t, got, want); d > 1 {
+					t.Errorf("%s %v, %d workers : écart %d", method, size, workers, d)
+				}
+			}
+		}
+	}
+}
+
+func TestResizeSameSizeIsIdentity(t *testing.T) {
+	src := randomImage(20, 13, 12)
+	want := Crop(src, 1, image.Rect(0, 0, 20, 13))
+	for _, method := range []string{"nearest", "bilinear", "bicubic", "lanczos"} {
+		got, err := Resize(src, 3, 20, 13, method)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d := maxDiff(t, got, want); d != 0 {
+			t.Errorf("%s : écart %d", method, d)
+		}
+	}
+}
+
+// TestResizeKeepsAlpha : un PNG à moitié transparent le reste après redimensionnement, et les
+// pixels transparents ne déteignent pas sur leurs voisins (couleurs prémultipliées).
+func TestResizeKeepsAlpha(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 16, 16))
+	for y := 0; y < 16; y++ {
+		for x := 0; x < 16; x++ {
+			if x < 8 {
+				src.SetNRGBA(x, y, color.NRGBA{255, 0, 0, 255})
+			} else {
+				src.SetNRGBA(x, y, color.NRGBA{0, 255, 0, 0}) // vert invisible
+			}
+		}
+	}
+	for _, method := range []string{"nearest", "bilinear", "bicubic", "lanczos"} {
+		out, err := Resize(src, 2, 8, 8, method)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for y := 0; y < 8; y++ {
+			left, right := out.RGBAAt(0, y), out.RGBAAt(7, y)
+			if left.A != 255 || right.A != 0 {
+				t.Fatalf("%s : alpha %d à gauche, %d à droite", method, left.A, right.A)
+			}
+			for x := 0; x < 8; x++ {
+				if c := out.RGBAAt(x, y); c.G != 0 || c.R > c.A {
+					t.Fatalf("%s : pixel (%d, %d) = %v", method, x, y, c)
+				}
+			}
+		}
+	}
+}
+
+func TestRotateRightAngles(t *testing.T) {
+	src := randomImage(7, 4, 13)
+	b := src.Bounds()
+	at := func(x, y int) color.RGBA { return src.RGBAAt(b.Min.X+x, b.Min.Y+y) }
+	cases := []struct {
+		angle float64
+		w, h  int
+		want  func(x, y int) color.RGBA
+	}{
+		{90, 4, 7, func(x, y int) color.RGBA { return at(y, 3-x) }},
+		{180, 7, 4, func(x, y int) color.RGBA { return at(6-x, 3-y) }},
+		{-90, 4, 7, func(x, y int) color.RGBA { return at(6-y, x) }},
+		{360, 7, 4, func(x, y int) color.RGBA { return at(x, y) }},
+	}
+	for _, c := range cases {
+		out, err := Rotate(src, 2, c.angle, color.RGBA{}, "bilinear")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out.Bounds() != image.Rect(0, 0, c.w, c.h) {
+			t.Fatalf("%g° : bornes %v", c.angle, out.Bounds())
+		}
+		for y := 0; y < c.h; y++ {
+			for x := 0; x < c.w; x++ {
+				if got, want := out.RGBAAt(x, y), c.want(x, y); got != want {
+					t.Fatalf("%g° : (%d, %d) = %v, attendu %v", c.angle, x, y, got, want)
+				}
+			}
+		}
+	}
+}
+
+// TestRotateArbitraryAngle : taille de la toile, centre conservé, coins remplis avec le fond
+// (transparent ici) et alpha conservé dans l'image tournée.
+func TestRotateArbitraryAngle(t *testing.T) {
+	src := uniformImage(40, 20, 200, 100, 50, 255)
+	out, err := Rotate(src, 3, 30, color.RGBA{}, "bilinear")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, c := math.Sincos(30 * math.Pi / 180)
+	wantW := int(math.Ceil(40*c + 20*s - 1e-6))
+	wantH := int(math.Ceil(40*s + 20*c - 1e-6))
+	if out.Bounds() != image.Rect(0, 0, wantW, wantH) {
+		t.Fatalf("bornes %v, attendu %dx%d", out.Bounds(), wantW, wantH)
+	}
+	if got := out.RGBAAt(wantW/2, wantH/2); got != (color.RGBA{200, 100, 50, 255}) {
+		t.Errorf("centre %v", got)
+	}
+	if got := out.RGBAAt(0, 0); got.A != 0 {
+		t.Errorf("coin %v, attendu transparent", got)
+	}
+}
+
+func TestFlipAndCrop(t *testing.T) {
+	src := randomImage(9, 6, 14)
+	b := src.Bounds()
+	for _, direction := range []string{"horizontal", "vertical", "both"} {
+		once, err := Flip(src, 2, direction)
+		if err != nil {
+			t.Fatal(err)
+		}
+		twice, _ := Flip(once, 3, direction)
+		assertSame(t, twice, Crop(src, 1, image.Rect(0, 0, 9, 6)))
+	}
+
+	rect := image.Rect(2, 1, 7, 5)
+	out := Crop(src, 2, rect)
+	for y := 0; y < rect.Dy(); y++ {
+		for x := 0; x < rect.Dx(); x++ {
+			if got, want := out.RGBAAt(x, y), src.RGBAAt(b.Min.X+rect.Min.X+x, b.Min.Y+rect.Min.Y+y); got != want {
+				t.Fatalf("crop (%d, %d) = %v, attendu %v", x, y, got, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,94 @@
+// border.go
+package main
+
+import (
+	"fmt"
+	"image/color"
+)
+
+// BorderMode : comportement d'un filtre de voisinage quand la fenêtre dépasse de l'image.
+type BorderMode int
+
+const (
+	BorderClamp    BorderMode = iota // répète le pixel du bord       aaa|abcd|ddd
+	BorderMirror                     // miroir (sans répéter le bord)  cb|abcd|cb
+	BorderWrap                       // image répétée (torique)        cd|abcd|ab
+	BorderConstant                   // couleur fixe hors de l'image   kk|abcd|kk
+	BorderShrink                     // fenêtre réduite à l'image         |abcd|
+)
+
+// Border : mode de bord commun à tous les filtres de voisinage (blur, median, sobel, convolve).
+type Border struct {
+	Mode  BorderMode
+	Color color.RGBA // couleur hors de l'image en mode BorderConstant
+}
+
+// parseBorder lit les paramètres "border" (clamp, mirror, wrap, constant, zero)
+// et "bordercolor" (couleur du mode constant, noir par défaut).
+func parseBorder(params Params) (Border, error) {
+	p := params.reader()
+	b := Border{Color: p.Color("bordercolor", color.RGBA{0, 0, 0, 255})}
+	if p.err != nil {
+		return b, p.err
+	}
+
+	switch s := params.String("border", "clamp"); s {
+	case "clamp":
+		b.Mode = BorderClamp
+	case "mirror":
+		b.Mode = BorderMirror
+	case "wrap":
+		b.Mode = BorderWrap
+	case "constant":
+		b.Mode = BorderConstant
+	case "zero":
+		b.Mode = BorderConstant
+		b.Color = color.RGBA{0, 0, 0, 255}
+	default:
+		return b, fmt.Errorf("mode de bord inconnu: %q (clamp, mirror, wrap, constant)", s)
+	}
+	return b, nil
+}
+
+// parseBlurBorder : comme parseBorder, mais le flou garde par défaut sa fenêtre réduite
+// aux pixels de l'image ("shrink", BorderShrink) ; les autres modes sont à demander.
+func parseBlurBorder(params Params) (Border, error) {
+	if s := params.String("border", "shrink"); s == "shrink" {
+		return Border{Mode: BorderShrink}, nil
+	}
+	return parseBorder(params)
+}
+
+// index ramène l'indice i (relatif, 0..n-1 dans l'image) dans l'image selon le mode.
+// Renvoie -1 si le pixel est hors image en mode BorderConstant (utiliser Color) ou
+// BorderShrink (pixel ignoré : seul le flou connaît ce mode, voir parseBlurBorder).
+func (b Border) index(i int, n int) int {
+	if i >= 0 && i < n {
+		return i
+	}
+	switch b.Mode {
+	case BorderMirror:
+		if n == 1 {
+			return 0
+		}
+		period := 2*n - 2
+		i %= period
+		if i < 0 {
+			i += period
+		}
+		if i >= n {
+			i = period - i
+		}
+		return i
+	case BorderWrap:
+		i %= n
+		if i < 0 {
+			i += n
+		}
+		return i
+	case BorderConstant, BorderShrink:
+		return -1
+	default:
+		return min(max(i, 0), n-1)
+	}
+}
@@ -2,8 +2,8 @@
 package main
 
 import (
+	"fmt"
 	"image"
-	"image/color"
 	"math"
 	"sort"
 	"sync"
@@ -24,11 +24,8 @@ func splitWorkers(bounds image.Rectangle, workers int) (w int, block int, height
 	return workers, block, height
 }
 
-// Grayscale convertit l'image en niveaux de gris
-func Grayscale(img image.Image, workers int) *image.RGBA {
-	bounds := img.Bounds()
-	result := image.NewRGBA(bounds)
-
+// forBands découpe l'image en bandes horizontales (splitWorkers) et lance fn sur chacune.
+func forBands(bounds image.Rectangle, workers int, fn func(startY, endY int)) {
 	w, block, _ := splitWorkers(bounds, workers)
 	var wg sync.WaitGroup
 
@@ -42,392 +39,810 @@ func Grayscale(img image.Image, workers int) *image.RGBA {
 		wg.Add(1)
 		go func(startY, endY int) {
 			defer wg.Done()
-			for y := startY; y < endY; y++ {
-				for x := bounds.Min.X; x < bounds.Max.X; x++ {
-					r, g, b, _ := img.At(x, y).RGBA()
-					gray16 := (r + g + b) / 3
-					avg := uint8(gray16 >> 8)
-					result.Set(x, y, color.RGBA{avg, avg, avg, 255})
-				}
-			}
+			fn(startY, endY)
 		}(startY, endY)
 	}
 
 	wg.Wait()
+}
+
+// toRGBA convertit l'entrée une seule fois en *image.RGBA pour lire directement Pix
+// (img.At(x, y).RGBA() alloue via l'interface color.Color à chaque pixel).
+// draw.Draw a déjà des chemins rapides pour *image.YCbCr (JPEG), *image.Gray, *image.NRGBA...
+// Si l'entrée est déjà un *image.RGBA, elle est utilisée telle quelle (lecture seule).
+func toRGBA(img image.Image) *image.RGBA {
+	if rgba, ok := img.(*image.RGBA); ok {
+		return rgba
+	}
+	bounds := img.Bounds()
+	src := image.NewRGBA(bounds)
+	draw.Draw(src, bounds, img, bounds.Min, draw.Src)
+	return src
+}
+
+// grayFunc renvoie la conversion en gris choisie, sur des valeurs 16 bits (0..65535) :
+//   - "rec601"    : 0.299 R + 0.587 G + 0.114 B (défaut, TV/JPEG)
+//   - "rec709"    : 0.2126 R + 0.7152 G + 0.0722 B (sRGB / HDTV)
+//   - "average"   : (R + G + B) / 3 (ancien comportement, pour reproduire d'anciens résultats)
+//   - "lightness" : (max + min) / 2
+//   - "red", "green", "blue" : un seul canal
+//   - "linear"    : luminance Rec.709 calculée en lumière linéaire puis ré-encodée en sRGB
+func grayFunc(mode string) (func(r, g, b uint32) uint32, error) {
+	switch mode {
+	case "", "rec601":
+		return func(r, g, b uint32) uint32 {
+			return uint32((19595*uint64(r) + 38470*uint64(g) + 7471*uint64(b) + 1<<15) >> 16)
+		}, nil
+	case "rec709":
+		return func(r, g, b uint32) uint32 {
+			return uint32((13933*uint64(r) + 46871*uint64(g) + 4732*uint64(b) + 1<<15) >> 16)
+		}, nil
+	case "average":
+		return func(r, g, b uint32) uint32 { return (r + g + b) / 3 }, nil
+	case "lightness":
+		return func(r, g, b uint32) uint32 { return (max(r, g, b) + min(r, g, b)) / 2 }, nil
+	case "red":
+		return func(r, g, b uint32) uint32 { return r }, nil
+	case "green":
+		return func(r, g, b uint32) uint32 { return g }, nil
+	case "blue":
+		return func(r, g, b uint32) uint32 { return b }, nil
+	case "linear":
+		return func(r, g, b uint32) uint32 {
+			y := 0.2126*float64(srgb16ToLinear16[r]) +
+				0.7152*float64(srgb16ToLinear16[g]) +
+				0.0722*float64(srgb16ToLinear16[b])
+			return uint32(linear16ToSRGB16[uint16(y+0.5)])
+		}, nil
+	default:
+		return nil, fmt.Errorf("mode de gris inconnu: %q (rec601, rec709, average, lightness, red, green, blue, linear)", mode)
+	}
+}
+
+// Grayscale convertit l'image en niveaux de gris selon mode (voir grayFunc)
+func Grayscale(img image.Image, workers int, mode string) (*image.RGBA, error) {
+	gray, err := grayFunc(mode)
+	if err != nil {
+		return nil, err
+	}
+
+	// *image.Gray : déjà en niveaux de gris (tous les modes donnent R=G=B=Y), simple recopie
+	if g, ok := img.(*image.Gray); ok {
+		return grayToRGBA(g, workers), nil
+	}
+
+	src := toRGBA(img)
+	bounds := src.Bounds()
+	result := image.NewRGBA(bounds)
+
+	forBands(bounds, workers, func(startY, endY int) {
+		for y := startY; y < endY; y++ {
+			si := src.PixOffset(bounds.Min.X, y)
+			di := result.PixOffset(bounds.Min.X, y)
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				// calcul sur les valeurs 16 bits, comme avec RGBA()
+				r := uint32(src.Pix[si+0]) * 0x101
+				g := uint32(src.Pix[si+1]) * 0x101
+				b := uint32(src.Pix[si+2]) * 0x101
+				v := uint8(gray(r, g, b) >> 8)
+				result.Pix[di+0] = v
+				result.Pix[di+1] = v
+				result.Pix[di+2] = v
+				result.Pix[di+3] = 255
+				si += 4
+				di += 4
+			}
+		}
+	})
+	return result, nil
+}
+
+// grayToRGBA recopie une image *image.Gray dans un *image.RGBA (R=G=B=Y)
+func grayToRGBA(gray *image.Gray, workers int) *image.RGBA {
+	bounds := gray.Bounds()
+	result := image.NewRGBA(bounds)
+
+	forBands(bounds, workers, func(startY, endY int) {
+		for y := startY; y < endY; y++ {
+			si := gray.PixOffset(bounds.Min.X, y)
+			di := result.PixOffset(bounds.Min.X, y)
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				v := gray.Pix[si]
+				result.Pix[di+0] = v
+				result.Pix[di+1] = v
+				result.Pix[di+2] = v
+				result.Pix[di+3] = 255
+				si++
+				di += 4
+			}
+		}
+	})
 	return result
 }
 
 // Blur applique un flou "box blur" de rayon donné (radius >= 1)
 // radius = 1 -> ~3x3 ect...
-func Blur(img image.Image, workers int, radius int) *image.RGBA {
-	bounds := img.Bounds()
+// Deux passes séparables avec sommes glissantes : coût indépendant du rayon.
+// border : valeur des pixels hors de l'image (clamp, mirror, wrap, constant), ou
+// BorderShrink : fenêtre réduite aux pixels de l'image, moyenne sur ceux-là seulement.
+// linear : moyenne calculée en lumière linéaire (évite l'assombrissement des zones contrastées).
+func Blur(img image.Image, workers int, radius int, border Border, linear bool) *image.RGBA {
+	src := toRGBA(img)
+	bounds := src.Bounds()
 	result := image.NewRGBA(bounds)
 
 	if radius < 1 {
 		radius = 1
 	}
 
-	w, block, _ := splitWorkers(bounds, workers)
-	var wg sync.WaitGroup
+	// sommes sur 16 bits par canal (sRGB x 0x101, ou linéaire)
+	dec, enc := lightTables(linear)
 
-	for i := 0; i < w; i++ {
-		startY := bounds.Min.Y + i*block
-		endY := startY + block
-		if i == w-1 {
-			endY = bounds.Max.Y
-		}
+	wImg := bounds.Dx()
+	hImg := bounds.Dy()
+	bc := [3]uint64{uint64(dec[border.Color.R]), uint64(dec[border.Color.G]), uint64(dec[border.Color.B])}
+	if border.Mode == BorderShrink {
+		bc = [3]uint64{}
+	}
 
-		wg.Add(1)
-		go func(startY, endY int) {
-			defer wg.Done()
+	// 1) Passe horizontale : rows[(y, x)] = somme R,G,B de la fenêtre [x-r, x+r]
+	rows := make([]uint64, 3*wImg*hImg)
 
-			for y := startY; y < endY; y++ {
-				for x := bounds.Min.X; x < bounds.Max.X; x++ {
+	forBands(bounds, workers, func(startY, endY int) {
+		for y := startY; y < endY; y++ {
+			line := src.Pix[src.PixOffset(bounds.Min.X, y):]
+			row := rows[3*wImg*(y-bounds.Min.Y):]
 
-					var sumR, sumG, sumB uint32
-					var count uint32
+			// pixel (x relatif) de la ligne, selon le mode de bord
+			px := func(x int) (uint64, uint64, uint64) {
+				sx := border.index(x, wImg)
+				if sx < 0 {
+					return bc[0], bc[1], bc[2]
+				}
+				return uint64(dec[line[4*sx+0]]), uint64(dec[line[4*sx+1]]), uint64(dec[line[4*sx+2]])
+			}
 
-					// Voisinage (2*radius+1) x (2*radius+1)
-					for ny := y - radius; ny <= y+radius; ny++ {
-						if ny < bounds.Min.Y || ny >= bounds.Max.Y {
-							continue
-						}
-						for nx := x - radius; nx <= x+radius; nx++ {
-							if nx < bounds.Min.X || nx >= bounds.Max.X {
-								continue
-							}
-							r, g, b, _ := img.At(nx, ny).RGBA()
-							sumR += r
-							sumG += g
-							sumB += b
-							count++
-						}
-					}
+			var sumR, sumG, sumB uint64
+			for x := -radius; x <= radius; x++ {
+				r, g, b := px(x)
+				sumR += r
+				sumG += g
+				sumB += b
+			}
 
-					if count == 0 {
-						result.Set(x, y, img.At(x, y))
-						continue
-					}
+			for x := 0; x < wImg; x++ {
+				row[3*x+0] = sumR
+				row[3*x+1] = sumG
+				row[3*x+2] = sumB
+
+				// glissement : entre x+r+1, sort x-r
+				r, g, b := px(x + radius + 1)
+				sumR += r
+				sumG += g
+				sumB += b
+				r, g, b = px(x - radius)
+				sumR -= r
+				sumG -= g
+				sumB -= b
+			}
+		}
+	})
+
+	// ligne entièrement hors image (mode constant) : chaque fenêtre vaut (2r+1) * couleur
+	size := uint64(2*radius + 1)
+	constRow := make([]uint64, 3*wImg)
+	for x := 0; x < wImg; x++ {
+		for c := 0; c < 3; c++ {
+			constRow[3*x+c] = size * bc[c]
+		}
+	}
+	rowAt := func(y int) []uint64 {
+		sy := border.index(y, hImg)
+		if sy < 0 {
+			return constRow
+		}
+		return rows[3*wImg*sy : 3*wImg*(sy+1)]
+	}
 
-					avgR := uint8((sumR / count) >> 8)
-					avgG := uint8((sumG / count) >> 8)
-					avgB := uint8((sumB / count) >> 8)
+	spanX, spanY := windowSpans(wImg, radius, border), windowSpans(hImg, radius, border)
 
-					result.Set(x, y, color.RGBA{avgR, avgG, avgB, 255})
-				}
+	// 2) Passe verticale : somme glissante des lignes, par colonne
+	forBands(bounds, workers, func(startY, endY int) {
+		y0 := startY - bounds.Min.Y
+		y1 := endY - bounds.Min.Y
+		sums := make([]uint64, 3*wImg)
+
+		for yy := y0 - radius; yy <= y0+radius; yy++ {
+			for i, v := range rowAt(yy) {
+				sums[i] += v
 			}
-		}(startY, endY)
-	}
+		}
+
+		for y := y0; y < y1; y++ {
+			di := result.PixOffset(bounds.Min.X, bounds.Min.Y+y)
+			for x := 0; x < wImg; x++ {
+				count := spanX[x] * spanY[y]
+				result.Pix[di+0] = enc[sums[3*x+0]/count]
+				result.Pix[di+1] = enc[sums[3*x+1]/count]
+				result.Pix[di+2] = enc[sums[3*x+2]/count]
+				result.Pix[di+3] = 255
+				di += 4
+			}
+
+			// glissement : entre la ligne y+r+1, sort la ligne y-r
+			for i, v := range rowAt(y + radius + 1) {
+				sums[i] += v
+			}
+			for i, v := range rowAt(y - radius) {
+				sums[i] -= v
+			}
+		}
+	})
 
-	wg.Wait()
 	return result
 }
 
-// Sobel détecte les contours (approx gradient)
-func Sobel(img image.Image, workers int) *image.RGBA {
-	bounds := img.Bounds()
-	out := image.NewRGBA(bounds)
+// windowSpans : nombre de pixels de la fenêtre [i-r, i+r] pour chaque position 0..n-1,
+// 2r+1 partout sauf en BorderShrink où la fenêtre est rognée à l'image
+func windowSpans(n int, radius int, border Border) []uint64 {
+	spans := make([]uint64, n)
+	for i := range spans {
+		if border.Mode == BorderShrink {
+			spans[i] = uint64(min(i+radius, n-1) - max(i-radius, 0) + 1)
+		} else {
+			spans[i] = uint64(2*radius + 1)
+		}
+	}
+	return spans
+}
 
-	gx := [][]int{
-		{-1, 0, 1},
-		{-2, 0, 2},
-		{-1, 0, 1},
+// SobelOptions : variantes du détecteur de contours
+type SobelOptions struct {
+	Operator  string // "sobel" (défaut), "scharr" ou "prewitt"
+	Direction bool   // sortie couleur : teinte = direction du gradient, luminosité = magnitude
+	Threshold int    // > 0 : sortie binaire, blanc si magnitude >= Threshold (échelle 0..255)
+}
+
+// edgeKernels renvoie les noyaux gx/gy de l'opérateur et le facteur qui ramène
+// sa magnitude à l'échelle de Sobel (somme des poids positifs = 4).
+func edgeKernels(operator string) (gx, gy [3][3]float32, scale float32, err error) {
+	switch operator {
+	case "", "sobel":
+		gx = [3][3]float32{{-1, 0, 1}, {-2, 0, 2}, {-1, 0, 1}}
+		scale = 1
+	case "scharr":
+		gx = [3][3]float32{{-3, 0, 3}, {-10, 0, 10}, {-3, 0, 3}}
+		scale = 4.0 / 16
+	case "prewitt":
+		gx = [3][3]float32{{-1, 0, 1}, {-1, 0, 1}, {-1, 0, 1}}
+		scale = 4.0 / 3
+	default:
+		return gx, gy, 0, fmt.Errorf("opérateur inconnu: %q (sobel, scharr, prewitt)", operator)
 	}
-	gy := [][]int{
-		{1, 2, 1},
-		{0, 0, 0},
-		{-1, -2, -1},
+	// gy = transposée de gx, orientée vers le haut comme l'ancien Sobel
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			gy[i][j] = -gx[j][i]
+		}
 	}
+	return gx, gy, scale, nil
+}
 
-	w, block, _ := splitWorkers(bounds, workers)
-	var wg sync.WaitGroup
+// luma renvoie la luminance Rec.601 (0.299 R + 0.587 G + 0.114 B)
+func luma(r, g, b float32) float32 {
+	return 0.299*r + 0.587*g + 0.114*b
+}
 
-	for i := 0; i < w; i++ {
-		wg.Add(1)
-		startY := bounds.Min.Y + i*block
-		endY := startY + block
-		if i == w-1 {
-			endY = bounds.Max.Y
+// lumaPlane calcule la luminance de chaque pixel (plan w*h, valeurs 0..255)
+func lumaPlane(src *image.RGBA, workers int) []float32 {
+	bounds := src.Bounds()
+	wImg := bounds.Dx()
+	lum := make([]float32, wImg*bounds.Dy())
+
+	forBands(bounds, workers, func(startY, endY int) {
+		for y := startY; y < endY; y++ {
+			pi := src.PixOffset(bounds.Min.X, y)
+			row := lum[(y-bounds.Min.Y)*wImg:]
+			for x := 0; x < wImg; x++ {
+				row[x] = luma(float32(src.Pix[pi]), float32(src.Pix[pi+1]), float32(src.Pix[pi+2]))
+				pi += 4
+			}
 		}
+	})
+	return lum
+}
 
-		go func(startY, endY int) {
-			defer wg.Done()
+// gradientPlanes applique gx/gy (3x3) sur un plan de luminance w*h.
+// outside : valeur des pixels hors image en mode BorderConstant.
+func gradientPlanes(lum []float32, wImg, hImg int, workers int, border Border, outside float32,
+	kx, ky [3][3]float32) (gxs, gys []float32) {
 
-			for y := startY; y < endY; y++ {
-				for x := bounds.Min.X + 1; x < bounds.Max.X-1; x++ {
-					var sumX, sumY int
-
-					for ky := -1; ky <= 1; ky++ {
-						for kx := -1; kx <= 1; kx++ {
-							if y+ky < bounds.Min.Y || y+ky >= bounds.Max.Y ||
-								x+kx < bounds.Min.X || x+kx >= bounds.Max.X {
-								continue
-							}
-							r, _, _, _ := img.At(x+kx, y+ky).RGBA()
-							gray := int(r >> 8)
-							sumX += gray * gx[ky+1][kx+1]
-							sumY += gray * gy[ky+1][kx+1]
-						}
-					}
+	gxs = make([]float32, wImg*hImg)
+	gys = make([]float32, wImg*hImg)
+
+	forBands(image.Rect(0, 0, wImg, hImg), workers, func(startY, endY int) {
+		for y := startY; y < endY; y++ {
+			var rows [3]int
+			for dy := 0; dy < 3; dy++ {
+				rows[dy] = border.index(y+dy-1, hImg)
+			}
 
-					magnitude := uint8(math.Min(
-						255,
-						math.Sqrt(float64(sumX*sumX+sumY*sumY)),
-					))
+			for x := 0; x < wImg; x++ {
+				var sumX, sumY float32
 
-					out.Set(x, y, color.RGBA{magnitude, magnitude, magnitude, 255})
+				for dy := 0; dy < 3; dy++ {
+					for dx := 0; dx < 3; dx++ {
+						sx := border.index(x+dx-1, wImg)
+						v := outside
+						if rows[dy] >= 0 && sx >= 0 {
+							v = lum[rows[dy]*wImg+sx]
+						}
+						sumX += v * kx[dy][dx]
+						sumY += v * ky[dy][dx]
+					}
 				}
+
+				gxs[y*wImg+x] = sumX
+				gys[y*wImg+x] = sumY
 			}
-		}(startY, endY)
+		}
+	})
+	return gxs, gys
+}
+
+// hueColor : couleur de teinte hue (degrés) et de luminosité value (0..1), saturation max
+func hueColor(hue float64, value float64) (r, g, b float64) {
+	h := math.Mod(hue, 360) / 60
+	if h < 0 {
+		h += 6
 	}
+	x := value * (1 - math.Abs(math.Mod(h, 2)-1))
+	switch int(h) {
+	case 0:
+		return value, x, 0
+	case 1:
+		return x, value, 0
+	case 2:
+		return 0, value, x
+	case 3:
+		return 0, x, value
+	case 4:
+		return x, 0, value
+	default:
+		return value, 0, x
+	}
+}
 
-	wg.Wait()
-	return out
+// Sobel détecte les contours (approx gradient de la luminance)
+// border : valeur des pixels hors de l'image, le cadre de 1 pixel est donc aussi calculé.
+// opts : opérateur (sobel, scharr, prewitt), sortie direction (teinte) et seuil binaire.
+func Sobel(img image.Image, workers int, border Border, opts SobelOptions) (*image.RGBA, error) {
+	kx, ky, scale, err := edgeKernels(opts.Operator)
+	if err != nil {
+		return nil, err
+	}
+
+	src := toRGBA(img)
+	bounds := src.Bounds()
+	out := image.NewRGBA(bounds)
+
+	wImg := bounds.Dx()
+	hImg := bounds.Dy()
+	outside := luma(float32(border.Color.R), float32(border.Color.G), float32(border.Color.B))
+
+	lum := lumaPlane(src, workers)
+	gxs, gys := gradientPlanes(lum, wImg, hImg, workers, border, outside, kx, ky)
+
+	forBands(bounds, workers, func(startY, endY int) {
+		for y := startY; y < endY; y++ {
+			di := out.PixOffset(bounds.Min.X, y)
+			for x := 0; x < wImg; x++ {
+				i := (y-bounds.Min.Y)*wImg + x
+				gx, gy := float64(gxs[i]), float64(gys[i])
+				magnitude := math.Min(255, math.Sqrt(gx*gx+gy*gy)*float64(scale))
+
+				if opts.Threshold > 0 {
+					if magnitude >= float64(opts.Threshold) {
+						magnitude = 255
+					} else {
+						magnitude = 0
+					}
+				}
+
+				if opts.Direction {
+					r, g, b := hueColor(math.Atan2(gy, gx)*180/math.Pi, magnitude/255)
+					out.Pix[di+0] = uint8(r*255 + 0.5)
+					out.Pix[di+1] = uint8(g*255 + 0.5)
+					out.Pix[di+2] = uint8(b*255 + 0.5)
+				} else {
+					m := uint8(magnitude)
+					out.Pix[di+0] = m
+					out.Pix[di+1] = m
+					out.Pix[di+2] = m
+				}
+				out.Pix[di+3] = 255
+				di += 4
+			}
+		}
+	})
+	return out, nil
 }
 
-// MedianFilter applique un filtre médian 3x3 (réduction du bruit impulsionnel)
-func MedianFilter(img image.Image, workers int) *image.RGBA {
-	bounds := img.Bounds()
+// MedianFilter applique un filtre de rang (médiane par défaut) de rayon donné
+// (fenêtre (2*radius+1) x (2*radius+1), réduction du bruit impulsionnel).
+// percentile = rang dans la fenêtre triée : 0 -> min, 50 -> médiane, 100 -> max.
+// L'histogramme de la fenêtre glisse le long de la ligne (Huang) ; pour les grands
+// rayons on passe par des histogrammes de colonnes mis à jour en descendant
+// (Perreault–Hébert) -> coût par pixel indépendant du rayon.
+// border : valeur des pixels hors de l'image (clamp, mirror, wrap, constant).
+// Pas d'option linear : un filtre de rang ne dépend que de l'ordre des valeurs,
+// que la conversion sRGB -> linéaire conserve (résultat identique).
+func MedianFilter(img image.Image, workers int, radius int, percentile int, border Border) *image.RGBA {
+	src := toRGBA(img)
+	bounds := src.Bounds()
 	out := image.NewRGBA(bounds)
 
-	w, block, _ := splitWorkers(bounds, workers)
-	var wg sync.WaitGroup
+	if radius < 1 {
+		radius = 1
+	}
+	percentile = min(max(percentile, 0), 100)
 
-	for i := 0; i < w; i++ {
-		startY := bounds.Min.Y + i*block
-		endY := startY + block
-		if i == w-1 {
-			endY = bounds.Max.Y
+	wImg := bounds.Dx()
+	hImg := bounds.Dy()
+	size := 2*radius + 1
+	rank := int32(percentile * (size*size - 1) / 100)
+	useCols := size > medianColumnThreshold
+	bc := [3]uint8{border.Color.R, border.Color.G, border.Color.B}
+
+	forBands(bounds, workers, func(startY, endY int) {
+		y0 := startY - bounds.Min.Y
+		y1 := endY - bounds.Min.Y
+
+		// cols[(x*3+c)*256 + v] : histogramme de la colonne x (lignes y-r..y+r), canal c
+		var cols []uint16
+		addRow := func(yy int, delta uint16) {
+			sy := border.index(yy, hImg)
+			if sy < 0 {
+				for x := 0; x < wImg; x++ {
+					for c := 0; c < 3; c++ {
+						cols[(x*3+c)*256+int(bc[c])] += delta
+					}
+				}
+				return
+			}
+			pi := src.PixOffset(bounds.Min.X, bounds.Min.Y+sy)
+			for x := 0; x < wImg; x++ {
+				for c := 0; c < 3; c++ {
+					cols[(x*3+c)*256+int(src.Pix[pi+c])] += delta
+				}
+				pi += 4
+			}
+		}
+		if useCols {
+			cols = make([]uint16, wImg*3*256)
+			for yy := y0 - radius; yy <= y0+radius; yy++ {
+				addRow(yy, 1)
+			}
 		}
 
-		wg.Add(1)
-		go func(startY, endY int) {
-			defer wg.Done()
+		var kernel [3]rankHist
 
-			for y := startY; y < endY; y++ {
-				for x := bounds.Min.X; x < bounds.Max.X; x++ {
-					var reds, greens, blues [9]uint8
-					idx := 0
-
-					for dy := -1; dy <= 1; dy++ {
-						for dx := -1; dx <= 1; dx++ {
-							nx, ny := x+dx, y+dy
-							if nx >= bounds.Min.X && nx < bounds.Max.X &&
-								ny >= bounds.Min.Y && ny < bounds.Max.Y {
-								r, g, b, _ := img.At(nx, ny).RGBA()
-								reds[idx] = uint8(r >> 8)
-								greens[idx] = uint8(g >> 8)
-								blues[idx] = uint8(b >> 8)
-							}
-							idx++
+		// addCol ajoute (sign=1) ou retire (sign=-1) la colonne x (lignes y-r..y+r) de la fenêtre
+		addCol := func(x, y int, sign int32) {
+			sx := border.index(x, wImg)
+			switch {
+			case sx < 0:
+				for c := range kernel {
+					kernel[c].add(bc[c], sign*int32(size))
+				}
+			case useCols:
+				for c := range kernel {
+					kernel[c].addHist(cols[(sx*3+c)*256:(sx*3+c+1)*256], sign)
+				}
+			default:
+				for yy := y - radius; yy <= y+radius; yy++ {
+					sy := border.index(yy, hImg)
+					if sy < 0 {
+						for c := range kernel {
+							kernel[c].add(bc[c], sign)
 						}
+						continue
 					}
+					pi := src.PixOffset(bounds.Min.X+sx, bounds.Min.Y+sy)
+					for c := range kernel {
+						kernel[c].add(src.Pix[pi+c], sign)
+					}
+				}
+			}
+		}
 
-					sort.Slice(reds[:], func(i, j int) bool { return reds[i] < reds[j] })
-					sort.Slice(greens[:], func(i, j int) bool { return greens[i] < greens[j] })
-					sort.Slice(blues[:], func(i, j int) bool { return blues[i] < blues[j] })
+		for y := y0; y < y1; y++ {
+			if useCols && y > y0 {
+				// descente : la ligne y-r-1 sort, la ligne y+r entre
+				addRow(y-radius-1, ^uint16(0))
+				addRow(y+radius, 1)
+			}
+
+			kernel = [3]rankHist{}
+			for x := -radius; x <= radius; x++ {
+				addCol(x, y, 1)
+			}
 
-					out.Set(x, y, color.RGBA{reds[4], greens[4], blues[4], 255})
+			di := out.PixOffset(bounds.Min.X, bounds.Min.Y+y)
+			for x := 0; x < wImg; x++ {
+				for c := range kernel {
+					out.Pix[di+c] = kernel[c].value(rank)
 				}
+				out.Pix[di+3] = 255
+				di += 4
+
+				addCol(x+radius+1, y, 1)
+				addCol(x-radius, y, -1)
 			}
-		}(startY, endY)
+		}
+	})
+	return out
+}
+
+// Au-delà de cette taille de fenêtre, ajouter un histogramme de colonne (256 cases)
+// coûte moins cher que d'ajouter les pixels de la colonne un par un.
+const medianColumnThreshold = 48
+
+// rankHist : histogramme 256 cases d'une fenêtre, avec suivi incrémental du rang
+// (med = valeur courante, lt = nombre de valeurs < med).
+type rankHist struct {
+	hist [256]int32
+	med  int
+	lt   int32
+}
+
+func (h *rankHist) add(v uint8, n int32) {
+	h.hist[v] += n
+	if int(v) < h.med {
+		h.lt += n
 	}
+}
 
-	wg.Wait()
-	return out
+func (h *rankHist) addHist(col []uint16, sign int32) {
+	for v := 0; v < h.med; v++ {
+		n := sign * int32(col[v])
+		h.hist[v] += n
+		h.lt += n
+	}
+	for v := h.med; v < 256; v++ {
+		h.hist[v] += sign * int32(col[v])
+	}
+}
+
+// value renvoie la valeur de rang donné (0 = plus petite) en partant de la précédente
+func (h *rankHist) value(rank int32) uint8 {
+	for h.lt > rank {
+		h.med--
+		h.lt -= h.hist[h.med]
+	}
+	for h.lt+h.hist[h.med] <= rank {
+		h.lt += h.hist[h.med]
+		h.med++
+	}
+	return uint8(h.med)
 }
 
 // Pixelate applique un effet mosaïque (pixelation)
 // blockSize = taille des blocs (>= 2).
-func Pixelate(img image.Image, workers int, blockSize int) *image.RGBA {
-	bounds := img.Bounds()
+// linear : moyenne des blocs calculée en lumière linéaire.
+func Pixelate(img image.Image, workers int, blockSize int, linear bool) *image.RGBA {
+	src := toRGBA(img)
+	bounds := src.Bounds()
 	out := image.NewRGBA(bounds)
 
 	if blockSize < 2 {
 		blockSize = 2
 	}
 
-	w, block, _ := splitWorkers(bounds, workers)
-	var wg sync.WaitGroup
-
-	for i := 0; i < w; i++ {
-		startY := bounds.Min.Y + i*block
-		endY := startY + block
-		if i == w-1 {
-			endY = bounds.Max.Y
-		}
-
-		wg.Add(1)
-		go func(startY, endY int) {
-			defer wg.Done()
-
-			// On avance par pas de blockSize
-			for y := startY; y < endY; y += blockSize {
-				for x := bounds.Min.X; x < bounds.Max.X; x += blockSize {
-
-					var sumR, sumG, sumB uint32
-					var count uint32
-
-					// 1) moyenne du bloc
-					for yy := y; yy < y+blockSize && yy < bounds.Max.Y; yy++ {
-						for xx := x; xx < x+blockSize && xx < bounds.Max.X; xx++ {
-							r, g, b, _ := img.At(xx, yy).RGBA()
-							sumR += r >> 8
-							sumG += g >> 8
-							sumB += b >> 8
-							count++
+	forBands(bounds, workers, func(startY, endY int) {
+		// On avance par pas de blockSize
+		for y := startY; y < endY; y += blockSize {
+			yEnd := min(y+blockSize, bounds.Max.Y)
+
+			for x := bounds.Min.X; x < bounds.Max.X; x += blockSize {
+				xEnd := min(x+blockSize, bounds.Max.X)
+
+				var sumR, sumG, sumB uint64
+
+				// 1) moyenne du bloc : entière sur 8 bits, ou sur 16 bits en lumière linéaire
+				for yy := y; yy < yEnd; yy++ {
+					pi := src.PixOffset(x, yy)
+					for xx := x; xx < xEnd; xx++ {
+						if linear {
+							sumR += uint64(srgb8ToLinear16[src.Pix[pi+0]])
+							sumG += uint64(srgb8ToLinear16[src.Pix[pi+1]])
+							sumB += uint64(srgb8ToLinear16[src.Pix[pi+2]])
+						} else {
+							sumR += uint64(src.Pix[pi+0])
+							sumG += uint64(src.Pix[pi+1])
+							sumB += uint64(src.Pix[pi+2])
 						}
+						pi += 4
 					}
-					if count == 0 {
-						continue
-					}
+				}
+				count := uint64((yEnd - y) * (xEnd - x))
+
+				avgR := uint8(sumR / count)
+				avgG := uint8(sumG / count)
+				avgB := uint8(sumB / count)
+				if linear {
+					avgR = linear16ToSRGB8[sumR/count]
+					avgG = linear16ToSRGB8[sumG/count]
+					avgB = linear16ToSRGB8[sumB/count]
+				}
 
-					avg := color.RGBA{
-						R: uint8(sumR / count),
-						G: uint8(sumG / count),
-						B: uint8(sumB / count),
-						A: 255,
+				// 2) remplissage du bloc
+				for yy := y; yy < yEnd; yy++ {
+					di := out.PixOffset(x, yy)
+					for xx := x; xx < xEnd; xx++ {
+						out.Pix[di+0] = avgR
+						out.Pix[di+1] = avgG
+						out.Pix[di+2] = avgB
+						out.Pix[di+3] = 255
+						di += 4
 					}
+				}
+			}
+		}
+	})
+	return out
+}
 
-					// 2) remplissage du bloc
-					for yy := y; yy < y+blockSize && yy < bounds.Max.Y; yy++ {
-						for xx := x; xx < x+blockSize && xx < bounds.Max.X; xx++ {
-							out.Set(xx, yy, avg)
-						}
-					}
+// channelHistograms compte les valeurs R, G, B et, si luma, la luminance : un histogramme
+// local par bande, fusionnés à la fin.
+func channelHistograms(src *image.RGBA, workers int, luma bool) [4][256]int {
+	bounds := src.Bounds()
+	gray, _ := grayFunc("rec601")
+
+	var total [4][256]int
+	var mu sync.Mutex
+	forBands(bounds, workers, func(startY, endY int) {
+		var hist [4][256]int
+		for y := startY; y < endY; y++ {
+			pi := src.PixOffset(bounds.Min.X, y)
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				r, g, b := src.Pix[pi+0], src.Pix[pi+1], src.Pix[pi+2]
+				hist[0][r]++
+				hist[1][g]++
+				hist[2][b]++
+				if luma {
+					hist[3][gray(uint32(r)*0x101, uint32(g)*0x101, uint32(b)*0x101)>>8]++
 				}
+				pi += 4
 			}
-		}(startY, endY)
-	}
+		}
 
-	wg.Wait()
-	return out
+		mu.Lock()
+		for c := range hist {
+			for v, n := range hist[c] {
+				total[c][v] += n
+			}
+		}
+		mu.Unlock()
+	})
+	return total
 }
 
 // PosterizeQuantilesColor applique une posterization couleur basée sur des quantiles globaux,
+// séparément sur R, G et B.
+// levels = nombre de niveaux par canal (>=2). Couleurs possibles ~ levels^3.
+// Les quantiles viennent d'histogrammes 256 classes calculés par bandes puis fusionnés :
+// O(N) sans tri ni copie des canaux, mêmes tables que buildQuantileLUT sur les valeurs triées.
 func PosterizeQuantilesColor(img image.Image, workers int, levels int) *image.RGBA {
 	if levels < 2 {
 		levels = 2
 	}
 
-	bounds := img.Bounds()
-	wImg := bounds.Dx()
-	hImg := bounds.Dy()
+	src := toRGBA(img)
 
-	// Conversion en RGBA pour accès rapide
-	src := image.NewRGBA(bounds)
-	draw.Draw(src, bounds, img, bounds.Min, draw.Src)
+	// 1) Histogrammes R, G, B (par bandes, fusionnés) et LUT par canal
+	hists := channelHistograms(src, workers, false)
+	lut := pointLUT{curves: [3][256]uint8{
+		quantileLUT(&hists[0], levels),
+		quantileLUT(&hists[1], levels),
+		quantileLUT(&hists[2], levels),
+	}}
 
-	// 1) Récupérer R,G,B en parallèle (tableaux de taille N)
-	n := wImg * hImg
-	rs := make([]uint8, n)
-	gs := make([]uint8, n)
-	bs := make([]uint8, n)
+	// 2) Application parallèle
+	return applyPointLUT(src, workers, &lut)
+}
 
-	w, block, _ := splitWorkers(bounds, workers)
-	var wg sync.WaitGroup
+// pointLUT : correction ponctuelle (chaque pixel ne dépend que de lui-même) : une table
+// par canal, puis une fonction optionnelle pour les corrections qui mélangent les canaux
+// (teinte, saturation, sépia). Celle-ci est calculée exactement pour chaque pixel : une
+// table 3D interpolée s'écarte de plusieurs dizaines de niveaux près du noir, du blanc et
+// de l'axe des gris, où la teinte varie brusquement.
+type pointLUT struct {
+	curves [3][256]uint8
+	mix    func(r, g, b float64) (float64, float64, float64) // valeurs 0..255
+}
 
-	for i := 0; i < w; i++ {
-		startY := bounds.Min.Y + i*block
-		endY := startY + block
-		if i == w-1 {
-			endY = bounds.Max.Y
+// identityCurves renvoie les tables qui ne changent rien
+func identityCurves() [3][256]uint8 {
+	var curves [3][256]uint8
+	for c := range curves {
+		for v := range curves[c] {
+			curves[c][v] = uint8(v)
 		}
-
-		wg.Add(1)
-		go func(startY, endY int) {
-			defer wg.Done()
-			for y := startY; y < endY; y++ {
-				yy := y - bounds.Min.Y
-				base := yy * wImg
-				for x := bounds.Min.X; x < bounds.Max.X; x++ {
-					xx := x - bounds.Min.X
-					pi := src.PixOffset(x, y)
-					idx := base + xx
-					rs[idx] = src.Pix[pi+0]
-					gs[idx] = src.Pix[pi+1]
-					bs[idx] = src.Pix[pi+2]
-				}
-			}
-		}(startY, endY)
 	}
-	wg.Wait()
-
-	// 2) Tri global (dominant) et LUT par canal
-	sr := make([]uint8, n)
-	sg := make([]uint8, n)
-	sb := make([]uint8, n)
-	copy(sr, rs)
-	copy(sg, gs)
-	copy(sb, bs)
-
-	sort.Slice(sr, func(i, j int) bool { return sr[i] < sr[j] })
-	sort.Slice(sg, func(i, j int) bool { return sg[i] < sg[j] })
-	sort.Slice(sb, func(i, j int) bool { return sb[i] < sb[j] })
+	return curves
+}
 
-	lutR := buildQuantileLUT(sr, levels)
-	lutG := buildQuantileLUT(sg, levels)
-	lutB := buildQuantileLUT(sb, levels)
+// mixChannel arrondit une valeur de mix et l'écrête à 0..255
+func mixChannel(v float64) uint8 {
+	return uint8(min(max(v+0.5, 0), 255))
+}
 
-	// 3) Application parallèle
+// applyPointLUT applique la correction à chaque pixel, en parallèle par bandes (alpha conservé).
+func applyPointLUT(src *image.RGBA, workers int, lut *pointLUT) *image.RGBA {
+	bounds := src.Bounds()
 	out := image.NewRGBA(bounds)
 
-	for i := 0; i < w; i++ {
-		startY := bounds.Min.Y + i*block
-		endY := startY + block
-		if i == w-1 {
-			endY = bounds.Max.Y
-		}
-
-		wg.Add(1)
-		go func(startY, endY int) {
-			defer wg.Done()
-			for y := startY; y < endY; y++ {
-				yy := y - bounds.Min.Y
-				base := yy * wImg
-				for x := bounds.Min.X; x < bounds.Max.X; x++ {
-					xx := x - bounds.Min.X
-					idx := base + xx
-
-					pi := src.PixOffset(x, y)
-					a := src.Pix[pi+3]
-
-					rq := lutR[rs[idx]]
-					gq := lutG[gs[idx]]
-					bq := lutB[bs[idx]]
-
-					di := out.PixOffset(x, y)
-					out.Pix[di+0] = rq
-					out.Pix[di+1] = gq
-					out.Pix[di+2] = bq
-					out.Pix[di+3] = a
+	forBands(bounds, workers, func(startY, endY int) {
+		for y := startY; y < endY; y++ {
+			si := src.PixOffset(bounds.Min.X, y)
+			di := out.PixOffset(bounds.Min.X, y)
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				r := lut.curves[0][src.Pix[si+0]]
+				g := lut.curves[1][src.Pix[si+1]]
+				b := lut.curves[2][src.Pix[si+2]]
+				if lut.mix != nil {
+					mr, mg, mb := lut.mix(float64(r), float64(g), float64(b))
+					r, g, b = mixChannel(mr), mixChannel(mg), mixChannel(mb)
 				}
+				out.Pix[di+0], out.Pix[di+1], out.Pix[di+2] = r, g, b
+				out.Pix[di+3] = src.Pix[si+3]
+				si += 4
+				di += 4
 			}
-		}(startY, endY)
-	}
-	wg.Wait()
+		}
+	})
 
 	return out
 }
 
-// buildQuantileLUT construit une table 0..255 -> niveau représentatif basé sur les quantiles.
-func buildQuantileLUT(sortedVals []uint8, levels int) [256]uint8 {
-	var lut [256]uint8
-	n := len(sortedVals)
+// QuantileBin : un niveau de la posterization par quantiles
+type QuantileBin struct {
+	Min   uint8 `json:"min"`   // plus petite valeur du niveau
+	Max   uint8 `json:"max"`   // plus grande valeur du niveau
+	Value uint8 `json:"value"` // valeur de sortie (moyenne des valeurs du niveau)
+}
 
-	if n == 0 || levels < 2 {
-		for v := 0; v < 256; v++ {
-			lut[v] = uint8(v)
-		}
-		return lut
+// quantileBins découpe les valeurs (données par leur histogramme) en levels groupes de
+// même effectif, comme si elles étaient triées (au plus un groupe par valeur).
+func quantileBins(hist *[256]int, levels int) []QuantileBin {
+	// cum[v] = nombre de valeurs < v, sums[v] = somme des valeurs < v
+	var cum, sums [257]int
+	for v, c := range hist {
+		cum[v+1] = cum[v] + c
+		sums[v+1] = sums[v] + v*c
+	}
+	n := cum[256]
+	if n == 0 {
+		return nil
 	}
 	if levels > n {
 		levels = n
 	}
 
-	reps := make([]uint8, levels)
-	binMax := make([]uint8, levels)
+	// valueAt(i) : i-ème valeur triée ; sumBefore(i) : somme des i premières
+	valueAt := func(i int) int {
+		return sort.Search(256, func(v int) bool { return cum[v+1] > i })
+	}
+	sumBefore := func(i int) int {
+		if i >= n {
+			return sums[256]
+		}
+		v := valueAt(i)
+		return sums[v] + v*(i-cum[v])
+	}
 
+	bins := make([]QuantileBin, levels)
 	for b := 0; b < levels; b++ {
 		start := b * n / levels
 		end := (b + 1) * n / levels
@@ -442,20 +857,92 @@ func buildQuantileLUT(sortedVals []uint8, levels int) [256]uint8 {
 			}
 		}
 
-		sum := 0
-		for i := start; i < end; i++ {
-			sum += int(sortedVals[i])
+		sum := sumBefore(end) - sumBefore(start)
+		bins[b] = QuantileBin{uint8(valueAt(start)), uint8(valueAt(end - 1)), uint8(sum / (end - start))}
+	}
+	return bins
+}
+
+// quantileLUT construit une table 0..255 -> niveau représentatif basé sur les quantiles
+// de l'histogramme.
+func quantileLUT(hist *[256]int, levels int) [256]uint8 {
+	var lut [256]uint8
+
+	bins := quantileBins(hist, levels)
+	if len(bins) == 0 || levels < 2 {
+		for v := 0; v < 256; v++ {
+			lut[v] = uint8(v)
 		}
-		reps[b] = uint8(sum / (end - start))
-		binMax[b] = sortedVals[end-1]
+		return lut
 	}
 
 	b := 0
 	for v := 0; v < 256; v++ {
-		for b < levels-1 && uint8(v) > binMax[b] {
+		for b < len(bins)-1 && uint8(v) > bins[b].Max {
 			b++
 		}
-		lut[v] = reps[b]
+		lut[v] = bins[b].Value
 	}
 	return lut
 }
+
+// buildQuantileLUT construit une table 0..255 -> niveau représentatif basé sur les quantiles
+// des valeurs triées.
+func buildQuantileLUT(sortedVals []uint8, levels int) [256]uint8 {
+	var hist [256]int
+	for _, v := range sortedVals {
+		hist[v]++
+	}
+	return quantileLUT(&hist, levels)
+}
+
+// srgbToLinear décode une valeur sRGB (0..1) en lumière linéaire (0..1)
+func srgbToLinear(v float64) float64 {
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+// linearToSRGB encode une valeur linéaire (0..1) en sRGB (0..1)
+func linearToSRGB(v float64) float64 {
+	if v <= 0.0031308 {
+		return v * 12.92
+	}
+	return 1.055*math.Pow(v, 1/2.4) - 0.055
+}
+
+// Tables de conversion des filtres de moyenne (option linear).
+// Les valeurs linéaires sont gardées sur 16 bits : 8 bits ne suffisent pas dans les tons sombres.
+var (
+	srgb8ToLinear16  [256]uint16   // sRGB 8 bits -> linéaire 16 bits
+	linear16ToSRGB8  [65536]uint8  // linéaire 16 bits -> sRGB 8 bits
+	srgb16ToLinear16 [65536]uint16 // sRGB 16 bits -> linéaire 16 bits
+	linear16ToSRGB16 [65536]uint16 // linéaire 16 bits -> sRGB 16 bits
+
+	widen8   [256]uint16  // 8 -> 16 bits sans changer d'espace (x 0x101)
+	narrow16 [65536]uint8 // 16 -> 8 bits sans changer d'espace (>> 8)
+)
+
+func init() {
+	for v := range 256 {
+		srgb8ToLinear16[v] = uint16(srgbToLinear(float64(v)/255)*0xffff + 0.5)
+		widen8[v] = uint16(v * 0x101)
+	}
+	for v := range 65536 {
+		f := float64(v) / 0xffff
+		linear16ToSRGB8[v] = uint8(linearToSRGB(f)*255 + 0.5)
+		srgb16ToLinear16[v] = uint16(srgbToLinear(f)*0xffff + 0.5)
+		linear16ToSRGB16[v] = uint16(linearToSRGB(f)*0xffff + 0.5)
+		narrow16[v] = uint8(v >> 8)
+	}
+}
+
+// lightTables renvoie les tables de décodage (8 -> 16 bits) et d'encodage (16 -> 8 bits)
+// des filtres de moyenne : en lumière linéaire si linear, sinon simple changement de précision.
+func lightTables(linear bool) (dec *[256]uint16, enc *[65536]uint8) {
+	if linear {
+		return &srgb8ToLinear16, &linear16ToSRGB8
+	}
+	return &widen8, &narrow16
+}
@@ -28,11 +28,11 @@ func main() {
 		img := genImage(s)
 
 		start := time.Now()
-		Blur(img, 1, 5)
+		Blur(img, 1, 5, Border{Mode: BorderShrink}, false)
 		tSeq := time.Since(start)
 
 		start = time.Now()
-		Blur(img, workers, 5)
+		Blur(img, workers, 5, Border{Mode: BorderShrink}, false)
 		tPar := time.Since(start)
 
 		fmt.Printf("\n%d x %d\n", s, s)
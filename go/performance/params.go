@@ -0,0 +1,133 @@
+// params.go
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Params : paramètres optionnels d'une requête, en plus du radius.
+// Format sur le réseau : "cle=valeur;cle=valeur" (chaîne vide = aucun paramètre).
+type Params map[string]string
+
+// parseParams découpe "cle=valeur;cle=valeur" en Params.
+func parseParams(s string) (Params, error) {
+	p := Params{}
+	for _, field := range strings.Split(s, ";") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(field, "=")
+		if !ok || strings.TrimSpace(key) == "" {
+			return nil, fmt.Errorf("paramètre invalide: %q (attendu cle=valeur)", field)
+		}
+		p[strings.ToLower(strings.TrimSpace(key))] = strings.TrimSpace(value)
+	}
+	return p, nil
+}
+
+// String renvoie le paramètre key en minuscules, ou def s'il est absent.
+func (p Params) String(key string, def string) string {
+	v, ok := p[key]
+	if !ok || v == "" {
+		return def
+	}
+	return strings.ToLower(v)
+}
+
+// paramReader lit les paramètres typés d'une requête. Une valeur mal formée donne def et
+// garde la première erreur dans err : l'appelant lit tout, vérifie err, puis seulement
+// applique le filtre. Un reader par appel (les frames d'un GIF lisent les mêmes Params en parallèle).
+type paramReader struct {
+	Params
+	err error
+}
+
+func (p Params) reader() *paramReader {
+	return &paramReader{Params: p}
+}
+
+// fail garde la première erreur de conversion.
+func (r *paramReader) fail(key, v, want string) {
+	if r.err == nil {
+		r.err = fmt.Errorf("paramètre %s invalide: %q (%s attendu)", key, v, want)
+	}
+}
+
+// Int renvoie le paramètre entier key, ou def s'il est absent.
+func (r *paramReader) Int(key string, def int) int {
+	v, ok := r.Params[key]
+	if !ok {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		r.fail(key, v, "entier")
+		return def
+	}
+	return n
+}
+
+// Float renvoie le paramètre réel key, ou def s'il est absent.
+func (r *paramReader) Float(key string, def float64) float64 {
+	v, ok := r.Params[key]
+	if !ok {
+		return def
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+		r.fail(key, v, "réel")
+		return def
+	}
+	return f
+}
+
+// Bool renvoie le paramètre booléen key (1, 0, true, false...), ou def s'il est absent.
+func (r *paramReader) Bool(key string, def bool) bool {
+	v, ok := r.Params[key]
+	if !ok {
+		return def
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		r.fail(key, v, "booléen")
+		return def
+	}
+	return b
+}
+
+// Color renvoie le paramètre couleur key ("r,g,b", "#rrggbb" ou "transparent"), ou def s'il est absent.
+func (r *paramReader) Color(key string, def color.RGBA) color.RGBA {
+	v, ok := r.Params[key]
+	if !ok {
+		return def
+	}
+	c, err := parseColor(v)
+	if err != nil {
+		r.fail(key, v, "r,g,b, #rrggbb ou transparent")
+		return def
+	}
+	return c
+}
+
+// parseColor lit une couleur "r,g,b", "#rrggbb" ou "transparent".
+func parseColor(v string) (color.RGBA, error) {
+	var r, g, b uint8
+	if strings.EqualFold(v, "transparent") {
+		return color.RGBA{}, nil
+	}
+	if strings.HasPrefix(v, "#") {
+		if _, err := fmt.Sscanf(v, "#%02x%02x%02x", &r, &g, &b); err != nil || len(v) != 7 {
+			return color.RGBA{}, fmt.Errorf("couleur invalide: %q (attendu r,g,b, #rrggbb ou transparent)", v)
+		}
+		return color.RGBA{r, g, b, 255}, nil
+	}
+	if _, err := fmt.Sscanf(strings.ReplaceAll(v, " ", ""), "%d,%d,%d", &r, &g, &b); err != nil {
+		return color.RGBA{}, fmt.Errorf("couleur invalide: %q (attendu r,g,b, #rrggbb ou transparent)", v)
+	}
+	return color.RGBA{r, g, b, 255}, nil
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"sync"
+	"time"
+)
+
+// Versions "avant" : lecture img.At(x, y).RGBA() et écriture result.Set(...) par pixel,
+// chaque appel passe par l'interface color.Color (allocation).
+
+func grayscaleAtSet(img image.Image, workers int) *image.RGBA {
+	bounds := img.Bounds()
+	result := image.NewRGBA(bounds)
+
+	w, block, _ := splitWorkers(bounds, workers)
+	var wg sync.WaitGroup
+
+	for i := 0; i < w; i++ {
+		startY := bounds.Min.Y + i*block
+		endY := startY + block
+		if i == w-1 {
+			endY = bounds.Max.Y
+		}
+
+		wg.Add(1)
+		go func(startY, endY int) {
+			defer wg.Done()
+			for y := startY; y < endY; y++ {
+				for x := bounds.Min.X; x < bounds.Max.X; x++ {
+					r, g, b, _ := img.At(x, y).RGBA()
+					avg := uint8(((r + g + b) / 3) >> 8)
+					result.Set(x, y, color.RGBA{avg, avg, avg, 255})
+				}
+			}
+		}(startY, endY)
+	}
+
+	wg.Wait()
+	return result
+}
+
+func blurAtSet(img image.Image, workers int, radius int) *image.RGBA {
+	bounds := img.Bounds()
+	result := image.NewRGBA(bounds)
+
+	w, block, _ := splitWorkers(bounds, workers)
+	var wg sync.WaitGroup
+
+	for i := 0; i < w; i++ {
+		startY := bounds.Min.Y + i*block
+		endY := startY + block
+		if i == w-1 {
+			endY = bounds.Max.Y
+		}
+
+		wg.Add(1)
+		go func(startY, endY int) {
+			defer wg.Done()
+			for y := startY; y < endY; y++ {
+				for x := bounds.Min.X; x < bounds.Max.X; x++ {
+					var sumR, sumG, sumB, count uint32
+					for ny := y - radius; ny <= y+radius; ny++ {
+						if ny < bounds.Min.Y || ny >= bounds.Max.Y {
+							continue
+						}
+						for nx := x - radius; nx <= x+radius; nx++ {
+							if nx < bounds.Min.X || nx >= bounds.Max.X {
+								continue
+							}
+							r, g, b, _ := img.At(nx, ny).RGBA()
+							sumR += r
+							sumG += g
+							sumB += b
+							count++
+						}
+					}
+					result.Set(x, y, color.RGBA{
+						uint8((sumR / count) >> 8),
+						uint8((sumG / count) >> 8),
+						uint8((sumB / count) >> 8),
+						255,
+					})
+				}
+			}
+		}(startY, endY)
+	}
+
+	wg.Wait()
+	return result
+}
+
+// blurPix : même flou naïf que blurAtSet (fenêtre réduite aux bords, O(r²) par pixel),
+// mais en lisant et écrivant les slices Pix : seule la façon d'accéder aux pixels change.
+func blurPix(img image.Image, workers int, radius int) *image.RGBA {
+	src := toRGBA(img)
+	bounds := src.Bounds()
+	result := image.NewRGBA(bounds)
+
+	forBands(bounds, workers, func(startY, endY int) {
+		for y := startY; y < endY; y++ {
+			di := result.PixOffset(bounds.Min.X, y)
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				var sumR, sumG, sumB, count uint32
+				for ny := max(y-radius, bounds.Min.Y); ny <= min(y+radius, bounds.Max.Y-1); ny++ {
+					si := src.PixOffset(max(x-radius, bounds.Min.X), ny)
+					for nx := max(x-radius, bounds.Min.X); nx <= min(x+radius, bounds.Max.X-1); nx++ {
+						sumR += uint32(src.Pix[si+0])
+						sumG += uint32(src.Pix[si+1])
+						sumB += uint32(src.Pix[si+2])
+						count++
+						si += 4
+					}
+				}
+				result.Pix[di+0] = uint8(sumR / count)
+				result.Pix[di+1] = uint8(sumG / count)
+				result.Pix[di+2] = uint8(sumB / count)
+				result.Pix[di+3] = 255
+				di += 4
+			}
+		}
+	})
+	return result
+}
+
+// genYCbCr génère une image YCbCr 4:2:0 (ce que renvoie le décodeur JPEG)
+func genYCbCr(size int) image.Image {
+	img := image.NewYCbCr(image.Rect(0, 0, size, size), image.YCbCrSubsampleRatio420)
+	for i := range img.Y {
+		img.Y[i] = uint8(i % 251)
+	}
+	for i := range img.Cb {
+		img.Cb[i] = uint8(i % 241)
+		img.Cr[i] = uint8(i % 239)
+	}
+	return img
+}
+
+func measure(f func()) time.Duration {
+	start := time.Now()
+	f()
+	return time.Since(start)
+}
+
+func main() {
+	fmt.Println("STUDY: Accès pixels (At/Set vs Pix)")
+	fmt.Println("Settings: image YCbCr (JPEG) 2048 x 2048, workers = 8, blur radius = 3")
+
+	img := genYCbCr(2048)
+	workers := 8
+
+	tOld := measure(func() { grayscaleAtSet(img, workers) })
+	tNew := measure(func() { Grayscale(img, workers, "average") })
+	fmt.Printf("\nGRAYSCALE\n")
+	fmt.Printf("At/Set: %v\n", tOld)
+	fmt.Printf("Pix:    %v\n", tNew)
+	fmt.Printf("Speedup: x%.2f\n", float64(tOld)/float64(tNew))
+
+	tOld = measure(func() { blurAtSet(img, workers, 3) })
+	tNew = measure(func() { blurPix(img, workers, 3) })
+	fmt.Printf("\nBLUR (même algorithme naïf des deux côtés)\n")
+	fmt.Printf("At/Set: %v\n", tOld)
+	fmt.Printf("Pix:    %v\n", tNew)
+	fmt.Printf("Speedup: x%.2f\n", float64(tOld)/float64(tNew))
+}
@@ -35,7 +35,7 @@ func main() {
 
 	for _, w := range workersList {
 		start := time.Now()
-		_ = Blur(img, w, 5)
+		_ = Blur(img, w, 5, Border{Mode: BorderShrink}, false)
 		t := time.Since(start).Seconds() * 1000
 
 		if w == 1 {
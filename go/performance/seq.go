@@ -3,6 +3,7 @@ package main
 import (
 	"image"
 	"image/color"
+	"image/draw"
 	"math"
 	"sort"
 )
@@ -23,19 +24,22 @@ func GrayscaleSeq(img image.Image) *image.RGBA {
 	return result
 }
 
-func BlurSeq(img image.Image, radius int) *image.RGBA {
+// BlurSeq : box blur séquentiel (fenêtre tronquée aux bords de l'image, comme Blur en BorderShrink).
+// linear : moyenne calculée en lumière linéaire (mêmes tables que Blur).
+func BlurSeq(img image.Image, radius int, linear bool) *image.RGBA {
 	bounds := img.Bounds()
 	result := image.NewRGBA(bounds)
 
 	if radius < 1 {
 		radius = 1
 	}
+	_, enc := lightTables(linear)
 
 	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
 		for x := bounds.Min.X; x < bounds.Max.X; x++ {
 
-			var sumR, sumG, sumB uint32
-			var count uint32
+			var sumR, sumG, sumB uint64
+			var count uint64
 
 			for ny := y - radius; ny <= y+radius; ny++ {
 				if ny < bounds.Min.Y || ny >= bounds.Max.Y {
@@ -46,9 +50,12 @@ func BlurSeq(img image.Image, radius int) *image.RGBA {
 						continue
 					}
 					r, g, b, _ := img.At(nx, ny).RGBA()
-					sumR += r
-					sumG += g
-					sumB += b
+					if linear {
+						r, g, b = uint32(srgb16ToLinear16[r]), uint32(srgb16ToLinear16[g]), uint32(srgb16ToLinear16[b])
+					}
+					sumR += uint64(r)
+					sumG += uint64(g)
+					sumB += uint64(b)
 					count++
 				}
 			}
@@ -58,9 +65,9 @@ func BlurSeq(img image.Image, radius int) *image.RGBA {
 				continue
 			}
 
-			avgR := uint8((sumR / count) >> 8)
-			avgG := uint8((sumG / count) >> 8)
-			avgB := uint8((sumB / count) >> 8)
+			avgR := enc[sumR/count]
+			avgG := enc[sumG/count]
+			avgB := enc[sumB/count]
 
 			result.Set(x, y, color.RGBA{avgR, avgG, avgB, 255})
 		}
@@ -143,8 +150,11 @@ func MedianFilterSeq(img image.Image) *image.RGBA {
 		}
 	}
 	return out
+}
 
-func PixelateSeq(img image.Image, blockSize int) *image.RGBA {
+// PixelateSeq : effet mosaïque séquentiel.
+// linear : moyenne des blocs calculée en lumière linéaire.
+func PixelateSeq(img image.Image, blockSize int, linear bool) *image.RGBA {
 	bounds := img.Bounds()
 	out := image.NewRGBA(bounds)
 
@@ -154,16 +164,21 @@ func PixelateSeq(img image.Image, blockSize int) *image.RGBA {
 
 	for y := bounds.Min.Y; y < bounds.Max.Y; y += blockSize {
 		for x := bounds.Min.X; x < bounds.Max.X; x += blockSize {
-			var sumR, sumG, sumB uint32
-			var count uint32
+			var sumR, sumG, sumB uint64
+			var count uint64
 
-			// Moyenne bloc
+			// Moyenne bloc : entière sur 8 bits, ou sur 16 bits en lumière linéaire
 			for yy := y; yy < y+blockSize && yy < bounds.Max.Y; yy++ {
 				for xx := x; xx < x+blockSize && xx < bounds.Max.X; xx++ {
 					r, g, b, _ := img.At(xx, yy).RGBA()
-					sumR += r >> 8
-					sumG += g >> 8
-					sumB += b >> 8
+					if linear {
+						r, g, b = uint32(srgb16ToLinear16[r]), uint32(srgb16ToLinear16[g]), uint32(srgb16ToLinear16[b])
+					} else {
+						r, g, b = r>>8, g>>8, b>>8
+					}
+					sumR += uint64(r)
+					sumG += uint64(g)
+					sumB += uint64(b)
 					count++
 				}
 			}
@@ -178,6 +193,9 @@ func PixelateSeq(img image.Image, blockSize int) *image.RGBA {
 				B: uint8(sumB / count),
 				A: 255,
 			}
+			if linear {
+				avg.R, avg.G, avg.B = linear16ToSRGB8[sumR/count], linear16ToSRGB8[sumG/count], linear16ToSRGB8[sumB/count]
+			}
 
 			// Remplissage bloc
 			for yy := y; yy < y+blockSize && yy < bounds.Max.Y; yy++ {